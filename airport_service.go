@@ -1,53 +1,44 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
+	"log/slog"
 	"net/url"
 	"sort"
 	"strconv"
+	"strings"
 )
 
 type AirportService struct {
-	config Config
-	client *http.Client
+	config *ConfigStore
+	google *GoogleClient
 }
 
-func NewAirportService(config Config, client *http.Client) *AirportService {
+func NewAirportService(config *ConfigStore, google *GoogleClient) *AirportService {
 	return &AirportService{
 		config: config,
-		client: client,
+		google: google,
 	}
 }
 
 // GeocodeLocation converts a location name to coordinates
-func (as *AirportService) GeocodeLocation(locationName string) (Location, error) {
-	baseURL := "https://maps.googleapis.com/maps/api/geocode/json"
-	params := url.Values{}
-	params.Add("address", locationName)
-	params.Add("key", as.config.GoogleMapsAPIKey)
-
-	resp, err := as.client.Get(baseURL + "?" + params.Encode())
-	if err != nil {
-		return Location{}, err
+func (as *AirportService) GeocodeLocation(ctx context.Context, locationName string) (Location, error) {
+	if strings.TrimSpace(locationName) == "" {
+		return Location{}, invalidInput("location name is empty")
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return Location{}, err
-	}
+	params := url.Values{}
+	params.Add("address", locationName)
 
 	var geocodeResp GoogleGeocodingResponse
-	if err := json.Unmarshal(body, &geocodeResp); err != nil {
-		return Location{}, err
+	err := as.google.Get(ctx, "geocode", "geocode/json", params, &geocodeResp)
+	if errors.Is(err, ErrZeroResults) || (err == nil && len(geocodeResp.Results) == 0) {
+		return Location{}, fmt.Errorf("%w: %s", ErrGeocodeNotFound, locationName)
 	}
-
-	if geocodeResp.Status != "OK" || len(geocodeResp.Results) == 0 {
-		return Location{}, fmt.Errorf("geocoding failed for %s", locationName)
+	if err != nil {
+		return Location{}, fmt.Errorf("geocoding failed for %s: %w", locationName, err)
 	}
 
 	result := geocodeResp.Results[0]
@@ -73,17 +64,20 @@ func (as *AirportService) GeocodeLocation(locationName string) (Location, error)
 }
 
 // FindReachableAirports finds airports reachable from a given location
-func (as *AirportService) FindReachableAirports(origin Location) ([]Location, error) {
-	airports, err := as.FindNearbyAirports(origin, as.config.DefaultRadius)
+func (as *AirportService) FindReachableAirports(ctx context.Context, origin Location) ([]Location, error) {
+	// One snapshot per search, so a reload can't mix old and new settings
+	config := as.config.Load()
+
+	airports, err := as.FindNearbyAirports(ctx, origin, config.DefaultRadius)
 	if err != nil {
-		return nil, fmt.Errorf("failed to search nearby airports: %v", err)
+		return nil, fmt.Errorf("failed to search nearby airports: %w", err)
 	}
 
 	var reachableAirports []AirportDistance
 	for _, airport := range airports {
 		distance := CalculateDistance(origin.Latitude, origin.Longitude, airport.Latitude, airport.Longitude)
 
-		if distance <= as.config.MaxDistance {
+		if distance <= config.MaxDistance {
 			reachableAirports = append(reachableAirports, AirportDistance{
 				Airport:  airport,
 				Distance: distance,
@@ -98,7 +92,7 @@ func (as *AirportService) FindReachableAirports(origin Location) ([]Location, er
 
 	// Return top airports
 	var result []Location
-	maxAirports := as.config.MaxAirports
+	maxAirports := config.MaxAirports
 	if len(reachableAirports) < maxAirports {
 		maxAirports = len(reachableAirports)
 	}
@@ -107,45 +101,35 @@ func (as *AirportService) FindReachableAirports(origin Location) ([]Location, er
 		result = append(result, reachableAirports[i].Airport)
 	}
 
-	log.Printf("Found %d reachable airports from %s", len(result), origin.Name)
+	logger := LoggerFromContext(ctx)
+	logger.Info("found reachable airports", slog.String(logKeyOrigin, origin.Name), slog.Int("count", len(result)))
 	for i, airport := range result {
-		if i < len(reachableAirports) {
-			log.Printf("  %d. %s (%s) - %.1f km", i+1, airport.Name, airport.Code, reachableAirports[i].Distance)
-		}
+		logger.Debug("reachable airport",
+			slog.String(logKeyOrigin, origin.Name),
+			slog.String(logKeyAirport, airport.Code),
+			slog.String("airport_name", airport.Name),
+			slog.Float64("distance_km", reachableAirports[i].Distance),
+		)
 	}
 
 	return result, nil
 }
 
 // FindNearbyAirports searches for airports near a location using Google Places API
-func (as *AirportService) FindNearbyAirports(origin Location, radiusMeters int) ([]Location, error) {
-	baseURL := "https://maps.googleapis.com/maps/api/place/nearbysearch/json"
+func (as *AirportService) FindNearbyAirports(ctx context.Context, origin Location, radiusMeters int) ([]Location, error) {
 	params := url.Values{}
 	params.Add("location", fmt.Sprintf("%f,%f", origin.Latitude, origin.Longitude))
 	params.Add("radius", strconv.Itoa(radiusMeters))
 	params.Add("type", "airport")
-	params.Add("key", as.config.GoogleMapsAPIKey)
-
-	resp, err := as.client.Get(baseURL + "?" + params.Encode())
-	if err != nil {
-		return nil, fmt.Errorf("API request failed: %v", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
-	}
 
 	var placesResp GooglePlacesResponse
-	if err := json.Unmarshal(body, &placesResp); err != nil {
-		return nil, fmt.Errorf("failed to parse response: %v", err)
-	}
-
-	if placesResp.Status != "OK" {
-		log.Printf("Google Places API returned status: %s", placesResp.Status)
+	err := as.google.Get(ctx, "places", "place/nearbysearch/json", params, &placesResp)
+	if errors.Is(err, ErrZeroResults) {
 		return []Location{}, nil
 	}
+	if err != nil {
+		return nil, err
+	}
 
 	var airports []Location
 	for _, place := range placesResp.Results {
@@ -14,9 +14,18 @@ type GoogleDirectionsResponse struct {
 			} `json:"distance"`
 			StartAddress string `json:"start_address"`
 			EndAddress   string `json:"end_address"`
+			Steps        []struct {
+				Polyline GooglePolyline `json:"polyline"`
+			} `json:"steps"`
 		} `json:"legs"`
+		OverviewPolyline GooglePolyline `json:"overview_polyline"`
 	} `json:"routes"`
-	Status string `json:"status"`
+	GoogleStatus
+}
+
+// GooglePolyline is a path in the encoded polyline format
+type GooglePolyline struct {
+	Points string `json:"points"`
 }
 
 // Google Places API Response structures
@@ -35,7 +44,7 @@ type GooglePlacesResponse struct {
 		Rating         float64  `json:"rating,omitempty"`
 		PriceLevel     int      `json:"price_level,omitempty"`
 	} `json:"results"`
-	Status string `json:"status"`
+	GoogleStatus
 }
 
 // Geocoding API Response
@@ -54,5 +63,11 @@ type GoogleGeocodingResponse struct {
 			Types     []string `json:"types"`
 		} `json:"address_components"`
 	} `json:"results"`
-	Status string `json:"status"`
+	GoogleStatus
+}
+
+// Time Zone API Response
+type GoogleTimeZoneResponse struct {
+	TimeZoneID string `json:"timeZoneId"`
+	GoogleStatus
 }
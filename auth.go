@@ -0,0 +1,423 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey is a client credential for the search endpoints. Only a hash of
+// the secret key is stored.
+type APIKey struct {
+	ID           string         `json:"id"`
+	Name         string         `json:"name"`
+	Hash         string         `json:"hash"`
+	RateLimit    float64        `json:"rate_limit"`    // requests per second, 0 = unlimited
+	MonthlyQuota int            `json:"monthly_quota"` // requests per calendar month, 0 = unlimited
+	CreatedAt    time.Time      `json:"created_at"`
+	RevokedAt    *time.Time     `json:"revoked_at,omitempty"`
+	Usage        map[string]int `json:"usage,omitempty"` // requests per "2006-01" month
+}
+
+// KeyStore keeps API keys in a JSON file. Issuing and revoking keys saves
+// the file immediately; usage counters are saved by Flush.
+type KeyStore struct {
+	path string
+	now  func() time.Time
+
+	mu       sync.Mutex
+	keys     map[string]*APIKey
+	byHash   map[string]*APIKey
+	limiters map[string]*TokenBucket
+	dirty    bool
+}
+
+// OpenKeyStore loads the key file at path, starting empty if it doesn't exist
+func OpenKeyStore(path string) (*KeyStore, error) {
+	ks := &KeyStore{
+		path:     path,
+		now:      time.Now,
+		keys:     make(map[string]*APIKey),
+		byHash:   make(map[string]*APIKey),
+		limiters: make(map[string]*TokenBucket),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return ks, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key store: %w", err)
+	}
+
+	var keys []*APIKey
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("failed to parse key store %s: %w", path, err)
+	}
+	for _, key := range keys {
+		ks.add(key)
+	}
+
+	return ks, nil
+}
+
+// clone copies a key so it can be handed out without sharing Usage
+func (k *APIKey) clone() APIKey {
+	c := *k
+	c.Usage = make(map[string]int, len(k.Usage))
+	for month, n := range k.Usage {
+		c.Usage[month] = n
+	}
+	return c
+}
+
+func (ks *KeyStore) add(key *APIKey) {
+	if key.Usage == nil {
+		key.Usage = make(map[string]int)
+	}
+	ks.keys[key.ID] = key
+	ks.byHash[key.Hash] = key
+	ks.limiters[key.ID] = NewTokenBucket(key.RateLimit)
+}
+
+// Issue creates a key and returns it together with the secret, which is
+// not stored and can't be recovered later
+func (ks *KeyStore) Issue(name string, rateLimit float64, monthlyQuota int) (APIKey, string, error) {
+	id, err := randomHex(8)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	secret, err := randomHex(24)
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	secret = "tr_" + id + "_" + secret
+
+	key := &APIKey{
+		ID:           id,
+		Name:         name,
+		Hash:         hashKey(secret),
+		RateLimit:    rateLimit,
+		MonthlyQuota: monthlyQuota,
+		CreatedAt:    ks.now().UTC(),
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.add(key)
+	if err := ks.save(); err != nil {
+		delete(ks.keys, key.ID)
+		delete(ks.byHash, key.Hash)
+		delete(ks.limiters, key.ID)
+		return APIKey{}, "", err
+	}
+
+	return key.clone(), secret, nil
+}
+
+// Revoke disables a key permanently
+func (ks *KeyStore) Revoke(id string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok := ks.keys[id]
+	if !ok {
+		return fmt.Errorf("%w: API key %s", ErrNotFound, id)
+	}
+	if key.RevokedAt == nil {
+		revokedAt := ks.now().UTC()
+		key.RevokedAt = &revokedAt
+	}
+
+	return ks.save()
+}
+
+// List returns all keys, oldest first
+func (ks *KeyStore) List() []APIKey {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	keys := make([]APIKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, key.clone())
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys
+}
+
+// Authorize checks a secret key and charges one request against its rate
+// limit and monthly quota. It returns the key and its remaining quota (-1
+// when unlimited).
+func (ks *KeyStore) Authorize(secret string) (APIKey, int, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok := ks.byHash[hashKey(secret)]
+	if !ok || key.RevokedAt != nil {
+		return APIKey{}, 0, fmt.Errorf("%w: invalid or revoked API key", ErrUnauthorized)
+	}
+
+	if !ks.limiters[key.ID].Allow() {
+		return APIKey{}, 0, fmt.Errorf("%w: more than %g requests per second", ErrRateLimited, key.RateLimit)
+	}
+
+	month := ks.now().UTC().Format("2006-01")
+	if key.MonthlyQuota > 0 && key.Usage[month] >= key.MonthlyQuota {
+		return APIKey{}, 0, fmt.Errorf("%w: %d requests used this month", ErrQuotaExceeded, key.MonthlyQuota)
+	}
+
+	key.Usage[month]++
+	ks.dirty = true
+
+	remaining := -1
+	if key.MonthlyQuota > 0 {
+		remaining = key.MonthlyQuota - key.Usage[month]
+	}
+	return key.clone(), remaining, nil
+}
+
+// Flush saves usage counters if they changed since the last save
+func (ks *KeyStore) Flush() error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if !ks.dirty {
+		return nil
+	}
+	return ks.save()
+}
+
+// save writes the key file atomically. Callers hold mu.
+func (ks *KeyStore) save() error {
+	keys := make([]*APIKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(ks.path), ".keys-*.json")
+	if err != nil {
+		return fmt.Errorf("failed to save key store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save key store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save key store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), ks.path); err != nil {
+		return fmt.Errorf("failed to save key store: %w", err)
+	}
+
+	ks.dirty = false
+	return nil
+}
+
+func hashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// bearerToken reads the credential from "Authorization: Bearer ..." or,
+// for API keys, the X-API-Key header
+func bearerToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+type apiKeyContextKey struct{}
+
+// APIKeyFromContext returns the key that authorized the request, if any
+func APIKeyFromContext(ctx context.Context) (APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(APIKey)
+	return key, ok
+}
+
+// RequireAPIKey wraps a handler so it only runs for requests carrying a
+// valid key within its limits. A nil store disables authentication.
+func (ks *KeyStore) RequireAPIKey(next http.HandlerFunc) http.HandlerFunc {
+	if ks == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := bearerToken(r)
+		if secret == "" {
+			writeProblem(w, fmt.Errorf("%w: missing API key", ErrUnauthorized))
+			return
+		}
+
+		key, remaining, err := ks.Authorize(secret)
+		if err != nil {
+			writeProblem(w, err)
+			return
+		}
+
+		if remaining >= 0 {
+			w.Header().Set("X-Quota-Remaining", strconv.Itoa(remaining))
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	}
+}
+
+// RequireToken wraps a handler so it only runs for requests carrying token
+// as a bearer token. Unlike API keys, nothing is charged to a quota. With
+// no token configured the handler is closed.
+func RequireToken(token, name string, next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			writeProblem(w, fmt.Errorf("%w: %s is disabled, no token is configured", ErrForbidden, name))
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(token)) != 1 {
+			writeProblem(w, fmt.Errorf("%w: invalid token for %s", ErrUnauthorized, name))
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// AdminHandler serves the key management endpoints:
+//
+//	GET    /admin/keys       list keys
+//	POST   /admin/keys       issue a key, returning its secret once
+//	DELETE /admin/keys/{id}  revoke a key
+type AdminHandler struct {
+	store  *KeyStore
+	token  string
+	config Config
+}
+
+func NewAdminHandler(store *KeyStore, config Config) *AdminHandler {
+	return &AdminHandler{
+		store:  store,
+		token:  config.AdminToken,
+		config: config,
+	}
+}
+
+// authorized checks the admin bearer token. With no token configured the
+// admin endpoints are closed.
+func (ah *AdminHandler) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if ah.store == nil || ah.token == "" {
+		writeProblem(w, fmt.Errorf("%w: key administration is disabled", ErrForbidden))
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(bearerToken(r)), []byte(ah.token)) != 1 {
+		writeProblem(w, fmt.Errorf("%w: invalid admin token", ErrUnauthorized))
+		return false
+	}
+	return true
+}
+
+func (ah *AdminHandler) handleListKeys(w http.ResponseWriter, r *http.Request) {
+	if !ah.authorized(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ah.store.List())
+}
+
+// issueKeyRequest is the body of POST /admin/keys. Omitted limits use the
+// configured defaults.
+type issueKeyRequest struct {
+	Name         string   `json:"name"`
+	RateLimit    *float64 `json:"rate_limit,omitempty"`
+	MonthlyQuota *int     `json:"monthly_quota,omitempty"`
+}
+
+// issueKeyResponse returns the new key with its secret, shown only once
+type issueKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+func (ah *AdminHandler) handleIssueKey(w http.ResponseWriter, r *http.Request) {
+	if !ah.authorized(w, r) {
+		return
+	}
+
+	var req issueKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeProblem(w, invalidInput("invalid request body: %v", err))
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeProblem(w, invalidInput("name is required"))
+		return
+	}
+
+	rateLimit := ah.config.DefaultKeyRateLimit
+	if req.RateLimit != nil {
+		rateLimit = *req.RateLimit
+	}
+	monthlyQuota := ah.config.DefaultKeyMonthlyQuota
+	if req.MonthlyQuota != nil {
+		monthlyQuota = *req.MonthlyQuota
+	}
+	if rateLimit < 0 || monthlyQuota < 0 {
+		writeProblem(w, invalidInput("limits must not be negative"))
+		return
+	}
+
+	key, secret, err := ah.store.Issue(req.Name, rateLimit, monthlyQuota)
+	if err != nil {
+		writeProblem(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(issueKeyResponse{APIKey: key, Key: secret})
+}
+
+func (ah *AdminHandler) handleRevokeKey(w http.ResponseWriter, r *http.Request) {
+	if !ah.authorized(w, r) {
+		return
+	}
+
+	if err := ah.store.Revoke(r.PathValue("id")); err != nil {
+		writeProblem(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeyStore(t *testing.T) *KeyStore {
+	ks, err := OpenKeyStore(filepath.Join(t.TempDir(), "keys.json"))
+	require.NoError(t, err)
+	return ks
+}
+
+func TestKeyStore_IssueAndAuthorize(t *testing.T) {
+	ks := newTestKeyStore(t)
+
+	key, secret, err := ks.Issue("ops", 0, 2)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret, "tr_"+key.ID+"_"))
+	assert.NotContains(t, key.Hash, secret)
+
+	authorized, remaining, err := ks.Authorize(secret)
+	assert.NoError(t, err)
+	assert.Equal(t, key.ID, authorized.ID)
+	assert.Equal(t, 1, remaining)
+
+	_, remaining, err = ks.Authorize(secret)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, remaining)
+
+	_, _, err = ks.Authorize(secret)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	_, _, err = ks.Authorize("tr_unknown")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestKeyStore_QuotaResetsMonthly(t *testing.T) {
+	ks := newTestKeyStore(t)
+	now := time.Date(2024, 6, 30, 23, 0, 0, 0, time.UTC)
+	ks.now = func() time.Time { return now }
+
+	_, secret, err := ks.Issue("ops", 0, 1)
+	require.NoError(t, err)
+
+	_, _, err = ks.Authorize(secret)
+	assert.NoError(t, err)
+	_, _, err = ks.Authorize(secret)
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+	now = now.Add(2 * time.Hour)
+	_, _, err = ks.Authorize(secret)
+	assert.NoError(t, err)
+}
+
+func TestKeyStore_RateLimit(t *testing.T) {
+	ks := newTestKeyStore(t)
+	_, secret, err := ks.Issue("ops", 1, 0)
+	require.NoError(t, err)
+
+	_, remaining, err := ks.Authorize(secret)
+	assert.NoError(t, err)
+	assert.Equal(t, -1, remaining)
+
+	_, _, err = ks.Authorize(secret)
+	assert.ErrorIs(t, err, ErrRateLimited)
+}
+
+func TestKeyStore_Revoke(t *testing.T) {
+	ks := newTestKeyStore(t)
+	key, secret, err := ks.Issue("ops", 0, 0)
+	require.NoError(t, err)
+
+	assert.NoError(t, ks.Revoke(key.ID))
+	_, _, err = ks.Authorize(secret)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	assert.ErrorIs(t, ks.Revoke("missing"), ErrNotFound)
+}
+
+func TestKeyStore_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	ks, err := OpenKeyStore(path)
+	require.NoError(t, err)
+
+	key, secret, err := ks.Issue("ops", 0, 10)
+	require.NoError(t, err)
+	_, _, err = ks.Authorize(secret)
+	require.NoError(t, err)
+	require.NoError(t, ks.Flush())
+
+	reopened, err := OpenKeyStore(path)
+	require.NoError(t, err)
+	keys := reopened.List()
+	require.Len(t, keys, 1)
+	assert.Equal(t, key.ID, keys[0].ID)
+	assert.Equal(t, 1, keys[0].Usage[time.Now().UTC().Format("2006-01")])
+
+	_, remaining, err := reopened.Authorize(secret)
+	assert.NoError(t, err)
+	assert.Equal(t, 8, remaining)
+}
+
+func TestRequireAPIKey(t *testing.T) {
+	ks := newTestKeyStore(t)
+	key, secret, err := ks.Issue("ops", 0, 5)
+	require.NoError(t, err)
+
+	var seen APIKey
+	handler := ks.RequireAPIKey(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = APIKeyFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	t.Run("Missing key", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/search", nil))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+
+	t.Run("X-API-Key header", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/search", nil)
+		req.Header.Set("X-API-Key", secret)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, key.ID, seen.ID)
+		assert.Equal(t, "4", w.Header().Get("X-Quota-Remaining"))
+	})
+
+	t.Run("Bearer token", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/search", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Nil store disables auth", func(t *testing.T) {
+		var disabled *KeyStore
+		w := httptest.NewRecorder()
+		disabled.RequireAPIKey(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})(w, httptest.NewRequest("GET", "/search", nil))
+		assert.Equal(t, http.StatusTeapot, w.Code)
+	})
+}
+
+func TestAdminHandler(t *testing.T) {
+	ks := newTestKeyStore(t)
+	admin := NewAdminHandler(ks, Config{AdminToken: "admin-secret", DefaultKeyRateLimit: 5, DefaultKeyMonthlyQuota: 100})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/keys", admin.handleListKeys)
+	mux.HandleFunc("POST /admin/keys", admin.handleIssueKey)
+	mux.HandleFunc("DELETE /admin/keys/{id}", admin.handleRevokeKey)
+
+	do := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do("GET", "/admin/keys", "", "wrong").Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/admin/keys", `{}`, "admin-secret").Code)
+
+	w := do("POST", "/admin/keys", `{"name": "ops team"}`, "admin-secret")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var issued issueKeyResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&issued))
+	assert.Equal(t, "ops team", issued.Name)
+	assert.Equal(t, 5.0, issued.RateLimit)
+	assert.Equal(t, 100, issued.MonthlyQuota)
+	assert.NotEmpty(t, issued.Key)
+
+	w = do("GET", "/admin/keys", "", "admin-secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), issued.Key)
+
+	assert.Equal(t, http.StatusNoContent, do("DELETE", "/admin/keys/"+issued.ID, "", "admin-secret").Code)
+	assert.Equal(t, http.StatusNotFound, do("DELETE", "/admin/keys/missing", "", "admin-secret").Code)
+
+	_, _, err := ks.Authorize(issued.Key)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestAdminHandler_Disabled(t *testing.T) {
+	admin := NewAdminHandler(newTestKeyStore(t), Config{})
+
+	req := httptest.NewRequest("GET", "/admin/keys", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	admin.handleListKeys(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
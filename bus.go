@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// BusProvider finds intercity coach connections between two places
+type BusProvider interface {
+	// SearchBuses is SearchTrains for coaches, between bus stations
+	SearchBuses(ctx context.Context, from, to Location, date time.Time) ([]TransportOption, error)
+}
+
+// busFarePerKm prices coaches whose feed has no fare for their route
+const busFarePerKm = 0.06
+
+var busSearch = gtfsModeSearch{mode: "bus", locationType: "bus_station", routeTypes: isBusRouteType, farePerKm: busFarePerKm}
+
+// GTFSBus answers coach searches from the bus routes of a GTFS timetable,
+// such as the feeds Alsa and FlixBus publish, the same way GTFSRail does
+// for trains
+type GTFSBus struct {
+	feed   *GTFSFeed
+	config *ConfigStore
+}
+
+func NewGTFSBus(feed *GTFSFeed, config *ConfigStore) *GTFSBus {
+	return &GTFSBus{feed: feed, config: config}
+}
+
+func (gb *GTFSBus) SearchBuses(ctx context.Context, from, to Location, date time.Time) ([]TransportOption, error) {
+	radius := float64(gb.config.Load().StationRadius)
+	return busSearch.search(ctx, gb.feed, from, to, radius, radius, date, 1), nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGTFSBus_SearchBuses(t *testing.T) {
+	feed, err := LoadGTFS(filepath.Join("testdata", "gtfs", "bus"))
+	require.NoError(t, err)
+	buses := NewGTFSBus(feed, NewConfigStore(DefaultConfig()))
+	granada := Location{Name: "Granada", Latitude: 37.1773, Longitude: -3.5986}
+	madrid := Location{Name: "Madrid", Latitude: 40.4168, Longitude: -3.7038}
+	date := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	options, err := buses.SearchBuses(context.Background(), granada, madrid, date)
+	require.NoError(t, err)
+	require.Len(t, options, 2)
+	assert.Equal(t, "bus", options[0].Mode)
+	assert.Equal(t, "bus_station", options[0].From.Type)
+	assert.Equal(t, "Madrid Estación Sur", options[0].To.Name)
+
+	t.Run("Trains are left out", func(t *testing.T) {
+		buses := NewGTFSBus(loadTestFeed(t), NewConfigStore(DefaultConfig()))
+		barcelona := Location{Name: "Barcelona", Latitude: 41.3874, Longitude: 2.1686}
+		options, err := buses.SearchBuses(context.Background(), madrid, barcelona, date)
+		require.NoError(t, err)
+		assert.Empty(t, options)
+	})
+}
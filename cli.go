@@ -0,0 +1,484 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/walidBarakehe/travel-routes/renderer"
+)
+
+// loadConfig loads the layered configuration and the secrets held by the
+// configured secrets backend
+func loadConfig(ctx context.Context, configFlags *ConfigFlags) (Config, error) {
+	config, err := configFlags.Load()
+	if err != nil {
+		return Config{}, err
+	}
+	if err := ResolveSecrets(ctx, &config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// loadValidConfig loads the configuration and secrets and validates them
+func loadValidConfig(ctx context.Context, configFlags *ConfigFlags) (Config, error) {
+	config, err := loadConfig(ctx, configFlags)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := config.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return config, nil
+}
+
+// runConfigCommand implements "config print" and "config validate" and
+// returns the exit code
+func runConfigCommand(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || (args[0] != "print" && args[0] != "validate") {
+		fmt.Fprintln(stderr, "usage: travel-routes config print|validate [flags]")
+		return 2
+	}
+	command := args[0]
+
+	fs := flag.NewFlagSet("config "+command, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configFlags := RegisterConfigFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	config, err := loadConfig(context.Background(), configFlags)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+
+	// Print even an invalid configuration, since seeing it is usually how
+	// the problem gets found
+	if command == "print" {
+		if err := config.WriteYAML(stdout); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		fmt.Fprintf(stderr, "invalid configuration:\n%v\n", err)
+		return 1
+	}
+	if command == "validate" {
+		fmt.Fprintln(stdout, "configuration is valid")
+	}
+	return 0
+}
+
+// runSecretsCommand implements "secrets keygen" and "secrets encrypt" for
+// the encrypted secrets file backend and returns the exit code. encrypt
+// reads a JSON object of secrets (google_maps_api_key, ...) from stdin and
+// writes the file contents to stdout, using the key from SECRETS_KEY or
+// SECRETS_KEY_FILE.
+func runSecretsCommand(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || (args[0] != "keygen" && args[0] != "encrypt") {
+		fmt.Fprintln(stderr, "usage: travel-routes secrets keygen|encrypt < secrets.json > secrets.enc")
+		return 2
+	}
+
+	if args[0] == "keygen" {
+		key, err := NewSecretsKey()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintln(stdout, key)
+		return 0
+	}
+
+	config, err := LoadConfig()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	key, err := parseSecretsKey(config.SecretsKey)
+	if err != nil {
+		fmt.Fprintf(stderr, "secrets_key: %v\n", err)
+		return 1
+	}
+
+	var secrets map[string]string
+	if err := json.NewDecoder(stdin).Decode(&secrets); err != nil {
+		fmt.Fprintf(stderr, "expected a JSON object of secrets on stdin: %v\n", err)
+		return 1
+	}
+	data, err := EncryptSecrets(key, secrets)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	stdout.Write(data)
+	return 0
+}
+
+// Output formats of the query commands. Routes can also be drawn in the
+// terminal formats of the renderer package.
+var (
+	queryFormats = []string{"table", "json", "csv"}
+	routeFormats = []string{"table", "text", "compact", "timeline", "markdown", "json", "csv", "geojson", "kml"}
+)
+
+// queryCommand holds the options of the search, airports and geocode
+// commands
+type queryCommand struct {
+	name        string
+	origin      string
+	destination string
+	date        time.Time
+	location    string
+	radius      int
+	format      string
+	color       string // auto, always or never
+	limit       int
+	sortBy      string
+	vehicle     string
+	filter      routeFilter
+	icsPath     string
+	icsRoute    int
+}
+
+// routeFilter narrows search results on the client side. Zero values don't
+// filter.
+type routeFilter struct {
+	MaxPrice    float64
+	MaxDuration time.Duration
+	MaxSegments int
+	Modes       []string // every segment must use one of these modes
+}
+
+// Apply returns the routes that pass the filter, keeping their order
+func (f routeFilter) Apply(routes []Route) []Route {
+	var kept []Route
+	for _, route := range routes {
+		if f.allows(route) {
+			kept = append(kept, route)
+		}
+	}
+	return kept
+}
+
+func (f routeFilter) allows(route Route) bool {
+	if f.MaxPrice > 0 && route.TotalPrice > f.MaxPrice {
+		return false
+	}
+	if f.MaxDuration > 0 && route.TotalTime > f.MaxDuration {
+		return false
+	}
+	if f.MaxSegments > 0 && len(route.Segments) > f.MaxSegments {
+		return false
+	}
+	if len(f.Modes) > 0 {
+		for _, segment := range route.Segments {
+			if !slices.Contains(f.Modes, segment.Mode) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseQueryCommand parses the flags of a query command, including the
+// configuration overrides
+func parseQueryCommand(name string, args []string, stderr io.Writer) (*queryCommand, *ConfigFlags, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configFlags := RegisterConfigFlags(fs)
+
+	q := &queryCommand{name: name}
+	var date, modes string
+	formats := queryFormats
+	if name == "search" {
+		formats = routeFormats
+	}
+	fs.StringVar(&q.format, "format", "table", "output format: "+strings.Join(formats, ", "))
+	switch name {
+	case "search":
+		fs.StringVar(&q.color, "color", "auto", "colour output: auto (when stdout is a terminal and NO_COLOR is unset), always or never")
+		fs.StringVar(&q.origin, "origin", "", "where the trip starts (required)")
+		fs.StringVar(&q.destination, "destination", "", "where the trip ends (required)")
+		fs.StringVar(&date, "date", time.Now().UTC().Format("2006-01-02"), "travel date, YYYY-MM-DD")
+		fs.IntVar(&q.limit, "limit", 0, "show at most this many routes (0 = all)")
+		fs.StringVar(&q.sortBy, "sort", "price", "order routes by price, duration or co2")
+		fs.StringVar(&q.vehicle, "vehicle", "", "take a car, motorcycle, van or bicycle on ferries")
+		fs.Float64Var(&q.filter.MaxPrice, "max-price", 0, "drop routes costing more")
+		fs.DurationVar(&q.filter.MaxDuration, "max-duration", 0, "drop routes taking longer, e.g. 12h")
+		fs.IntVar(&q.filter.MaxSegments, "max-segments", 0, "drop routes with more segments")
+		fs.StringVar(&modes, "modes", "", "comma-separated modes every segment must use, e.g. flight,taxi")
+		fs.StringVar(&q.icsPath, "ics", "", "also write a route to this iCalendar file")
+		fs.IntVar(&q.icsRoute, "ics-route", 1, "which route of the results to write with -ics, counting from 1")
+	case "airports":
+		fs.StringVar(&q.location, "location", "", "place to search around (required)")
+		fs.IntVar(&q.radius, "radius", 0, "search radius in meters (default DEFAULT_RADIUS)")
+	case "geocode":
+		fs.StringVar(&q.location, "location", "", "place to resolve (required)")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	if !slices.Contains(formats, q.format) {
+		return nil, nil, fmt.Errorf("-format must be one of %s, got %q", strings.Join(formats, ", "), q.format)
+	}
+
+	switch name {
+	case "search":
+		if q.origin == "" || q.destination == "" {
+			return nil, nil, errors.New("-origin and -destination are required")
+		}
+		if q.icsRoute < 1 {
+			return nil, nil, errors.New("-ics-route must be at least 1")
+		}
+		if routeOrders[q.sortBy] == nil {
+			return nil, nil, fmt.Errorf("-sort must be price, duration or co2, got %q", q.sortBy)
+		}
+		if q.vehicle != "" && !slices.Contains(vehicleTypes, q.vehicle) {
+			return nil, nil, fmt.Errorf("-vehicle must be car, motorcycle, van or bicycle, got %q", q.vehicle)
+		}
+		if !slices.Contains([]string{"auto", "always", "never"}, q.color) {
+			return nil, nil, fmt.Errorf("-color must be auto, always or never, got %q", q.color)
+		}
+		var err error
+		if q.date, err = time.Parse("2006-01-02", date); err != nil {
+			return nil, nil, fmt.Errorf("invalid -date %q, use YYYY-MM-DD", date)
+		}
+		for _, mode := range strings.Split(modes, ",") {
+			if mode = strings.TrimSpace(mode); mode != "" {
+				q.filter.Modes = append(q.filter.Modes, mode)
+			}
+		}
+	default:
+		if q.location == "" {
+			return nil, nil, errors.New("-location is required")
+		}
+	}
+	return q, configFlags, nil
+}
+
+// runQueryCommand implements "search", "airports" and "geocode" and returns
+// the exit code: 0 on success, 1 if the query failed, 2 on a usage error
+func runQueryCommand(name string, args []string, stdout, stderr io.Writer) int {
+	q, configFlags, err := parseQueryCommand(name, args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "travel-routes %s: %v\n", name, err)
+		return 2
+	}
+
+	config, err := loadValidConfig(context.Background(), configFlags)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	logger, err := NewLogger(stderr, config.LogLevel, config.LogFormat)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	slog.SetDefault(logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, config.RequestTimeout)
+	defer cancel()
+
+	if err := q.run(ctx, NewTravelFinder(config), stdout); err != nil {
+		fmt.Fprintf(stderr, "travel-routes %s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// run executes the query against tf and writes the result to w
+func (q *queryCommand) run(ctx context.Context, tf *TravelFinder, w io.Writer) error {
+	switch q.name {
+	case "search":
+		routes, err := tf.FindRoutes(ctx, q.origin, q.destination, q.date)
+		if err != nil {
+			return err
+		}
+		if q.vehicle != "" {
+			routes = AddVehicle(routes, q.vehicle)
+		}
+		if q.sortBy != "" {
+			SortRoutes(routes, q.sortBy)
+		}
+		routes = q.filter.Apply(routes)
+		if q.limit > 0 && len(routes) > q.limit {
+			routes = routes[:q.limit]
+		}
+		if q.icsPath != "" {
+			if err := q.writeICS(ctx, tf, routes); err != nil {
+				return err
+			}
+		}
+		return writeRoutes(w, q.format, routes, renderer.Options{Color: useColor(q.color, w)})
+
+	case "airports":
+		loc, err := tf.airportSvc.GeocodeLocation(ctx, q.location)
+		if err != nil {
+			return err
+		}
+		radius := q.radius
+		if radius <= 0 {
+			radius = tf.config.Load().DefaultRadius
+		}
+		airports, err := tf.airportSvc.FindNearbyAirports(ctx, loc, radius)
+		if err != nil {
+			return err
+		}
+		return writeLocations(w, q.format, airports)
+
+	case "geocode":
+		loc, err := tf.airportSvc.GeocodeLocation(ctx, q.location)
+		if err != nil {
+			return err
+		}
+		return writeLocations(w, q.format, []Location{loc})
+	}
+	return fmt.Errorf("unknown command %q", q.name)
+}
+
+// writeICS writes the -ics-route route of the results to the -ics file
+func (q *queryCommand) writeICS(ctx context.Context, tf *TravelFinder, routes []Route) error {
+	if q.icsRoute > len(routes) {
+		return fmt.Errorf("-ics-route %d: the search found %d routes", q.icsRoute, len(routes))
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return err
+	}
+	uid := fmt.Sprintf("%s-%d", id, q.icsRoute)
+
+	f, err := os.Create(q.icsPath)
+	if err != nil {
+		return err
+	}
+	route := tf.timeZones.AddTimeZones(ctx, routes[q.icsRoute-1])
+	if err := WriteICS(f, route, uid, time.Now()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// useColor decides whether to colour output written to w
+func useColor(mode string, w io.Writer) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// writeRoutes writes routes in the given output format: JSON, CSV with one
+// row per route, a map format, or one of the renderer package formats
+func writeRoutes(w io.Writer, format string, routes []Route, opts renderer.Options) error {
+	switch format {
+	case "json":
+		if routes == nil {
+			routes = []Route{}
+		}
+		return writeJSON(w, routes)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"route", "description", "departure", "arrival", "duration_minutes", "total_price", "currency", "segments", "co2_kg"})
+		for i, route := range routes {
+			cw.Write([]string{
+				strconv.Itoa(i + 1),
+				route.Description,
+				route.Departure.Format(time.RFC3339),
+				route.Arrival.Format(time.RFC3339),
+				strconv.Itoa(int(route.TotalTime.Minutes())),
+				strconv.FormatFloat(route.TotalPrice, 'f', 2, 64),
+				route.Currency,
+				strconv.Itoa(len(route.Segments)),
+				strconv.FormatFloat(route.TotalCO2, 'f', 1, 64),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "geojson", "kml":
+		return routeMapFormats[format].write(w, routes)
+	default:
+		return renderRoutes(w, format, routes, opts)
+	}
+}
+
+// writeLocations writes airports or geocoding results in the given output
+// format
+func writeLocations(w io.Writer, format string, locations []Location) error {
+	switch format {
+	case "json":
+		if locations == nil {
+			locations = []Location{}
+		}
+		return writeJSON(w, locations)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"name", "code", "type", "latitude", "longitude", "country"})
+		for _, loc := range locations {
+			cw.Write([]string{
+				loc.Name,
+				loc.Code,
+				loc.Type,
+				strconv.FormatFloat(loc.Latitude, 'f', 6, 64),
+				strconv.FormatFloat(loc.Longitude, 'f', 6, 64),
+				loc.Country,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tCODE\tTYPE\tLATITUDE\tLONGITUDE\tCOUNTRY")
+		for _, loc := range locations {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%.6f\t%.6f\t%s\n", loc.Name, loc.Code, loc.Type, loc.Latitude, loc.Longitude, loc.Country)
+		}
+		return tw.Flush()
+	}
+}
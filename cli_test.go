@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunConfigCommand(t *testing.T) {
+	t.Run("Print redacts secrets", func(t *testing.T) {
+		t.Setenv("GOOGLE_MAPS_API_KEY", "AIza-secret")
+		var stdout, stderr bytes.Buffer
+
+		code := runConfigCommand([]string{"print", "-max-airports", "3"}, &stdout, &stderr)
+
+		assert.Equal(t, 0, code, stderr.String())
+		assert.Contains(t, stdout.String(), "max_airports: 3")
+		assert.Contains(t, stdout.String(), "google_maps_api_key: REDACTED")
+		assert.NotContains(t, stdout.String(), "AIza-secret")
+	})
+
+	t.Run("Print shows an invalid config and fails", func(t *testing.T) {
+		t.Setenv("GOOGLE_MAPS_API_KEY", "")
+		var stdout, stderr bytes.Buffer
+
+		code := runConfigCommand([]string{"print", "-default-radius", "-5"}, &stdout, &stderr)
+
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stdout.String(), "default_radius: -5")
+		assert.Contains(t, stderr.String(), "default_radius must be positive")
+		assert.Contains(t, stderr.String(), "google_maps_api_key is required")
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		t.Setenv("GOOGLE_MAPS_API_KEY", "key")
+		var stdout, stderr bytes.Buffer
+
+		code := runConfigCommand([]string{"validate"}, &stdout, &stderr)
+
+		assert.Equal(t, 0, code, stderr.String())
+		assert.Equal(t, "configuration is valid\n", stdout.String())
+	})
+
+	t.Run("Unparsable value", func(t *testing.T) {
+		t.Setenv("MAX_AIRPORTS", "abc")
+		var stdout, stderr bytes.Buffer
+
+		code := runConfigCommand([]string{"validate"}, &stdout, &stderr)
+
+		assert.Equal(t, 1, code)
+		assert.Contains(t, stderr.String(), `MAX_AIRPORTS: invalid value "abc": expected an integer`)
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, runConfigCommand(nil, &stdout, &stderr))
+		assert.Contains(t, stderr.String(), "usage")
+	})
+}
+
+func TestRunSecretsCommand(t *testing.T) {
+	var key, stderr bytes.Buffer
+	require.Equal(t, 0, runSecretsCommand([]string{"keygen"}, nil, &key, &stderr))
+	t.Setenv("SECRETS_KEY", key.String())
+
+	var sealed bytes.Buffer
+	stdin := strings.NewReader(`{"google_maps_api_key": "AIza-cli"}`)
+	code := runSecretsCommand([]string{"encrypt"}, stdin, &sealed, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.NotContains(t, sealed.String(), "AIza-cli")
+
+	aesKey, err := parseSecretsKey(key.String())
+	require.NoError(t, err)
+	secrets, err := decryptSecrets(aesKey, sealed.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, "AIza-cli", secrets["google_maps_api_key"])
+
+	assert.Equal(t, 2, runSecretsCommand(nil, nil, &sealed, &stderr))
+}
+
+// newStubSearchFinder returns a TravelFinder whose Google calls are answered
+// locally: Granada and Tel Aviv geocode, Madrid-Barajas is the airport near
+// Granada, Ben Gurion the one near Tel Aviv, and Directions finds nothing so
+// ground legs are taxi estimates
+func newStubSearchFinder(t *testing.T) *TravelFinder {
+	config := DefaultConfig()
+	config.GoogleMapsAPIKey = "test-key"
+	tf := NewTravelFinder(config)
+
+	google := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case "/geocode/json":
+			coords := map[string]string{"Granada": "37.1773, -3.5986", "Tel Aviv": "32.0853, 34.7818"}[query.Get("address")]
+			if coords == "" {
+				fmt.Fprint(w, `{"results": [], "status": "ZERO_RESULTS"}`)
+				return
+			}
+			lat, lng, _ := strings.Cut(coords, ", ")
+			fmt.Fprintf(w, `{"status": "OK", "results": [{"geometry": {"location": {"lat": %s, "lng": %s}},
+				"address_components": [{"long_name": "Somewhere", "types": ["country"]}]}]}`, lat, lng)
+		case "/place/nearbysearch/json":
+			airport := `{"name": "Adolfo Suárez Madrid-Barajas Airport (MAD)", "place_id": "mad", "geometry": {"location": {"lat": 40.4983, "lng": -3.5676}}}`
+			if strings.HasPrefix(query.Get("location"), "32.") {
+				airport = `{"name": "Ben Gurion Airport (TLV)", "place_id": "tlv", "geometry": {"location": {"lat": 32.0055, "lng": 34.8854}}}`
+			}
+			fmt.Fprintf(w, `{"status": "OK", "results": [%s]}`, airport)
+		case "/timezone/json":
+			zone := "Europe/Madrid"
+			if strings.HasPrefix(query.Get("location"), "32.") {
+				zone = "Asia/Jerusalem"
+			}
+			fmt.Fprintf(w, `{"status": "OK", "timeZoneId": %q}`, zone)
+		default:
+			fmt.Fprint(w, `{"routes": [], "status": "ZERO_RESULTS"}`)
+		}
+	}))
+	t.Cleanup(google.Close)
+	tf.google.baseURL = google.URL
+	return tf
+}
+
+func TestParseQueryCommand(t *testing.T) {
+	var stderr bytes.Buffer
+
+	q, configFlags, err := parseQueryCommand("search", []string{
+		"-origin", "Granada", "-destination", "Tel Aviv", "-date", "2024-07-01",
+		"-format", "csv", "-max-price", "300", "-modes", "flight, taxi", "-max-airports", "2",
+	}, &stderr)
+	require.NoError(t, err)
+	assert.Equal(t, "Granada", q.origin)
+	assert.Equal(t, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC), q.date)
+	assert.Equal(t, "csv", q.format)
+	assert.Equal(t, routeFilter{MaxPrice: 300, Modes: []string{"flight", "taxi"}}, q.filter)
+	assert.Equal(t, []string{"MAX_AIRPORTS"}, configFlags.order)
+
+	for _, tc := range []struct {
+		name, command string
+		args          []string
+		expected      string
+	}{
+		{"Missing destination", "search", []string{"-origin", "Granada"}, "-origin and -destination are required"},
+		{"Bad date", "search", []string{"-origin", "A", "-destination", "B", "-date", "01/07/2024"}, "invalid -date"},
+		{"Bad format", "geocode", []string{"-location", "A", "-format", "xml"}, "-format must be one of table, json, csv"},
+		{"Route format for airports", "airports", []string{"-location", "A", "-format", "timeline"}, "-format must be one of table, json, csv"},
+		{"Bad color", "search", []string{"-origin", "A", "-destination", "B", "-color", "yes"}, "-color must be auto, always or never"},
+		{"Bad sort", "search", []string{"-origin", "A", "-destination", "B", "-sort", "stops"}, "-sort must be price, duration or co2"},
+		{"Bad vehicle", "search", []string{"-origin", "A", "-destination", "B", "-vehicle", "tank"}, "-vehicle must be car, motorcycle, van or bicycle"},
+		{"Bad ICS route", "search", []string{"-origin", "A", "-destination", "B", "-ics-route", "0"}, "-ics-route must be at least 1"},
+		{"Missing location", "airports", nil, "-location is required"},
+		{"Stray argument", "geocode", []string{"-location", "A", "B"}, "unexpected arguments: B"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := parseQueryCommand(tc.command, tc.args, &stderr)
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+}
+
+func TestRunQueryCommand_UsageError(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, runQueryCommand("search", []string{"-origin", "Granada"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "travel-routes search: -origin and -destination are required")
+	assert.Empty(t, stdout.String())
+}
+
+func TestQueryCommand_Search(t *testing.T) {
+	tf := newStubSearchFinder(t)
+	search := func(format string, filter routeFilter, limit int) string {
+		q := &queryCommand{name: "search", origin: "Granada", destination: "Tel Aviv",
+			date: time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC), format: format, filter: filter, limit: limit}
+		var out bytes.Buffer
+		require.NoError(t, q.run(context.Background(), tf, &out))
+		return out.String()
+	}
+
+	t.Run("Table", func(t *testing.T) {
+		out := search("table", routeFilter{}, 0)
+		assert.Contains(t, out, "1  taxi → flight           2024-07-01 08:00")
+		assert.Equal(t, 5, strings.Count(out, "\n"))
+	})
+
+	t.Run("Text", func(t *testing.T) {
+		out := search("text", routeFilter{}, 0)
+		assert.Contains(t, out, "Found 4 routes:")
+		assert.Contains(t, out, "Segment 1: taxi from Granada to Adolfo Suárez Madrid-Barajas Airport (MAD)")
+	})
+
+	t.Run("Sorted by CO2", func(t *testing.T) {
+		q := &queryCommand{name: "search", origin: "Granada", destination: "Tel Aviv",
+			date: time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC), format: "json", sortBy: "co2"}
+		var out bytes.Buffer
+		require.NoError(t, q.run(context.Background(), tf, &out))
+
+		var routes []Route
+		require.NoError(t, json.Unmarshal(out.Bytes(), &routes))
+		require.Len(t, routes, 4)
+		assert.Equal(t, "taxi (Taxi) → flight (Airlines)", routes[0].Description, "the direct flight emits least")
+		for i := 1; i < len(routes); i++ {
+			assert.LessOrEqual(t, routes[i-1].TotalCO2, routes[i].TotalCO2)
+		}
+	})
+
+	t.Run("JSON with limit", func(t *testing.T) {
+		var routes []Route
+		require.NoError(t, json.Unmarshal([]byte(search("json", routeFilter{}, 2)), &routes))
+		assert.Len(t, routes, 2)
+		assert.LessOrEqual(t, routes[0].TotalPrice, routes[1].TotalPrice)
+	})
+
+	t.Run("CSV with filters", func(t *testing.T) {
+		rows, err := csv.NewReader(strings.NewReader(search("csv", routeFilter{MaxSegments: 2}, 0))).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, rows, 2, "only the direct flight has two segments")
+		assert.Equal(t, []string{"route", "description", "departure", "arrival", "duration_minutes", "total_price", "currency", "segments", "co2_kg"}, rows[0])
+		assert.Equal(t, "taxi (Taxi) → flight (Airlines)", rows[1][1])
+		assert.Equal(t, "2", rows[1][7])
+	})
+
+	t.Run("Nothing left after filtering", func(t *testing.T) {
+		assert.Equal(t, "[]\n", search("json", routeFilter{Modes: []string{"train"}}, 0))
+	})
+
+	t.Run("ICS export", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "trip.ics")
+		q := &queryCommand{name: "search", origin: "Granada", destination: "Tel Aviv",
+			date: time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC), format: "compact", icsPath: path, icsRoute: 1}
+		var out bytes.Buffer
+		require.NoError(t, q.run(context.Background(), tf, &out))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, 2, strings.Count(string(data), "BEGIN:VEVENT"))
+		assert.Contains(t, string(data), "SUMMARY:Flight MAD → TLV")
+		assert.Empty(t, tf.searches.searches, "the UID doesn't come from a stored search")
+
+		q.icsRoute = 9
+		assert.EqualError(t, q.run(context.Background(), tf, &out), "-ics-route 9: the search found 4 routes")
+	})
+}
+
+func TestQueryCommand_AirportsAndGeocode(t *testing.T) {
+	tf := newStubSearchFinder(t)
+
+	var out bytes.Buffer
+	q := &queryCommand{name: "airports", location: "Granada", format: "table"}
+	require.NoError(t, q.run(context.Background(), tf, &out))
+	assert.Equal(t, "NAME                                        CODE  TYPE     LATITUDE   LONGITUDE  COUNTRY\n"+
+		"Adolfo Suárez Madrid-Barajas Airport (MAD)  MAD   airport  40.498300  -3.567600  \n", out.String())
+
+	out.Reset()
+	q = &queryCommand{name: "geocode", location: "Tel Aviv", format: "csv"}
+	require.NoError(t, q.run(context.Background(), tf, &out))
+	assert.Equal(t, "name,code,type,latitude,longitude,country\nTel Aviv,,city,32.085300,34.781800,Somewhere\n", out.String())
+
+	q = &queryCommand{name: "geocode", location: "Atlantis", format: "json"}
+	assert.ErrorIs(t, q.run(context.Background(), tf, &out), ErrGeocodeNotFound)
+}
+
+func TestRouteFilter(t *testing.T) {
+	cheap := Route{TotalPrice: 50, TotalTime: time.Hour, Segments: []TransportOption{{Mode: "taxi"}}}
+	slow := Route{TotalPrice: 80, TotalTime: 20 * time.Hour, Segments: []TransportOption{{Mode: "taxi"}, {Mode: "flight"}}}
+	routes := []Route{cheap, slow}
+
+	assert.Equal(t, routes, routeFilter{}.Apply(routes))
+	assert.Equal(t, []Route{cheap}, routeFilter{MaxPrice: 60}.Apply(routes))
+	assert.Equal(t, []Route{cheap}, routeFilter{MaxDuration: 12 * time.Hour}.Apply(routes))
+	assert.Equal(t, []Route{cheap}, routeFilter{MaxSegments: 1}.Apply(routes))
+	assert.Equal(t, []Route{cheap}, routeFilter{Modes: []string{"taxi"}}.Apply(routes))
+	assert.Nil(t, routeFilter{MaxPrice: 1}.Apply(routes))
+}
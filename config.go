@@ -1,47 +1,595 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
+// Config holds every setting of the service. It is loaded in layers, each
+// overriding the previous one: built-in defaults, the YAML config file,
+// environment variables and finally command-line flags. File keys are the
+// lower-case environment variable names (max_airports for MAX_AIRPORTS) and
+// flags use dashes (-max-airports). Durations are written as "500ms", "10s".
 type Config struct {
-	GoogleMapsAPIKey string
-	AmadeusAPIKey    string
-	AmadeusSecret    string
-	DefaultRadius    int
-	MaxAirports      int
-	MaxDistance      float64
+	GoogleMapsAPIKey string  `yaml:"google_maps_api_key"`
+	AmadeusAPIKey    string  `yaml:"amadeus_api_key"`
+	AmadeusSecret    string  `yaml:"amadeus_secret"`
+	DefaultRadius    int     `yaml:"default_radius"` // meters
+	MaxAirports      int     `yaml:"max_airports"`
+	MaxDistance      float64 `yaml:"max_distance"` // km
+
+	// At most AirportConcurrency origin airports are searched at once
+	AirportConcurrency int `yaml:"airport_concurrency"`
+
+	// Ground leg paths from Directions are simplified so no point of the
+	// original line is further than PathTolerance meters from the result
+	// (0 = keep every point)
+	PathTolerance float64 `yaml:"path_tolerance"`
+
+	// Cabin class assumed for flights when estimating emissions: economy,
+	// premium_economy, business or first
+	CabinClass string `yaml:"cabin_class"`
+
+	// Rail search reads the GTFS timetable (a directory or .zip) at
+	// RailGTFSPath, empty to search flights only. Stations within
+	// StationRadius meters of a place serve it.
+	RailGTFSPath  string `yaml:"rail_gtfs_path"`
+	StationRadius int    `yaml:"station_radius"`
+
+	// Coach search reads the GTFS timetable at BusGTFSPath, empty to leave
+	// coaches out. Bus stations also serve places within StationRadius.
+	BusGTFSPath string `yaml:"bus_gtfs_path"`
+
+	// Ferry search reads the GTFS timetable at FerryGTFSPath, with the
+	// vehicle_fares.txt extension for vehicles on board, empty to leave
+	// ferries out. Ports also serve places within StationRadius; ports
+	// within PortRadius meters of the destination airport are searched for
+	// a crossing after landing.
+	FerryGTFSPath string `yaml:"ferry_gtfs_path"`
+	PortRadius    int    `yaml:"port_radius"`
+
+	// Public transport to the airport is planned in the GTFS timetable at
+	// TransitGTFSPath before asking Google Directions, empty to always ask
+	TransitGTFSPath string `yaml:"transit_gtfs_path"`
+
+	// Outbound HTTP resilience
+	UpstreamTimeout  time.Duration `yaml:"upstream_timeout"` // per attempt
+	RetryMaxAttempts int           `yaml:"retry_max_attempts"`
+	RetryBaseDelay   time.Duration `yaml:"retry_base_delay"`
+	RetryMaxDelay    time.Duration `yaml:"retry_max_delay"`
+	BreakerThreshold int           `yaml:"breaker_threshold"` // consecutive failures before a host's breaker opens
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`
+
+	// Google API rate limits (requests per second, 0 = unlimited) and the
+	// daily call budget shared by all Google APIs (0 = unlimited). Once no
+	// more than GoogleBudgetReserve calls are left, Directions is skipped.
+	GeocodeRateLimit    float64 `yaml:"geocode_rate_limit"`
+	PlacesRateLimit     float64 `yaml:"places_rate_limit"`
+	DirectionsRateLimit float64 `yaml:"directions_rate_limit"`
+	GoogleDailyBudget   int     `yaml:"google_daily_budget"`
+	GoogleBudgetReserve int     `yaml:"google_budget_reserve"`
+
+	// Inbound authentication. Auth is enabled when APIKeysFile is set; the
+	// admin endpoints need AdminToken and /metrics needs MetricsToken. New
+	// keys get the default limits.
+	APIKeysFile            string  `yaml:"api_keys_file"`
+	AdminToken             string  `yaml:"admin_token"`
+	MetricsToken           string  `yaml:"metrics_token"`
+	DefaultKeyRateLimit    float64 `yaml:"key_rate_limit"`
+	DefaultKeyMonthlyQuota int     `yaml:"key_monthly_quota"`
+
+	// HTTP server. WriteTimeout is cleared for streamed search responses.
+	Port               string        `yaml:"port"`
+	ReadTimeout        time.Duration `yaml:"read_timeout"`
+	WriteTimeout       time.Duration `yaml:"write_timeout"`
+	IdleTimeout        time.Duration `yaml:"idle_timeout"`
+	RequestTimeout     time.Duration `yaml:"request_timeout"`
+	ShutdownTimeout    time.Duration `yaml:"shutdown_timeout"`
+	CORSAllowedOrigins []string      `yaml:"cors_allowed_origins"`
+
+	// Search results are kept for SearchResultTTL so routes can be exported
+	// by search ID; at most SearchResultLimit searches are kept
+	SearchResultTTL   time.Duration `yaml:"search_result_ttl"`
+	SearchResultLimit int           `yaml:"search_result_limit"`
+
+	// Readiness checks: each check gets HealthCheckTimeout, and a passing
+	// Google probe is reused for HealthProbeInterval
+	HealthCheckTimeout  time.Duration `yaml:"health_check_timeout"`
+	HealthProbeInterval time.Duration `yaml:"health_probe_interval"`
+
+	// Tracing: TracingExporter is "stdout", "otlp" or "none"; a fraction
+	// TracingSampleRatio of new traces is recorded
+	TracingExporter    string  `yaml:"tracing_exporter"`
+	TracingSampleRatio float64 `yaml:"tracing_sample_ratio"`
+
+	// Logging: LogLevel is debug, info, warn or error; LogFormat is text or json
+	LogLevel  string `yaml:"log_level"`
+	LogFormat string `yaml:"log_format"`
+
+	// How often the config file is checked for changes to reload (0 = only
+	// reload on SIGHUP)
+	ConfigWatchInterval time.Duration `yaml:"config_watch_interval"`
+
+	// Secrets backend: "env" (environment and *_FILE only), "file" (the
+	// AES-GCM encrypted SecretsFile, opened with SecretsKey) or "vault" (a
+	// KV secret at VaultPath). Secrets are re-read every
+	// SecretsRefreshInterval (0 = only on reload).
+	SecretsBackend         string        `yaml:"secrets_backend"`
+	SecretsFile            string        `yaml:"secrets_file"`
+	SecretsKey             string        `yaml:"secrets_key"`
+	VaultAddr              string        `yaml:"vault_addr"`
+	VaultToken             string        `yaml:"vault_token"`
+	VaultPath              string        `yaml:"vault_path"`
+	SecretsRefreshInterval time.Duration `yaml:"secrets_refresh_interval"`
+}
+
+// DefaultConfig returns the built-in defaults
+func DefaultConfig() Config {
+	return Config{
+		DefaultRadius:    300000,
+		MaxAirports:      10,
+		MaxDistance:      500.0,
+		PathTolerance:    10,
+		CabinClass:       "economy",
+		StationRadius:    10000,
+		PortRadius:       50000,
+		UpstreamTimeout:  10 * time.Second,
+		RetryMaxAttempts: 3,
+		RetryBaseDelay:   200 * time.Millisecond,
+		RetryMaxDelay:    5 * time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+
+		AirportConcurrency: 4,
+
+		GeocodeRateLimit:    10,
+		PlacesRateLimit:     10,
+		DirectionsRateLimit: 10,
+
+		DefaultKeyRateLimit:    5,
+		DefaultKeyMonthlyQuota: 10000,
+
+		Port:               "8080",
+		ReadTimeout:        15 * time.Second,
+		WriteTimeout:       90 * time.Second,
+		IdleTimeout:        120 * time.Second,
+		RequestTimeout:     60 * time.Second,
+		ShutdownTimeout:    30 * time.Second,
+		CORSAllowedOrigins: []string{}, // browsers are refused until origins are listed
+
+		SearchResultTTL:   time.Hour,
+		SearchResultLimit: 1000,
+
+		HealthCheckTimeout:  5 * time.Second,
+		HealthProbeInterval: 5 * time.Minute,
+
+		TracingExporter:    "none",
+		TracingSampleRatio: 1.0,
+
+		LogLevel:  "info",
+		LogFormat: "text",
+
+		ConfigWatchInterval: 5 * time.Second,
+
+		SecretsBackend:         "env",
+		SecretsRefreshInterval: 5 * time.Minute,
+	}
+}
+
+// configField ties a Config field to its environment variable, from which
+// the file key and flag name are derived. Reloadable fields take effect on
+// a config reload; the rest need a restart. Secrets can also be read from
+// the file named by <env>_FILE or from the secrets backend.
+type configField struct {
+	env        string
+	ptr        any // *string, *int, *float64, *time.Duration or *[]string
+	secret     bool
+	reloadable bool
+}
+
+// key is the field's name in the config file
+func (f configField) key() string {
+	return strings.ToLower(f.env)
+}
+
+// flagName is the field's command-line flag
+func (f configField) flagName() string {
+	return strings.ReplaceAll(f.key(), "_", "-")
 }
 
-func LoadConfig() Config {
-	defaultRadius := 300000
-	if val := os.Getenv("DEFAULT_RADIUS"); val != "" {
-		if v, err := strconv.Atoi(val); err == nil {
-			defaultRadius = v
+// fields lists every setting with a pointer into c
+func (c *Config) fields() []configField {
+	return []configField{
+		{env: "GOOGLE_MAPS_API_KEY", ptr: &c.GoogleMapsAPIKey, secret: true, reloadable: true},
+		{env: "AMADEUS_API_KEY", ptr: &c.AmadeusAPIKey, secret: true, reloadable: true},
+		{env: "AMADEUS_SECRET", ptr: &c.AmadeusSecret, secret: true, reloadable: true},
+		{env: "DEFAULT_RADIUS", ptr: &c.DefaultRadius, reloadable: true},
+		{env: "MAX_AIRPORTS", ptr: &c.MaxAirports, reloadable: true},
+		{env: "MAX_DISTANCE", ptr: &c.MaxDistance, reloadable: true},
+		{env: "AIRPORT_CONCURRENCY", ptr: &c.AirportConcurrency, reloadable: true},
+		{env: "PATH_TOLERANCE", ptr: &c.PathTolerance, reloadable: true},
+		{env: "CABIN_CLASS", ptr: &c.CabinClass, reloadable: true},
+		{env: "RAIL_GTFS_PATH", ptr: &c.RailGTFSPath},
+		{env: "STATION_RADIUS", ptr: &c.StationRadius, reloadable: true},
+		{env: "BUS_GTFS_PATH", ptr: &c.BusGTFSPath},
+		{env: "FERRY_GTFS_PATH", ptr: &c.FerryGTFSPath},
+		{env: "PORT_RADIUS", ptr: &c.PortRadius, reloadable: true},
+		{env: "TRANSIT_GTFS_PATH", ptr: &c.TransitGTFSPath},
+		{env: "UPSTREAM_TIMEOUT", ptr: &c.UpstreamTimeout},
+		{env: "RETRY_MAX_ATTEMPTS", ptr: &c.RetryMaxAttempts},
+		{env: "RETRY_BASE_DELAY", ptr: &c.RetryBaseDelay},
+		{env: "RETRY_MAX_DELAY", ptr: &c.RetryMaxDelay},
+		{env: "BREAKER_THRESHOLD", ptr: &c.BreakerThreshold},
+		{env: "BREAKER_COOLDOWN", ptr: &c.BreakerCooldown},
+		{env: "GEOCODE_RATE_LIMIT", ptr: &c.GeocodeRateLimit},
+		{env: "PLACES_RATE_LIMIT", ptr: &c.PlacesRateLimit},
+		{env: "DIRECTIONS_RATE_LIMIT", ptr: &c.DirectionsRateLimit},
+		{env: "GOOGLE_DAILY_BUDGET", ptr: &c.GoogleDailyBudget},
+		{env: "GOOGLE_BUDGET_RESERVE", ptr: &c.GoogleBudgetReserve},
+		{env: "API_KEYS_FILE", ptr: &c.APIKeysFile},
+		{env: "ADMIN_TOKEN", ptr: &c.AdminToken, secret: true},
+		{env: "METRICS_TOKEN", ptr: &c.MetricsToken, secret: true},
+		{env: "KEY_RATE_LIMIT", ptr: &c.DefaultKeyRateLimit},
+		{env: "KEY_MONTHLY_QUOTA", ptr: &c.DefaultKeyMonthlyQuota},
+		{env: "PORT", ptr: &c.Port},
+		{env: "READ_TIMEOUT", ptr: &c.ReadTimeout},
+		{env: "WRITE_TIMEOUT", ptr: &c.WriteTimeout},
+		{env: "IDLE_TIMEOUT", ptr: &c.IdleTimeout},
+		{env: "REQUEST_TIMEOUT", ptr: &c.RequestTimeout},
+		{env: "SHUTDOWN_TIMEOUT", ptr: &c.ShutdownTimeout},
+		{env: "CORS_ALLOWED_ORIGINS", ptr: &c.CORSAllowedOrigins},
+		{env: "SEARCH_RESULT_TTL", ptr: &c.SearchResultTTL},
+		{env: "SEARCH_RESULT_LIMIT", ptr: &c.SearchResultLimit},
+		{env: "HEALTH_CHECK_TIMEOUT", ptr: &c.HealthCheckTimeout},
+		{env: "HEALTH_PROBE_INTERVAL", ptr: &c.HealthProbeInterval},
+		{env: "TRACING_EXPORTER", ptr: &c.TracingExporter},
+		{env: "TRACING_SAMPLE_RATIO", ptr: &c.TracingSampleRatio},
+		{env: "LOG_LEVEL", ptr: &c.LogLevel},
+		{env: "LOG_FORMAT", ptr: &c.LogFormat},
+		{env: "CONFIG_WATCH_INTERVAL", ptr: &c.ConfigWatchInterval},
+		{env: "SECRETS_BACKEND", ptr: &c.SecretsBackend, reloadable: true},
+		{env: "SECRETS_FILE", ptr: &c.SecretsFile, reloadable: true},
+		{env: "SECRETS_KEY", ptr: &c.SecretsKey, secret: true, reloadable: true},
+		{env: "VAULT_ADDR", ptr: &c.VaultAddr, reloadable: true},
+		{env: "VAULT_TOKEN", ptr: &c.VaultToken, secret: true, reloadable: true},
+		{env: "VAULT_PATH", ptr: &c.VaultPath, reloadable: true},
+		{env: "SECRETS_REFRESH_INTERVAL", ptr: &c.SecretsRefreshInterval},
+	}
+}
+
+// set parses val into the field, rejecting anything that doesn't parse
+// rather than falling back to a default
+func (f configField) set(val string) error {
+	val = strings.TrimSpace(val)
+
+	switch p := f.ptr.(type) {
+	case *string:
+		*p = val
+	case *int:
+		v, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("invalid value %q: expected an integer", val)
 		}
+		*p = v
+	case *float64:
+		v, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return fmt.Errorf("invalid value %q: expected a number", val)
+		}
+		*p = v
+	case *time.Duration:
+		v, err := time.ParseDuration(val)
+		if err != nil {
+			return fmt.Errorf("invalid value %q: expected a duration such as 500ms or 10s", val)
+		}
+		*p = v
+	case *[]string:
+		var list []string
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*p = list
+	default:
+		return fmt.Errorf("unsupported config field type %T", f.ptr)
 	}
+	return nil
+}
+
+// assign copies the value of the same field from another Config
+func (f configField) assign(src configField) {
+	switch p := f.ptr.(type) {
+	case *string:
+		*p = *src.ptr.(*string)
+	case *int:
+		*p = *src.ptr.(*int)
+	case *float64:
+		*p = *src.ptr.(*float64)
+	case *time.Duration:
+		*p = *src.ptr.(*time.Duration)
+	case *[]string:
+		*p = append([]string(nil), *src.ptr.(*[]string)...)
+	}
+}
 
-	maxAirports := 10
-	if val := os.Getenv("MAX_AIRPORTS"); val != "" {
-		if v, err := strconv.Atoi(val); err == nil {
-			maxAirports = v
+// ConfigFlags holds the config file path and the setting overrides given on
+// the command line
+type ConfigFlags struct {
+	File string
+
+	overrides map[string]string // env name → raw value
+	order     []string
+}
+
+// RegisterConfigFlags adds -config and one flag per non-secret setting to
+// fs. Secrets can't be passed as flags, which would expose them in the
+// process list.
+func RegisterConfigFlags(fs *flag.FlagSet) *ConfigFlags {
+	cf := &ConfigFlags{overrides: make(map[string]string)}
+	fs.StringVar(&cf.File, "config", "", "path to a YAML config file (default $CONFIG_FILE)")
+
+	defaults := DefaultConfig()
+	for _, f := range defaults.fields() {
+		if f.secret {
+			continue
 		}
+		env := f.env
+		usage := fmt.Sprintf("overrides %s (default %s)", env, formatConfigValue(f.ptr))
+		fs.Func(f.flagName(), usage, func(val string) error {
+			if _, seen := cf.overrides[env]; !seen {
+				cf.order = append(cf.order, env)
+			}
+			cf.overrides[env] = val
+			return nil
+		})
 	}
 
-	maxDistance := 500.0
-	if val := os.Getenv("MAX_DISTANCE"); val != "" {
-		if v, err := strconv.ParseFloat(val, 64); err == nil {
-			maxDistance = v
+	return cf
+}
+
+// LoadConfig loads the configuration from the defaults, the file named by
+// $CONFIG_FILE and the environment. Every value that fails to parse is
+// reported; call Validate to check that the result makes sense.
+func LoadConfig() (Config, error) {
+	return (*ConfigFlags)(nil).Load()
+}
+
+// Path returns the config file to load: the -config flag or $CONFIG_FILE
+func (cf *ConfigFlags) Path() string {
+	if cf != nil && cf.File != "" {
+		return cf.File
+	}
+	return os.Getenv("CONFIG_FILE")
+}
+
+// Load layers defaults, config file, environment and the flags given on the
+// command line. A nil *ConfigFlags loads without flags.
+func (cf *ConfigFlags) Load() (Config, error) {
+	config := DefaultConfig()
+
+	if path := cf.Path(); path != "" {
+		if err := config.loadFile(path); err != nil {
+			return Config{}, err
 		}
 	}
 
-	return Config{
-		GoogleMapsAPIKey: os.Getenv("GOOGLE_MAPS_API_KEY"),
-		AmadeusAPIKey:    os.Getenv("AMADEUS_API_KEY"),
-		AmadeusSecret:    os.Getenv("AMADEUS_SECRET"),
-		DefaultRadius:    defaultRadius,
-		MaxAirports:      maxAirports,
-		MaxDistance:      maxDistance,
+	var errs []error
+	fields := config.fields()
+	for _, f := range fields {
+		val, ok := os.LookupEnv(f.env)
+		if f.secret {
+			fileVal, fileOK, err := readSecretFile(f.env)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if fileOK && ok && strings.TrimSpace(val) != "" {
+				errs = append(errs, fmt.Errorf("%s and %s_FILE are both set; use one", f.env, f.env))
+				continue
+			}
+			if fileOK {
+				val, ok = fileVal, true
+			}
+		}
+		if !ok || strings.TrimSpace(val) == "" {
+			continue
+		}
+		if err := f.set(val); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.env, err))
+		}
+	}
+
+	if cf != nil {
+		byEnv := make(map[string]configField, len(fields))
+		for _, f := range fields {
+			byEnv[f.env] = f
+		}
+		for _, env := range cf.order {
+			f := byEnv[env]
+			if err := f.set(cf.overrides[env]); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", f.flagName(), err))
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return config, nil
+}
+
+// loadFile overlays the settings present in a YAML file. Unknown keys are
+// rejected so typos don't go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks the configuration for values the service can't run with
+// and reports all of them at once
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.GoogleMapsAPIKey != "", "google_maps_api_key is required")
+	check(c.AmadeusAPIKey == "" || c.AmadeusSecret != "", "amadeus_secret is required when amadeus_api_key is set")
+	check(c.AmadeusSecret == "" || c.AmadeusAPIKey != "", "amadeus_api_key is required when amadeus_secret is set")
+
+	check(c.DefaultRadius > 0, "default_radius must be positive, got %d", c.DefaultRadius)
+	check(c.MaxAirports > 0, "max_airports must be positive, got %d", c.MaxAirports)
+	check(c.MaxDistance > 0, "max_distance must be positive, got %g", c.MaxDistance)
+	check(c.AirportConcurrency > 0, "airport_concurrency must be positive, got %d", c.AirportConcurrency)
+	check(c.PathTolerance >= 0, "path_tolerance must not be negative, got %g", c.PathTolerance)
+	check(slices.Contains(cabinClasses, c.CabinClass), "cabin_class must be economy, premium_economy, business or first, got %q", c.CabinClass)
+	check(c.StationRadius > 0, "station_radius must be positive, got %d", c.StationRadius)
+	check(c.PortRadius > 0, "port_radius must be positive, got %d", c.PortRadius)
+
+	check(c.UpstreamTimeout > 0, "upstream_timeout must be positive, got %s", c.UpstreamTimeout)
+	check(c.RetryMaxAttempts >= 1, "retry_max_attempts must be at least 1, got %d", c.RetryMaxAttempts)
+	check(c.RetryBaseDelay >= 0, "retry_base_delay must not be negative, got %s", c.RetryBaseDelay)
+	check(c.RetryMaxDelay >= c.RetryBaseDelay, "retry_max_delay (%s) must not be less than retry_base_delay (%s)", c.RetryMaxDelay, c.RetryBaseDelay)
+	check(c.BreakerThreshold >= 0, "breaker_threshold must not be negative, got %d", c.BreakerThreshold)
+	check(c.BreakerCooldown >= 0, "breaker_cooldown must not be negative, got %s", c.BreakerCooldown)
+
+	check(c.GeocodeRateLimit >= 0, "geocode_rate_limit must not be negative, got %g", c.GeocodeRateLimit)
+	check(c.PlacesRateLimit >= 0, "places_rate_limit must not be negative, got %g", c.PlacesRateLimit)
+	check(c.DirectionsRateLimit >= 0, "directions_rate_limit must not be negative, got %g", c.DirectionsRateLimit)
+	check(c.GoogleDailyBudget >= 0, "google_daily_budget must not be negative, got %d", c.GoogleDailyBudget)
+	check(c.GoogleBudgetReserve >= 0, "google_budget_reserve must not be negative, got %d", c.GoogleBudgetReserve)
+	check(c.GoogleDailyBudget == 0 || c.GoogleBudgetReserve < c.GoogleDailyBudget,
+		"google_budget_reserve (%d) must be less than google_daily_budget (%d)", c.GoogleBudgetReserve, c.GoogleDailyBudget)
+
+	check(c.DefaultKeyRateLimit >= 0, "key_rate_limit must not be negative, got %g", c.DefaultKeyRateLimit)
+	check(c.DefaultKeyMonthlyQuota >= 0, "key_monthly_quota must not be negative, got %d", c.DefaultKeyMonthlyQuota)
+
+	check(c.SearchResultTTL > 0, "search_result_ttl must be positive, got %s", c.SearchResultTTL)
+	check(c.SearchResultLimit > 0, "search_result_limit must be positive, got %d", c.SearchResultLimit)
+
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port >= 1 && port <= 65535, "port must be a number between 1 and 65535, got %q", c.Port)
+	for _, timeout := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"read_timeout", c.ReadTimeout},
+		{"write_timeout", c.WriteTimeout},
+		{"idle_timeout", c.IdleTimeout},
+		{"request_timeout", c.RequestTimeout},
+		{"shutdown_timeout", c.ShutdownTimeout},
+		{"health_check_timeout", c.HealthCheckTimeout},
+		{"health_probe_interval", c.HealthProbeInterval},
+		{"config_watch_interval", c.ConfigWatchInterval},
+		{"secrets_refresh_interval", c.SecretsRefreshInterval},
+	} {
+		check(timeout.value >= 0, "%s must not be negative, got %s", timeout.key, timeout.value)
+	}
+
+	switch c.TracingExporter {
+	case "", "none", "stdout", "otlp":
+	default:
+		errs = append(errs, fmt.Errorf("tracing_exporter must be stdout, otlp or none, got %q", c.TracingExporter))
+	}
+	check(c.TracingSampleRatio >= 0 && c.TracingSampleRatio <= 1, "tracing_sample_ratio must be between 0 and 1, got %g", c.TracingSampleRatio)
+
+	if err := c.validateSecretsBackend(); err != nil {
+		errs = append(errs, err)
+	}
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "log_level must be debug, info, warn or error, got %q", c.LogLevel)
+	switch strings.ToLower(c.LogFormat) {
+	case "", "text", "json":
+	default:
+		errs = append(errs, fmt.Errorf("log_format must be text or json, got %q", c.LogFormat))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateSecretsBackend checks the settings the secrets backend needs
+func (c Config) validateSecretsBackend() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	switch c.SecretsBackend {
+	case "", "env":
+	case "file":
+		check(c.SecretsFile != "", "secrets_file is required when secrets_backend is file")
+		_, err := parseSecretsKey(c.SecretsKey)
+		check(err == nil, "secrets_key: %v", err)
+	case "vault":
+		check(c.VaultAddr != "", "vault_addr is required when secrets_backend is vault")
+		check(c.VaultToken != "", "vault_token is required when secrets_backend is vault")
+		check(c.VaultPath != "", "vault_path is required when secrets_backend is vault")
+	default:
+		errs = append(errs, fmt.Errorf("secrets_backend must be env, file or vault, got %q", c.SecretsBackend))
+	}
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy with every secret replaced, safe to print or log
+func (c Config) Redacted() Config {
+	c.CORSAllowedOrigins = append([]string(nil), c.CORSAllowedOrigins...)
+	for _, f := range c.fields() {
+		if p, ok := f.ptr.(*string); ok && f.secret && *p != "" {
+			*p = "REDACTED"
+		}
+	}
+	return c
+}
+
+// WriteYAML writes the configuration, secrets redacted, in config file format
+func (c Config) WriteYAML(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// formatConfigValue renders a default value for flag help
+func formatConfigValue(ptr any) string {
+	switch p := ptr.(type) {
+	case *string:
+		return strconv.Quote(*p)
+	case *int:
+		return strconv.Itoa(*p)
+	case *float64:
+		return strconv.FormatFloat(*p, 'g', -1, 64)
+	case *time.Duration:
+		return p.String()
+	case *[]string:
+		return strconv.Quote(strings.Join(*p, ","))
 	}
+	return ""
 }
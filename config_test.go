@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"flag"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -31,7 +36,8 @@ func TestLoadConfig(t *testing.T) {
 		os.Setenv("GOOGLE_MAPS_API_KEY", "test-api-key-123")
 		os.Setenv("DEFAULT_RADIUS", "500")
 
-		config := LoadConfig()
+		config, err := LoadConfig()
+		require.NoError(t, err)
 
 		assert.Equal(t, "test-api-key-123", config.GoogleMapsAPIKey)
 		assert.Equal(t, 500, config.DefaultRadius)
@@ -42,7 +48,8 @@ func TestLoadConfig(t *testing.T) {
 		os.Unsetenv("GOOGLE_MAPS_API_KEY")
 		os.Unsetenv("DEFAULT_RADIUS")
 
-		config := LoadConfig()
+		config, err := LoadConfig()
+		require.NoError(t, err)
 
 		assert.Equal(t, "", config.GoogleMapsAPIKey)
 		assert.Equal(t, 300000, config.DefaultRadius) // Default 300km in meters
@@ -53,10 +60,10 @@ func TestLoadConfig(t *testing.T) {
 		os.Setenv("DEFAULT_RADIUS", "invalid-number")
 		os.Unsetenv("GOOGLE_MAPS_API_KEY")
 
-		config := LoadConfig()
+		_, err := LoadConfig()
 
-		assert.Equal(t, "", config.GoogleMapsAPIKey)
-		assert.Equal(t, 300000, config.DefaultRadius) // Should fall back to default
+		// Unparsable values are reported instead of silently replaced
+		assert.ErrorContains(t, err, `DEFAULT_RADIUS: invalid value "invalid-number": expected an integer`)
 	})
 
 	t.Run("Load config with zero radius", func(t *testing.T) {
@@ -64,7 +71,8 @@ func TestLoadConfig(t *testing.T) {
 		os.Setenv("DEFAULT_RADIUS", "0")
 		os.Setenv("GOOGLE_MAPS_API_KEY", "test-key")
 
-		config := LoadConfig()
+		config, err := LoadConfig()
+		require.NoError(t, err)
 
 		assert.Equal(t, "test-key", config.GoogleMapsAPIKey)
 		assert.Equal(t, 0, config.DefaultRadius)
@@ -75,7 +83,8 @@ func TestLoadConfig(t *testing.T) {
 		os.Setenv("DEFAULT_RADIUS", "-100")
 		os.Setenv("GOOGLE_MAPS_API_KEY", "test-key")
 
-		config := LoadConfig()
+		config, err := LoadConfig()
+		require.NoError(t, err)
 
 		assert.Equal(t, "test-key", config.GoogleMapsAPIKey)
 		assert.Equal(t, -100, config.DefaultRadius)
@@ -86,7 +95,8 @@ func TestLoadConfig(t *testing.T) {
 		os.Setenv("DEFAULT_RADIUS", "999999999")
 		os.Setenv("GOOGLE_MAPS_API_KEY", "test-key")
 
-		config := LoadConfig()
+		config, err := LoadConfig()
+		require.NoError(t, err)
 
 		assert.Equal(t, "test-key", config.GoogleMapsAPIKey)
 		assert.Equal(t, 999999999, config.DefaultRadius)
@@ -97,7 +107,8 @@ func TestLoadConfig(t *testing.T) {
 		os.Setenv("GOOGLE_MAPS_API_KEY", "")
 		os.Setenv("DEFAULT_RADIUS", "")
 
-		config := LoadConfig()
+		config, err := LoadConfig()
+		require.NoError(t, err)
 
 		assert.Equal(t, "", config.GoogleMapsAPIKey)
 		assert.Equal(t, 300000, config.DefaultRadius) // Should use default for empty string
@@ -108,12 +119,12 @@ func TestLoadConfig(t *testing.T) {
 		os.Setenv("GOOGLE_MAPS_API_KEY", "  test-key-with-spaces  ")
 		os.Setenv("DEFAULT_RADIUS", "  1000  ")
 
-		config := LoadConfig()
+		config, err := LoadConfig()
+		require.NoError(t, err)
 
-		// Note: The actual implementation might trim whitespace or not
-		// This test documents the current behavior
-		assert.Contains(t, config.GoogleMapsAPIKey, "test-key-with-spaces")
-		// The radius parsing might handle whitespace differently
+		// Surrounding whitespace is trimmed
+		assert.Equal(t, "test-key-with-spaces", config.GoogleMapsAPIKey)
+		assert.Equal(t, 1000, config.DefaultRadius)
 	})
 }
 
@@ -167,6 +178,7 @@ func TestEnvironmentVariableParsing(t *testing.T) {
 		name           string
 		envValue       string
 		expectedRadius int
+		expectError    bool
 		description    string
 	}{
 		{
@@ -188,22 +200,22 @@ func TestEnvironmentVariableParsing(t *testing.T) {
 			description:    "Should handle leading zeros",
 		},
 		{
-			name:           "Decimal number",
-			envValue:       "123.45",
-			expectedRadius: 300000, // Should fall back to default
-			description:    "Should fall back to default for decimal numbers",
+			name:        "Decimal number",
+			envValue:    "123.45",
+			expectError: true,
+			description: "Should reject decimal numbers",
 		},
 		{
-			name:           "Text value",
-			envValue:       "not-a-number",
-			expectedRadius: 300000, // Should fall back to default
-			description:    "Should fall back to default for non-numeric values",
+			name:        "Text value",
+			envValue:    "not-a-number",
+			expectError: true,
+			description: "Should reject non-numeric values",
 		},
 		{
-			name:           "Mixed alphanumeric",
-			envValue:       "123abc",
-			expectedRadius: 300000, // Should fall back to default
-			description:    "Should fall back to default for mixed alphanumeric",
+			name:        "Mixed alphanumeric",
+			envValue:    "123abc",
+			expectError: true,
+			description: "Should reject mixed alphanumeric",
 		},
 		{
 			name:           "Empty string",
@@ -224,8 +236,13 @@ func TestEnvironmentVariableParsing(t *testing.T) {
 			os.Setenv("DEFAULT_RADIUS", tc.envValue)
 			os.Unsetenv("GOOGLE_MAPS_API_KEY") // Keep this clean
 
-			config := LoadConfig()
+			config, err := LoadConfig()
+			if tc.expectError {
+				assert.Error(t, err, tc.description)
+				return
+			}
 
+			assert.NoError(t, err, tc.description)
 			assert.Equal(t, tc.expectedRadius, config.DefaultRadius, tc.description)
 		})
 	}
@@ -239,6 +256,208 @@ func BenchmarkLoadConfig(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		LoadConfig()
+		_, _ = LoadConfig()
+	}
+}
+
+func TestLoadConfigResilience(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		config, err := LoadConfig()
+		require.NoError(t, err)
+
+		assert.Equal(t, 10*time.Second, config.UpstreamTimeout)
+		assert.Equal(t, 3, config.RetryMaxAttempts)
+		assert.Equal(t, 200*time.Millisecond, config.RetryBaseDelay)
+		assert.Equal(t, 5*time.Second, config.RetryMaxDelay)
+		assert.Equal(t, 5, config.BreakerThreshold)
+		assert.Equal(t, 30*time.Second, config.BreakerCooldown)
+	})
+
+	t.Run("From environment", func(t *testing.T) {
+		t.Setenv("UPSTREAM_TIMEOUT", "2s")
+		t.Setenv("RETRY_MAX_ATTEMPTS", "5")
+		t.Setenv("RETRY_BASE_DELAY", "50ms")
+		t.Setenv("BREAKER_COOLDOWN", "1m")
+
+		config, err := LoadConfig()
+		require.NoError(t, err)
+
+		assert.Equal(t, 2*time.Second, config.UpstreamTimeout)
+		assert.Equal(t, 5, config.RetryMaxAttempts)
+		assert.Equal(t, 50*time.Millisecond, config.RetryBaseDelay)
+		assert.Equal(t, time.Minute, config.BreakerCooldown)
+	})
+
+	t.Run("Invalid duration is rejected", func(t *testing.T) {
+		t.Setenv("UPSTREAM_TIMEOUT", "soon")
+
+		_, err := LoadConfig()
+
+		assert.ErrorContains(t, err, "UPSTREAM_TIMEOUT")
+	})
+}
+
+// writeConfigFile writes a YAML config file for the test and returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	path := writeConfigFile(t, `
+max_airports: 4
+max_distance: 250.5
+upstream_timeout: 3s
+cors_allowed_origins: [https://a.example, https://b.example]
+port: "9000"
+`)
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("MAX_AIRPORTS", "6")
+
+	t.Run("File overrides defaults", func(t *testing.T) {
+		config, err := LoadConfig()
+		require.NoError(t, err)
+
+		assert.Equal(t, 250.5, config.MaxDistance)
+		assert.Equal(t, 3*time.Second, config.UpstreamTimeout)
+		assert.Equal(t, []string{"https://a.example", "https://b.example"}, config.CORSAllowedOrigins)
+		assert.Equal(t, 300000, config.DefaultRadius) // not in the file
+	})
+
+	t.Run("Environment overrides file", func(t *testing.T) {
+		config, err := LoadConfig()
+		require.NoError(t, err)
+		assert.Equal(t, 6, config.MaxAirports)
+	})
+
+	t.Run("Flags override environment", func(t *testing.T) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		configFlags := RegisterConfigFlags(fs)
+		require.NoError(t, fs.Parse([]string{"-max-airports", "8", "-port", "9100"}))
+
+		config, err := configFlags.Load()
+		require.NoError(t, err)
+		assert.Equal(t, 8, config.MaxAirports)
+		assert.Equal(t, "9100", config.Port)
+		assert.Equal(t, 3*time.Second, config.UpstreamTimeout)
+	})
+
+	t.Run("Flag selects the file", func(t *testing.T) {
+		other := writeConfigFile(t, "max_distance: 100\n")
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		configFlags := RegisterConfigFlags(fs)
+		require.NoError(t, fs.Parse([]string{"-config", other}))
+
+		config, err := configFlags.Load()
+		require.NoError(t, err)
+		assert.Equal(t, 100.0, config.MaxDistance)
+	})
+
+	t.Run("Invalid flag value", func(t *testing.T) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		configFlags := RegisterConfigFlags(fs)
+		require.NoError(t, fs.Parse([]string{"-retry-base-delay", "fast"}))
+
+		_, err := configFlags.Load()
+		assert.ErrorContains(t, err, `-retry-base-delay: invalid value "fast"`)
+	})
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	t.Run("Unknown key", func(t *testing.T) {
+		t.Setenv("CONFIG_FILE", writeConfigFile(t, "max_airport: 4\n"))
+		_, err := LoadConfig()
+		assert.ErrorContains(t, err, "field max_airport not found")
+	})
+
+	t.Run("Bad duration", func(t *testing.T) {
+		t.Setenv("CONFIG_FILE", writeConfigFile(t, "upstream_timeout: soon\n"))
+		_, err := LoadConfig()
+		assert.ErrorContains(t, err, "invalid config file")
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+		_, err := LoadConfig()
+		assert.ErrorContains(t, err, "failed to read config file")
+	})
+
+	t.Run("All bad values reported together", func(t *testing.T) {
+		t.Setenv("MAX_AIRPORTS", "many")
+		t.Setenv("MAX_DISTANCE", "far")
+		_, err := LoadConfig()
+		assert.ErrorContains(t, err, "MAX_AIRPORTS")
+		assert.ErrorContains(t, err, "MAX_DISTANCE")
+	})
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := DefaultConfig()
+	valid.GoogleMapsAPIKey = "key"
+	require.NoError(t, valid.Validate())
+
+	tests := []struct {
+		name    string
+		modify  func(c *Config)
+		message string
+	}{
+		{"Missing Google key", func(c *Config) { c.GoogleMapsAPIKey = "" }, "google_maps_api_key is required"},
+		{"Amadeus key without secret", func(c *Config) { c.AmadeusAPIKey = "id" }, "amadeus_secret is required"},
+		{"Negative radius", func(c *Config) { c.DefaultRadius = -100 }, "default_radius must be positive, got -100"},
+		{"Zero airports", func(c *Config) { c.MaxAirports = 0 }, "max_airports must be positive"},
+		{"Unknown cabin class", func(c *Config) { c.CabinClass = "coach" }, `cabin_class must be economy, premium_economy, business or first, got "coach"`},
+		{"Zero station radius", func(c *Config) { c.StationRadius = 0 }, "station_radius must be positive, got 0"},
+		{"Zero port radius", func(c *Config) { c.PortRadius = 0 }, "port_radius must be positive, got 0"},
+		{"Zero airport concurrency", func(c *Config) { c.AirportConcurrency = 0 }, "airport_concurrency must be positive, got 0"},
+		{"No retry attempts", func(c *Config) { c.RetryMaxAttempts = 0 }, "retry_max_attempts must be at least 1"},
+		{"Max delay below base", func(c *Config) { c.RetryMaxDelay = time.Millisecond }, "retry_max_delay (1ms) must not be less than retry_base_delay"},
+		{"Reserve exceeds budget", func(c *Config) { c.GoogleDailyBudget, c.GoogleBudgetReserve = 100, 100 }, "google_budget_reserve (100) must be less than google_daily_budget (100)"},
+		{"Bad port", func(c *Config) { c.Port = "http" }, "port must be a number"},
+		{"Negative timeout", func(c *Config) { c.ReadTimeout = -time.Second }, "read_timeout must not be negative"},
+		{"Unknown exporter", func(c *Config) { c.TracingExporter = "zipkin" }, "tracing_exporter must be"},
+		{"Sample ratio above 1", func(c *Config) { c.TracingSampleRatio = 2 }, "tracing_sample_ratio must be between 0 and 1"},
+		{"Unknown log level", func(c *Config) { c.LogLevel = "verbose" }, "log_level must be"},
 	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.modify(&config)
+			assert.ErrorContains(t, config.Validate(), tt.message)
+		})
+	}
+
+	t.Run("Every problem is reported", func(t *testing.T) {
+		config := valid
+		config.DefaultRadius = -1
+		config.MaxDistance = 0
+		err := config.Validate()
+		assert.ErrorContains(t, err, "default_radius")
+		assert.ErrorContains(t, err, "max_distance")
+	})
+}
+
+func TestConfigWriteYAML(t *testing.T) {
+	config := DefaultConfig()
+	config.GoogleMapsAPIKey = "AIza-secret"
+	config.AdminToken = "admin-secret"
+
+	var buf bytes.Buffer
+	require.NoError(t, config.WriteYAML(&buf))
+	out := buf.String()
+
+	assert.NotContains(t, out, "AIza-secret")
+	assert.NotContains(t, out, "admin-secret")
+	assert.Contains(t, out, "google_maps_api_key: REDACTED")
+	assert.Contains(t, out, `amadeus_api_key: ""`)
+	assert.Contains(t, out, "upstream_timeout: 10s")
+	assert.Equal(t, "AIza-secret", config.GoogleMapsAPIKey, "redaction must not modify the original")
+
+	// The printed configuration loads back as a config file
+	t.Setenv("CONFIG_FILE", writeConfigFile(t, out))
+	loaded, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, config.UpstreamTimeout, loaded.UpstreamTimeout)
+	assert.Equal(t, config.CORSAllowedOrigins, loaded.CORSAllowedOrigins)
 }
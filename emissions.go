@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"slices"
+)
+
+// Emission factors in kg CO2e per passenger-km, after the UK government
+// GHG conversion factors (DESNZ 2023). Flight factors exclude radiative
+// forcing, which is applied on top.
+var (
+	// Ground modes
+	modeEmissionFactors = map[string]float64{
+		"train":            0.035, // national rail
+		"bus":              0.027, // coach
+		"ferry":            0.019, // foot passenger
+		"public_transport": 0.079, // local bus and metro
+		"taxi":             0.149,
+		"car":              0.170,
+	}
+
+	// Flights by distance band and cabin class
+	flightEmissionFactors = []struct {
+		maxDistance float64 // km, inclusive
+		cabins      map[string]float64
+	}{
+		{500, map[string]float64{"economy": 0.1597, "premium_economy": 0.1597, "business": 0.1597, "first": 0.1597}},
+		{3700, map[string]float64{"economy": 0.0888, "premium_economy": 0.0888, "business": 0.1332, "first": 0.1332}},
+		{math.Inf(1), map[string]float64{"economy": 0.0870, "premium_economy": 0.1392, "business": 0.2522, "first": 0.3479}},
+	}
+)
+
+const (
+	// radiativeForcing accounts for the extra warming of emissions at
+	// altitude (contrails, NOx)
+	radiativeForcing = 1.7
+
+	// flightDistanceUplift adds the detours and holding that real flights
+	// fly on top of the great circle
+	flightDistanceUplift = 1.08
+
+	// ferryVehicleFactor replaces the foot passenger factor for a ferry
+	// passenger taking a motor vehicle on board (kg CO2e per km)
+	ferryVehicleFactor = 0.129
+)
+
+// cabinClasses are the accepted cabin classes, cheapest first
+var cabinClasses = []string{"economy", "premium_economy", "business", "first"}
+
+// EstimateCO2 estimates a segment's emissions per passenger in kg CO2e. The
+// distance is the segment's own, or the straight line between its ends
+// when it has none. Flights use the segment's cabin class (economy if
+// unset) and ferries count the vehicle on board. Unknown modes and
+// segments without a distance count as zero.
+func EstimateCO2(segment TransportOption) float64 {
+	distance := segment.Distance
+	if distance == 0 {
+		from, okFrom := locationPoint(segment.From)
+		to, okTo := locationPoint(segment.To)
+		if !okFrom || !okTo {
+			return 0
+		}
+		distance = CalculateDistance(from.Lat, from.Lng, to.Lat, to.Lng)
+	}
+
+	var kg float64
+	if segment.Mode == "flight" {
+		cabin := segment.CabinClass
+		if !slices.Contains(cabinClasses, cabin) {
+			cabin = "economy"
+		}
+		for _, band := range flightEmissionFactors {
+			if distance <= band.maxDistance {
+				kg = distance * flightDistanceUplift * band.cabins[cabin] * radiativeForcing
+				break
+			}
+		}
+	} else if segment.Mode == "ferry" && segment.Vehicle != "" && segment.Vehicle != "bicycle" {
+		kg = distance * ferryVehicleFactor
+	} else {
+		kg = distance * modeEmissionFactors[segment.Mode]
+	}
+	return math.Round(kg*10) / 10
+}
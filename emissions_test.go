@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateCO2(t *testing.T) {
+	flight := func(distance float64, cabin string) TransportOption {
+		return TransportOption{Mode: "flight", Distance: distance, CabinClass: cabin}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		segment TransportOption
+		kg      float64
+	}{
+		// distance × 1.08 uplift × factor × 1.7 radiative forcing
+		{"Domestic flight", flight(400, ""), 117.3},
+		{"Short-haul economy", flight(3545, "economy"), 578.0},
+		{"Short-haul business", flight(3545, "business"), 866.9},
+		{"Short-haul premium economy is economy", flight(3545, "premium_economy"), 578.0},
+		{"Long-haul economy", flight(5770, "economy"), 921.7},
+		{"Long-haul first", flight(5770, "first"), 3685.6},
+		{"Unknown cabin is economy", flight(5770, "suite"), 921.7},
+		{"Train", TransportOption{Mode: "train", Distance: 620}, 21.7},
+		{"Taxi", TransportOption{Mode: "taxi", Distance: 100}, 14.9},
+		{"Ferry foot passenger", TransportOption{Mode: "ferry", Distance: 200}, 3.8},
+		{"Ferry with a car", TransportOption{Mode: "ferry", Distance: 200, Vehicle: "car"}, 25.8},
+		{"Ferry with a bicycle", TransportOption{Mode: "ferry", Distance: 200, Vehicle: "bicycle"}, 3.8},
+		{"Unknown mode", TransportOption{Mode: "rickshaw", Distance: 10}, 0},
+		{"Straight line without a distance", TransportOption{Mode: "taxi",
+			From: Location{Latitude: 37.1773, Longitude: -3.5986}, To: Location{Latitude: 40.4983, Longitude: -3.5676}}, 55.0},
+		{"No distance or coordinates", TransportOption{Mode: "flight"}, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.kg, EstimateCO2(tc.segment))
+		})
+	}
+
+	t.Run("Route total", func(t *testing.T) {
+		route := Route{Segments: []TransportOption{{Mode: "taxi", CO2: 55.04}, {Mode: "flight", CO2: 577.93}}}
+		route.CalculateTotals()
+		assert.Equal(t, 633.0, route.TotalCO2)
+	})
+}
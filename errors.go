@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// Error kinds produced by the services. Callers wrap them with context using
+// fmt.Errorf("...: %w", err) and handlers map them to HTTP responses with
+// writeProblem, so check them with errors.Is rather than comparing messages.
+var (
+	ErrInvalidInput        = errors.New("invalid input")
+	ErrGeocodeNotFound     = errors.New("location not found")
+	ErrNoAirports          = errors.New("no airports found")
+	ErrUpstream            = errors.New("upstream API error")
+	ErrUpstreamQuota       = errors.New("upstream API quota exceeded")
+	ErrUpstreamTimeout     = errors.New("upstream API timed out")
+	ErrUpstreamUnavailable = errors.New("upstream API unavailable")
+	ErrNotFound            = errors.New("not found")
+	ErrUnauthorized        = errors.New("unauthorized")
+	ErrForbidden           = errors.New("forbidden")
+	ErrRateLimited         = errors.New("rate limit exceeded")
+	ErrQuotaExceeded       = errors.New("monthly quota exceeded")
+)
+
+// Problem is an RFC 7807 problem-details response body
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Code   string `json:"code"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// problemKind describes how one error kind is reported to clients
+type problemKind struct {
+	err    error
+	status int
+	code   string
+	title  string
+}
+
+// problemKinds is checked in order; the first kind matching the error wins
+var problemKinds = []problemKind{
+	{ErrInvalidInput, http.StatusBadRequest, "invalid_input", "Invalid input"},
+	{ErrUnauthorized, http.StatusUnauthorized, "unauthorized", "Unauthorized"},
+	{ErrForbidden, http.StatusForbidden, "forbidden", "Forbidden"},
+	{ErrNotFound, http.StatusNotFound, "not_found", "Not found"},
+	{ErrRateLimited, http.StatusTooManyRequests, "rate_limited", "Rate limit exceeded"},
+	{ErrQuotaExceeded, http.StatusTooManyRequests, "quota_exceeded", "Monthly quota exceeded"},
+	{ErrGeocodeNotFound, http.StatusNotFound, "geocode_not_found", "Location not found"},
+	{ErrNoAirports, http.StatusUnprocessableEntity, "no_airports", "No airports found"},
+	{ErrUpstreamQuota, http.StatusServiceUnavailable, "upstream_quota", "Upstream quota exceeded"},
+	{ErrUpstreamTimeout, http.StatusGatewayTimeout, "upstream_timeout", "Upstream timeout"},
+	{ErrUpstreamUnavailable, http.StatusServiceUnavailable, "upstream_unavailable", "Upstream unavailable"},
+	{ErrUpstream, http.StatusBadGateway, "upstream_error", "Upstream error"},
+}
+
+// serverErrorDetail replaces the detail of server errors, whose causes can
+// name upstream requests and are only logged
+const serverErrorDetail = "the request could not be completed, retry later or report the X-Request-ID"
+
+// NewProblem converts an error into problem details. Errors that don't wrap
+// one of the known kinds are reported as internal errors. Server errors
+// get a generic detail; their cause stays in the logs.
+func NewProblem(err error) Problem {
+	problem := Problem{
+		Type:   "/problems/internal",
+		Title:  "Internal error",
+		Status: http.StatusInternalServerError,
+		Code:   "internal",
+	}
+	for _, kind := range problemKinds {
+		if errors.Is(err, kind.err) {
+			problem = Problem{
+				Type:   "/problems/" + kind.code,
+				Title:  kind.title,
+				Status: kind.status,
+				Code:   kind.code,
+			}
+			break
+		}
+	}
+
+	problem.Detail = err.Error()
+	if problem.Status >= http.StatusInternalServerError {
+		problem.Detail = serverErrorDetail
+	}
+	return problem
+}
+
+// writeProblem writes err as an application/problem+json response. The
+// cause of server errors is handed to AccessLog, which logs it.
+func writeProblem(w http.ResponseWriter, err error) {
+	problem := NewProblem(err)
+	if problem.Status >= http.StatusInternalServerError {
+		recordCause(w, err)
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// invalidInput builds an ErrInvalidInput error with a client-facing message
+func invalidInput(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidInput, fmt.Sprintf(format, args...))
+}
+
+// upstreamRequestError classifies a failed outbound request as a timeout or
+// a generic upstream error, keeping the original error in the chain
+func upstreamRequestError(api string, err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("%s request: %w: %w", api, ErrUpstreamTimeout, err)
+	}
+	return fmt.Errorf("%s request: %w: %w", api, ErrUpstream, err)
+}
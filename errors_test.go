@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProblem(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedCode   string
+		expectedDetail string
+	}{
+		{"Invalid input", invalidInput("date is required"), http.StatusBadRequest, "invalid_input", "invalid input: date is required"},
+		{"Geocode not found", fmt.Errorf("failed to geocode origin: %w", ErrGeocodeNotFound), http.StatusNotFound, "geocode_not_found", "failed to geocode origin: location not found"},
+		{"No airports", fmt.Errorf("%w near Nowhere", ErrNoAirports), http.StatusUnprocessableEntity, "no_airports", "no airports found near Nowhere"},
+		{"Upstream error", fmt.Errorf("%w: bad response", ErrUpstream), http.StatusBadGateway, "upstream_error", serverErrorDetail},
+		{"Upstream quota", fmt.Errorf("%w: OVER_QUERY_LIMIT", ErrUpstreamQuota), http.StatusServiceUnavailable, "upstream_quota", serverErrorDetail},
+		{"Upstream timeout", fmt.Errorf("%w: deadline", ErrUpstreamTimeout), http.StatusGatewayTimeout, "upstream_timeout", serverErrorDetail},
+		{"Unknown error", errors.New("boom"), http.StatusInternalServerError, "internal", serverErrorDetail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := NewProblem(tt.err)
+			assert.Equal(t, tt.expectedStatus, problem.Status)
+			assert.Equal(t, tt.expectedCode, problem.Code)
+			assert.Equal(t, "/problems/"+tt.expectedCode, problem.Type)
+			assert.Equal(t, tt.expectedDetail, problem.Detail)
+		})
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeProblem(w, fmt.Errorf("failed to geocode destination Atlantis: %w", ErrGeocodeNotFound))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+
+	var problem Problem
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+	assert.Equal(t, "Location not found", problem.Title)
+	assert.Contains(t, problem.Detail, "Atlantis")
+}
+
+func TestWriteProblem_ServerErrorCause(t *testing.T) {
+	rec := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	cause := fmt.Errorf("geocode request: %w: dial tcp: connection refused", ErrUpstream)
+	writeProblem(&statusRecorder{ResponseWriter: rec}, cause)
+
+	assert.Equal(t, http.StatusBadGateway, rec.status)
+	assert.Equal(t, cause, rec.cause, "the cause is kept for the access log")
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestUpstreamRequestError(t *testing.T) {
+	err := upstreamRequestError("geocode", timeoutError{})
+	assert.ErrorIs(t, err, ErrUpstreamTimeout)
+	assert.Contains(t, err.Error(), "geocode request")
+
+	err = upstreamRequestError("places", errors.New("connection refused"))
+	assert.ErrorIs(t, err, ErrUpstream)
+	assert.NotErrorIs(t, err, ErrUpstreamTimeout)
+}
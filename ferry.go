@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// FerryProvider finds ferry crossings between two places
+type FerryProvider interface {
+	// SearchFerries is SearchTrains for ferries, between ports
+	SearchFerries(ctx context.Context, from, to Location, date time.Time) ([]TransportOption, error)
+
+	// SearchCrossings returns the ferries from a port in the area of an
+	// airport to a port near to that leave from after until the end of the
+	// next day, for passengers who have just landed. Earliest first.
+	SearchCrossings(ctx context.Context, airport, to Location, after time.Time) ([]TransportOption, error)
+}
+
+// ferryFarePerKm prices foot passengers on ferries whose feed has no fare
+// for their route
+const ferryFarePerKm = 0.15
+
+var ferrySearch = gtfsModeSearch{mode: "ferry", locationType: "port", routeTypes: isFerryRouteType, farePerKm: ferryFarePerKm}
+
+// vehicleTypes are the vehicles that can be taken on board a ferry
+var vehicleTypes = []string{"car", "motorcycle", "van", "bicycle"}
+
+// GTFSFerry answers ferry searches from the ferry routes of a GTFS
+// timetable. Prices are for a foot passenger; the fares for taking a
+// vehicle on board come from the feed's vehicle_fares.txt.
+type GTFSFerry struct {
+	feed   *GTFSFeed
+	config *ConfigStore
+}
+
+func NewGTFSFerry(feed *GTFSFeed, config *ConfigStore) *GTFSFerry {
+	return &GTFSFerry{feed: feed, config: config}
+}
+
+func (gf *GTFSFerry) SearchFerries(ctx context.Context, from, to Location, date time.Time) ([]TransportOption, error) {
+	radius := float64(gf.config.Load().StationRadius)
+	return ferrySearch.search(ctx, gf.feed, from, to, radius, radius, date, 1), nil
+}
+
+// SearchCrossings looks for ports within PortRadius of the airport, since
+// airports are rarely next to the harbour
+func (gf *GTFSFerry) SearchCrossings(ctx context.Context, airport, to Location, after time.Time) ([]TransportOption, error) {
+	config := gf.config.Load()
+	return ferrySearch.search(ctx, gf.feed, airport, to, float64(config.PortRadius), float64(config.StationRadius), after, 2), nil
+}
+
+// AddVehicle prices taking a vehicle on the ferries of each route: the
+// vehicle fare is added to every ferry segment and the route's totals. A
+// route is dropped when one of its ferries doesn't take the vehicle; routes
+// without ferries are kept as they are.
+func AddVehicle(routes []Route, vehicle string) []Route {
+	var kept []Route
+	for _, route := range routes {
+		segments := make([]TransportOption, len(route.Segments))
+		copy(segments, route.Segments)
+
+		carried := true
+		for i := range segments {
+			if segments[i].Mode != "ferry" {
+				continue
+			}
+			price, ok := segments[i].VehiclePrices[vehicle]
+			if !ok {
+				carried = false
+				break
+			}
+			segments[i].Vehicle = vehicle
+			segments[i].Price += price
+			segments[i].CO2 = EstimateCO2(segments[i])
+		}
+		if !carried {
+			continue
+		}
+
+		route.Segments = segments
+		route.CalculateTotals()
+		kept = append(kept, route)
+	}
+	return kept
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGTFSFerry_SearchFerries(t *testing.T) {
+	feed, err := LoadGTFS(filepath.Join("testdata", "gtfs", "ferry"))
+	require.NoError(t, err)
+	ferries := NewGTFSFerry(feed, NewConfigStore(DefaultConfig()))
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+	barcelona := Location{Name: "Barcelona", Latitude: 41.3874, Longitude: 2.1686}
+	palma := Location{Name: "Palma", Latitude: 39.5696, Longitude: 2.6502}
+
+	options, err := ferries.SearchFerries(context.Background(), barcelona, palma, time.Date(2026, 6, 1, 10, 0, 0, 0, madrid))
+	require.NoError(t, err)
+	require.Len(t, options, 2)
+	assert.Equal(t, "ferry", options[0].Mode)
+	assert.Equal(t, "port", options[0].From.Type)
+	assert.Equal(t, map[string]float64{"car": 120, "motorcycle": 45}, options[0].VehiclePrices)
+	assert.Equal(t, time.Date(2026, 6, 2, 7, 0, 0, 0, madrid), options[1].Arrival, "overnight crossing")
+}
+
+func TestGTFSFerry_SearchCrossings(t *testing.T) {
+	feed, err := LoadGTFS(filepath.Join("testdata", "gtfs", "ferry"))
+	require.NoError(t, err)
+	config := DefaultConfig()
+	config.StationRadius = 2000
+	ferries := NewGTFSFerry(feed, NewConfigStore(config))
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+	airport := Location{Name: "Ibiza Airport (IBZ)", Latitude: 38.8729, Longitude: 1.3731}
+	formentera := Location{Name: "Formentera", Latitude: 38.7300, Longitude: 1.4200}
+
+	// The port is 6 km from the airport, beyond the station radius
+	options, err := ferries.SearchCrossings(context.Background(), airport, formentera, time.Date(2026, 6, 1, 15, 0, 0, 0, madrid))
+	require.NoError(t, err)
+	require.Len(t, options, 2)
+	assert.Equal(t, time.Date(2026, 6, 2, 9, 0, 0, 0, madrid), options[0].Departure, "the next morning's after a late landing")
+
+	options, err = ferries.SearchFerries(context.Background(), airport, formentera, time.Date(2026, 6, 1, 8, 0, 0, 0, madrid))
+	require.NoError(t, err)
+	assert.Empty(t, options)
+}
+
+func TestAddVehicle(t *testing.T) {
+	ferry := TransportOption{Mode: "ferry", Price: 27, Distance: 20, VehiclePrices: map[string]float64{"car": 70, "bicycle": 5}}
+	ferry.CO2 = EstimateCO2(ferry)
+	taxi := TransportOption{Mode: "taxi", Price: 15, CO2: 1.5}
+	routes := []Route{newRoute([]TransportOption{taxi, ferry}), newRoute([]TransportOption{taxi})}
+
+	withCar := AddVehicle(routes, "car")
+	require.Len(t, withCar, 2)
+	assert.Equal(t, "car", withCar[0].Segments[1].Vehicle)
+	assert.Equal(t, 97.0, withCar[0].Segments[1].Price)
+	assert.Equal(t, 112.0, withCar[0].TotalPrice)
+	assert.Greater(t, withCar[0].Segments[1].CO2, ferry.CO2)
+	assert.Equal(t, routes[1], withCar[1], "routes without ferries are kept as they are")
+	assert.Equal(t, 42.0, routes[0].TotalPrice, "the search results are not changed")
+
+	withVan := AddVehicle(routes, "van")
+	require.Len(t, withVan, 1, "the ferry doesn't take vans")
+	assert.Equal(t, "taxi", withVan[0].Segments[0].Mode)
+}
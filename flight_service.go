@@ -2,48 +2,81 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type FlightService struct {
-	config Config
-	client *http.Client
+	config  *ConfigStore
+	client  *http.Client
+	metrics *Metrics
 }
 
-func NewFlightService(config Config, client *http.Client) *FlightService {
+func NewFlightService(config *ConfigStore, client *http.Client, metrics *Metrics) *FlightService {
 	return &FlightService{
-		config: config,
-		client: client,
+		config:  config,
+		client:  client,
+		metrics: metrics,
 	}
 }
 
+// startSpan traces one flight search between two airports
+func (fs *FlightService) startSpan(ctx context.Context, name string, from, to Location) (context.Context, trace.Span) {
+	attrs := append(locationAttributes("flight.from", from), locationAttributes("flight.to", to)...)
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// observe records a flight search in the upstream metrics and on its span
+func (fs *FlightService) observe(ctx context.Context, start time.Time, status string) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("flight.status", status))
+	fs.metrics.CountUpstream("flights", status)
+	fs.metrics.ObserveUpstreamLatency("flights", time.Since(start))
+	LoggerFromContext(ctx).Debug("upstream call",
+		slog.String(logKeyUpstream, "flights"), slog.String(logKeyStatus, status), durationAttr(time.Since(start)))
+}
+
 // SearchFlights searches for direct flights
-func (fs *FlightService) SearchFlights(from, to Location, date time.Time) ([]TransportOption, error) {
+func (fs *FlightService) SearchFlights(ctx context.Context, from, to Location, date time.Time) ([]TransportOption, error) {
+	ctx, span := fs.startSpan(ctx, "flights.search", from, to)
+	defer span.End()
+	start := time.Now()
+
 	// Check if direct route is likely available
 	if !fs.isDirectRouteAvailable(from.Code, to.Code) {
+		fs.observe(ctx, start, "ZERO_RESULTS")
 		return []TransportOption{}, fmt.Errorf("no direct flights available")
 	}
 
-	// Mock flight data - replace with real API call
+	// Mock flight data - replace with real API call. The mock has no
+	// schedule, so the duration is estimated from the distance.
 	flight := TransportOption{
-		Mode:      "flight",
-		From:      from,
-		To:        to,
-		Duration:  4*time.Hour + 30*time.Minute,
-		Price:     fs.estimateFlightPrice(from.Code, to.Code, "direct"),
-		Currency:  "EUR",
-		Departure: date.Add(2 * time.Hour),
-		Arrival:   date.Add(6*time.Hour + 30*time.Minute),
-		Provider:  "Airlines",
+		Mode:       "flight",
+		From:       from,
+		To:         to,
+		Price:      fs.estimateFlightPrice(from.Code, to.Code, "direct"),
+		Currency:   "EUR",
+		Departure:  date.Add(2 * time.Hour),
+		Provider:   "Airlines",
+		CabinClass: fs.config.Load().CabinClass,
 	}
+	completeFlight(&flight, 4*time.Hour+30*time.Minute)
 
+	fs.observe(ctx, start, "OK")
 	return []TransportOption{flight}, nil
 }
 
 // FindConnectingFlights finds flights with connections
-func (fs *FlightService) FindConnectingFlights(origin, destination Location, date time.Time) ([]Route, error) {
+func (fs *FlightService) FindConnectingFlights(ctx context.Context, origin, destination Location, date time.Time) ([]Route, error) {
+	ctx, span := fs.startSpan(ctx, "flights.connecting", origin, destination)
+	defer span.End()
+	start := time.Now()
 	var routes []Route
 
 	// Major European hubs that typically have good connections
@@ -56,41 +89,58 @@ func (fs *FlightService) FindConnectingFlights(origin, destination Location, dat
 		}
 	}
 
+	fs.observe(ctx, start, "OK")
 	return routes, nil
 }
 
+// hubCoordinates are the positions of the connecting hubs, so connections
+// can be drawn on a map
+var hubCoordinates = map[string]LatLng{
+	"LHR": {51.4700, -0.4543},
+	"CDG": {49.0097, 2.5479},
+	"FRA": {50.0379, 8.5622},
+	"AMS": {52.3105, 4.7683},
+	"FCO": {41.8003, 12.2389},
+	"MUC": {48.3537, 11.7750},
+	"VIE": {48.1103, 16.5697},
+	"ZUR": {47.4582, 8.5555},
+	"IST": {41.2753, 28.7519},
+}
+
 func (fs *FlightService) createConnectingRoute(origin, destination Location, hubCode string, date time.Time) (Route, error) {
 	hubAirport := Location{
-		Name: fmt.Sprintf("%s Hub Airport", hubCode),
-		Code: hubCode,
-		Type: "airport",
+		Name:      fmt.Sprintf("%s Hub Airport", hubCode),
+		Latitude:  hubCoordinates[hubCode].Lat,
+		Longitude: hubCoordinates[hubCode].Lng,
+		Code:      hubCode,
+		Type:      "airport",
 	}
 
 	// First leg: Origin to Hub
 	firstLeg := TransportOption{
-		Mode:      "flight",
-		From:      origin,
-		To:        hubAirport,
-		Duration:  2*time.Hour + 30*time.Minute,
-		Price:     fs.estimateFlightPrice(origin.Code, hubCode, "connecting"),
-		Currency:  "EUR",
-		Departure: date.Add(2 * time.Hour),
-		Arrival:   date.Add(4*time.Hour + 30*time.Minute),
-		Provider:  "Airlines",
+		Mode:       "flight",
+		From:       origin,
+		To:         hubAirport,
+		Price:      fs.estimateFlightPrice(origin.Code, hubCode, "connecting"),
+		Currency:   "EUR",
+		Departure:  date.Add(2 * time.Hour),
+		Provider:   "Airlines",
+		CabinClass: fs.config.Load().CabinClass,
 	}
+	completeFlight(&firstLeg, 2*time.Hour+30*time.Minute)
 
 	// Second leg: Hub to Destination (with layover)
 	secondLeg := TransportOption{
-		Mode:      "flight",
-		From:      hubAirport,
-		To:        destination,
-		Duration:  4 * time.Hour,
-		Price:     fs.estimateFlightPrice(hubCode, destination.Code, "connecting"),
-		Currency:  "EUR",
-		Departure: date.Add(6*time.Hour + 30*time.Minute), // 2-hour layover
-		Arrival:   date.Add(10*time.Hour + 30*time.Minute),
-		Provider:  "Airlines",
+		Mode:       "flight",
+		From:       hubAirport,
+		To:         destination,
+		Price:      fs.estimateFlightPrice(hubCode, destination.Code, "connecting"),
+		Currency:   "EUR",
+		Departure:  firstLeg.Arrival.Add(2 * time.Hour), // 2-hour layover
+		Provider:   "Airlines",
+		CabinClass: firstLeg.CabinClass,
 	}
+	completeFlight(&secondLeg, 4*time.Hour)
 
 	route := Route{
 		Segments: []TransportOption{firstLeg, secondLeg},
@@ -101,6 +151,47 @@ func (fs *FlightService) createConnectingRoute(origin, destination Location, hub
 	return route, nil
 }
 
+// Flight duration estimate: a fixed allowance for taxiing, climb and
+// descent plus the distance at cruising speed
+const (
+	flightOverhead      = 30 * time.Minute
+	flightCruiseSpeed   = 800.0 // km/h
+	flightTimetableStep = 5 * time.Minute
+)
+
+// estimateFlightDuration estimates the gate-to-gate time of a flight of
+// distanceKm, rounded to five minutes like a timetable
+func estimateFlightDuration(distanceKm float64) time.Duration {
+	cruise := time.Duration(distanceKm / flightCruiseSpeed * float64(time.Hour))
+	return (flightOverhead + cruise).Round(flightTimetableStep)
+}
+
+// completeFlight adds the great-circle distance and path to a flight whose
+// airports have coordinates, and fills in what the provider left out: the
+// duration is estimated from the distance (or fallback without
+// coordinates), the arrival follows from it, and so do the emissions
+func completeFlight(flight *TransportOption, fallback time.Duration) {
+	from, okFrom := locationPoint(flight.From)
+	to, okTo := locationPoint(flight.To)
+	if okFrom && okTo {
+		flight.Distance = math.Round(CalculateDistance(from.Lat, from.Lng, to.Lat, to.Lng)*10) / 10
+		flight.Path = greatCircle(from, to)
+	}
+
+	if flight.Duration == 0 {
+		flight.Duration = fallback
+		if flight.Distance > 0 {
+			flight.Duration = estimateFlightDuration(flight.Distance)
+		}
+	}
+	if flight.Arrival.IsZero() {
+		flight.Arrival = flight.Departure.Add(flight.Duration)
+	}
+	if flight.CO2 == 0 {
+		flight.CO2 = EstimateCO2(*flight)
+	}
+}
+
 func (fs *FlightService) isDirectRouteAvailable(fromCode, toCode string) bool {
 	// This would be replaced with real route availability checking
 	// For now, assume major airports have better connectivity
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateFlightDuration(t *testing.T) {
+	assert.Equal(t, 30*time.Minute, estimateFlightDuration(0))
+	assert.Equal(t, 4*time.Hour+30*time.Minute, estimateFlightDuration(3200))
+	assert.Equal(t, 4*time.Hour+55*time.Minute, estimateFlightDuration(3545), "rounded to five minutes")
+}
+
+func TestCompleteFlight(t *testing.T) {
+	madrid := Location{Code: "MAD", Latitude: 40.4983, Longitude: -3.5676}
+	telAviv := Location{Code: "TLV", Latitude: 32.0055, Longitude: 34.8854}
+	departure := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+
+	flight := TransportOption{Mode: "flight", From: madrid, To: telAviv, Departure: departure}
+	completeFlight(&flight, time.Hour)
+	assert.InDelta(t, 3545, flight.Distance, 5)
+	assert.Equal(t, estimateFlightDuration(flight.Distance), flight.Duration)
+	assert.Equal(t, departure.Add(flight.Duration), flight.Arrival)
+	require.Greater(t, len(flight.Path), 2)
+	assert.Equal(t, LatLng{40.4983, -3.5676}, flight.Path[0])
+	assert.Equal(t, LatLng{32.0055, 34.8854}, flight.Path[len(flight.Path)-1])
+
+	t.Run("Provider times are kept", func(t *testing.T) {
+		flight := TransportOption{Mode: "flight", From: madrid, To: telAviv, Departure: departure,
+			Duration: 5 * time.Hour, Arrival: departure.Add(5 * time.Hour)}
+		completeFlight(&flight, time.Hour)
+		assert.Equal(t, 5*time.Hour, flight.Duration)
+		assert.NotZero(t, flight.Distance)
+	})
+
+	t.Run("No coordinates", func(t *testing.T) {
+		flight := TransportOption{Mode: "flight", From: Location{Code: "MAD"}, To: telAviv, Departure: departure}
+		completeFlight(&flight, time.Hour)
+		assert.Zero(t, flight.Distance)
+		assert.Nil(t, flight.Path)
+		assert.Equal(t, departure.Add(time.Hour), flight.Arrival)
+	})
+}
+
+func TestFindConnectingFlights_Geometry(t *testing.T) {
+	fs := NewFlightService(NewConfigStore(DefaultConfig()), nil, nil)
+	madrid := Location{Code: "MAD", Latitude: 40.4983, Longitude: -3.5676}
+	telAviv := Location{Code: "TLV", Latitude: 32.0055, Longitude: 34.8854}
+
+	routes, err := fs.FindConnectingFlights(context.Background(), madrid, telAviv, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.NotEmpty(t, routes)
+	for _, route := range routes {
+		first, second := route.Segments[0], route.Segments[1]
+		assert.NotZero(t, first.Distance, "hubs have coordinates")
+		assert.NotZero(t, second.Distance)
+		assert.Equal(t, 2*time.Hour, second.Departure.Sub(first.Arrival), "layover")
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// LatLng is a point on the map in degrees. In JSON it's a [lat, lng] pair,
+// which keeps long paths compact.
+type LatLng struct {
+	Lat float64
+	Lng float64
+}
+
+func (p LatLng) MarshalJSON() ([]byte, error) {
+	return json.Marshal([2]float64{roundCoordinate(p.Lat), roundCoordinate(p.Lng)})
+}
+
+func (p *LatLng) UnmarshalJSON(data []byte) error {
+	var pair [2]float64
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	p.Lat, p.Lng = pair[0], pair[1]
+	return nil
+}
+
+// locationPoint returns a location's coordinates, and false if it has none
+func locationPoint(loc Location) (LatLng, bool) {
+	if loc.Latitude == 0 && loc.Longitude == 0 {
+		return LatLng{}, false
+	}
+	return LatLng{Lat: loc.Latitude, Lng: loc.Longitude}, true
+}
+
+// greatCircleStep is roughly how far apart the points of an interpolated
+// great-circle path are, in km
+const greatCircleStep = 100
+
+// greatCircle interpolates the shortest path over the Earth's surface from
+// a to b, with a point about every greatCircleStep km (at most 64 pieces).
+// Longitudes stay within ±180°, so a path over the Pacific jumps from one
+// edge of the map to the other; splitAntimeridian cuts it there.
+func greatCircle(a, b LatLng) []LatLng {
+	lat1, lng1 := a.Lat*math.Pi/180, a.Lng*math.Pi/180
+	lat2, lng2 := b.Lat*math.Pi/180, b.Lng*math.Pi/180
+
+	// Central angle between the two points (haversine)
+	h := math.Pow(math.Sin((lat2-lat1)/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin((lng2-lng1)/2), 2)
+	angle := 2 * math.Asin(math.Min(1, math.Sqrt(h)))
+
+	pieces := min(max(int(CalculateDistance(a.Lat, a.Lng, b.Lat, b.Lng)/greatCircleStep), 1), 64)
+	// Antipodes have no single shortest path
+	if angle < 1e-9 || math.Pi-angle < 1e-9 || pieces == 1 {
+		return []LatLng{a, b}
+	}
+
+	path := make([]LatLng, 0, pieces+1)
+	path = append(path, a)
+	for i := 1; i < pieces; i++ {
+		f := float64(i) / float64(pieces)
+		wa := math.Sin((1-f)*angle) / math.Sin(angle)
+		wb := math.Sin(f*angle) / math.Sin(angle)
+
+		x := wa*math.Cos(lat1)*math.Cos(lng1) + wb*math.Cos(lat2)*math.Cos(lng2)
+		y := wa*math.Cos(lat1)*math.Sin(lng1) + wb*math.Cos(lat2)*math.Sin(lng2)
+		z := wa*math.Sin(lat1) + wb*math.Sin(lat2)
+
+		path = append(path, LatLng{
+			Lat: math.Atan2(z, math.Hypot(x, y)) * 180 / math.Pi,
+			Lng: math.Atan2(y, x) * 180 / math.Pi,
+		})
+	}
+	return append(path, b)
+}
+
+// segmentPath is the line a segment is drawn along on a map: the segment's
+// own Path when it has one, a great-circle arc for flights and a straight
+// line between the endpoints for everything else. It's nil when either end
+// has no coordinates.
+func segmentPath(segment TransportOption) []LatLng {
+	if len(segment.Path) >= 2 {
+		return segment.Path
+	}
+
+	from, ok := locationPoint(segment.From)
+	if !ok {
+		return nil
+	}
+	to, ok := locationPoint(segment.To)
+	if !ok {
+		return nil
+	}
+
+	if segment.Mode == "flight" {
+		return greatCircle(from, to)
+	}
+	return []LatLng{from, to}
+}
+
+// splitAntimeridian cuts a path where it crosses the ±180° meridian, so
+// every part can be drawn without a line back across the whole map. The
+// crossing point is interpolated onto both sides.
+func splitAntimeridian(path []LatLng) [][]LatLng {
+	if len(path) == 0 {
+		return nil
+	}
+
+	parts := [][]LatLng{{path[0]}}
+	for i := 1; i < len(path); i++ {
+		prev, p := path[i-1], path[i]
+		if math.Abs(p.Lng-prev.Lng) > 180 {
+			// Shift p next to prev, find where the line meets the meridian
+			// and start a new part on the other side
+			edge := math.Copysign(180, prev.Lng)
+			shifted := p.Lng + 2*edge
+			lat := prev.Lat + (p.Lat-prev.Lat)*(edge-prev.Lng)/(shifted-prev.Lng)
+
+			parts[len(parts)-1] = append(parts[len(parts)-1], LatLng{Lat: lat, Lng: edge})
+			parts = append(parts, []LatLng{{Lat: lat, Lng: -edge}})
+		}
+		parts[len(parts)-1] = append(parts[len(parts)-1], p)
+	}
+	return parts
+}
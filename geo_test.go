@@ -0,0 +1,75 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGreatCircle(t *testing.T) {
+	madrid := LatLng{40.4983, -3.5676}
+	newYork := LatLng{40.6413, -73.7781}
+
+	path := greatCircle(madrid, newYork)
+	require.Len(t, path, 58, "one piece per 100 km of the 5,770 km flight")
+	assert.Equal(t, madrid, path[0])
+	assert.Equal(t, newYork, path[len(path)-1])
+
+	// The shortest path between two cities at the same latitude bows
+	// towards the pole
+	mid := path[len(path)/2]
+	assert.Greater(t, mid.Lat, 45.0)
+
+	var length float64
+	for i := 1; i < len(path); i++ {
+		length += CalculateDistance(path[i-1].Lat, path[i-1].Lng, path[i].Lat, path[i].Lng)
+	}
+	assert.InDelta(t, CalculateDistance(madrid.Lat, madrid.Lng, newYork.Lat, newYork.Lng), length, 0.5)
+
+	t.Run("Short hop", func(t *testing.T) {
+		assert.Equal(t, []LatLng{madrid, madrid}, greatCircle(madrid, madrid))
+	})
+}
+
+func TestSegmentPath(t *testing.T) {
+	granada := Location{Latitude: 37.1773, Longitude: -3.5986}
+	madrid := Location{Latitude: 40.4983, Longitude: -3.5676}
+	telAviv := Location{Latitude: 32.0055, Longitude: 34.8854}
+
+	assert.Equal(t, []LatLng{{37.1773, -3.5986}, {40.4983, -3.5676}}, segmentPath(TransportOption{Mode: "taxi", From: granada, To: madrid}))
+	assert.Greater(t, len(segmentPath(TransportOption{Mode: "flight", From: madrid, To: telAviv})), 2)
+	assert.Nil(t, segmentPath(TransportOption{Mode: "flight", From: madrid, To: Location{Code: "FRA"}}))
+
+	path := []LatLng{{37.1773, -3.5986}, {38.9, -3.7}, {40.4983, -3.5676}}
+	assert.Equal(t, path, segmentPath(TransportOption{Mode: "public_transport", From: granada, To: madrid, Path: path}), "Directions paths win")
+}
+
+func TestSplitAntimeridian(t *testing.T) {
+	tokyo := LatLng{35.7720, 140.3929}
+	losAngeles := LatLng{33.9416, -118.4085}
+
+	parts := splitAntimeridian(greatCircle(tokyo, losAngeles))
+	require.Len(t, parts, 2)
+	assert.Equal(t, tokyo, parts[0][0])
+	assert.Equal(t, 180.0, parts[0][len(parts[0])-1].Lng)
+	assert.Equal(t, -180.0, parts[1][0].Lng)
+	assert.Equal(t, parts[0][len(parts[0])-1].Lat, parts[1][0].Lat)
+	assert.Equal(t, losAngeles, parts[1][len(parts[1])-1])
+	for _, part := range parts {
+		for i := 1; i < len(part); i++ {
+			assert.Less(t, math.Abs(part[i].Lng-part[i-1].Lng), 10.0)
+		}
+	}
+
+	t.Run("Westbound", func(t *testing.T) {
+		parts := splitAntimeridian([]LatLng{{0, -179}, {2, 179}})
+		assert.Equal(t, [][]LatLng{{{0, -179}, {1, -180}}, {{1, 180}, {2, 179}}}, parts)
+	})
+
+	t.Run("No crossing", func(t *testing.T) {
+		path := []LatLng{{40.4983, -3.5676}, {32.0055, 34.8854}}
+		assert.Equal(t, [][]LatLng{path}, splitAntimeridian(path))
+	})
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const googleMapsBaseURL = "https://maps.googleapis.com/maps/api"
+
+// ErrZeroResults is returned when a Google API call succeeded but matched
+// nothing. Callers decide whether that is an error for them.
+var ErrZeroResults = errors.New("no results")
+
+// GoogleStatus is the status envelope shared by all Google Maps web service
+// responses
+type GoogleStatus struct {
+	Status       string `json:"status"`
+	ErrorMessage string `json:"error_message,omitempty"`
+}
+
+func (s GoogleStatus) googleStatus() GoogleStatus {
+	return s
+}
+
+// googleResponse is implemented by every response struct embedding GoogleStatus
+type googleResponse interface {
+	googleStatus() GoogleStatus
+}
+
+// GoogleAPIError reports a non-OK status returned by a Google API. It
+// unwraps to one of the error kinds in errors.go so handlers can map it.
+type GoogleAPIError struct {
+	API     string
+	Status  string
+	Message string
+	kind    error
+}
+
+func (e *GoogleAPIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("google %s API returned %s: %s", e.API, e.Status, e.Message)
+	}
+	return fmt.Sprintf("google %s API returned %s", e.API, e.Status)
+}
+
+func (e *GoogleAPIError) Unwrap() error {
+	return e.kind
+}
+
+// retryable reports whether the same request may succeed if repeated.
+// OVER_DAILY_LIMIT is not retried since it won't clear until the quota resets.
+func (e *GoogleAPIError) retryable() bool {
+	return e.Status == "OVER_QUERY_LIMIT" || e.Status == "UNKNOWN_ERROR"
+}
+
+// googleStatusKind maps a Google API status to an error kind
+func googleStatusKind(status string) error {
+	switch status {
+	case "ZERO_RESULTS", "NOT_FOUND":
+		return ErrZeroResults
+	case "OVER_QUERY_LIMIT", "OVER_DAILY_LIMIT", "RESOURCE_EXHAUSTED":
+		return ErrUpstreamQuota
+	default:
+		// REQUEST_DENIED, INVALID_REQUEST, UNKNOWN_ERROR and anything new
+		return ErrUpstream
+	}
+}
+
+// GoogleClient performs requests against the Google Maps web service APIs
+// and is shared by every service that talks to Google
+type GoogleClient struct {
+	apiKey  func() string // read per request so a rotated key applies at once
+	baseURL string
+	client  *http.Client
+	retry   RetryPolicy
+
+	limiters map[string]*TokenBucket
+	budget   *QuotaBudget
+	metrics  *Metrics
+
+	mu       sync.Mutex
+	statuses map[string]map[string]int
+}
+
+// NewGoogleClient creates a Google Maps API client with a fixed API key.
+// metrics may be nil.
+func NewGoogleClient(config Config, client *http.Client, metrics *Metrics) *GoogleClient {
+	apiKey := config.GoogleMapsAPIKey
+	return &GoogleClient{
+		apiKey:   func() string { return apiKey },
+		baseURL:  googleMapsBaseURL,
+		client:   client,
+		statuses: make(map[string]map[string]int),
+		retry: RetryPolicy{
+			MaxAttempts: config.RetryMaxAttempts,
+			BaseDelay:   config.RetryBaseDelay,
+			MaxDelay:    config.RetryMaxDelay,
+		},
+		limiters: map[string]*TokenBucket{
+			"geocode":    NewTokenBucket(config.GeocodeRateLimit),
+			"places":     NewTokenBucket(config.PlacesRateLimit),
+			"directions": NewTokenBucket(config.DirectionsRateLimit),
+			// Time zones are only looked up for calendar exports
+			"timezone": NewTokenBucket(config.GeocodeRateLimit),
+		},
+		budget:  NewQuotaBudget(config.GoogleDailyBudget, config.GoogleBudgetReserve),
+		metrics: metrics,
+	}
+}
+
+// Degraded reports whether the daily budget is low enough that optional
+// calls (Directions) should be skipped in favour of local estimates
+func (gc *GoogleClient) Degraded() bool {
+	return gc.budget.Low()
+}
+
+// Budget returns the daily call budget tracker
+func (gc *GoogleClient) Budget() *QuotaBudget {
+	return gc.budget
+}
+
+// Get calls the given API path (e.g. "geocode/json") and decodes the JSON
+// response into out. Transport failures, non-200 responses and non-OK
+// statuses are all returned as errors; the latter as *GoogleAPIError.
+// OVER_QUERY_LIMIT and UNKNOWN_ERROR are retried with backoff; HTTP-level
+// retries are left to the client's transport.
+func (gc *GoogleClient) Get(ctx context.Context, api, path string, params url.Values, out googleResponse) error {
+	params.Set("key", gc.apiKey())
+	reqURL := gc.baseURL + "/" + path + "?" + params.Encode()
+
+	for attempt := 1; ; attempt++ {
+		err := gc.get(ctx, api, reqURL, out)
+
+		var apiErr *GoogleAPIError
+		if !errors.As(err, &apiErr) || !apiErr.retryable() || attempt >= gc.retry.Attempts() {
+			return err
+		}
+		if sleepContext(ctx, gc.retry.Backoff(attempt)) != nil {
+			return err
+		}
+	}
+}
+
+func (gc *GoogleClient) get(ctx context.Context, api, reqURL string, out googleResponse) (err error) {
+	ctx, span := tracer().Start(ctx, "google."+api,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("google.api", api)))
+	defer func() { endSpan(span, err) }()
+
+	if err := gc.budget.Spend(api); err != nil {
+		gc.recordStatus(ctx, api, "BUDGET_EXHAUSTED")
+		LoggerFromContext(ctx).Warn("google daily budget exhausted", slog.String(logKeyUpstream, api))
+		return fmt.Errorf("%s request: %w", api, err)
+	}
+	if err := gc.limiters[api].Wait(ctx); err != nil {
+		return upstreamRequestError(api, err)
+	}
+
+	countGoogleCall(ctx)
+	start := time.Now()
+	defer func() {
+		elapsed := time.Since(start)
+		gc.metrics.ObserveUpstreamLatency(api, elapsed)
+
+		logger := LoggerFromContext(ctx)
+		if err != nil && !errors.Is(err, ErrZeroResults) {
+			logger.Warn("upstream call failed", slog.String(logKeyUpstream, api), durationAttr(elapsed), errorAttr(err))
+		} else {
+			logger.Debug("upstream call", slog.String(logKeyUpstream, api), durationAttr(elapsed))
+		}
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return fmt.Errorf("%s request: %w", api, redactURLError(err))
+	}
+
+	resp, err := gc.client.Do(req)
+	if err != nil {
+		gc.recordStatus(ctx, api, "TRANSPORT_ERROR")
+		return upstreamRequestError(api, redactURLError(err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		gc.recordStatus(ctx, api, "TRANSPORT_ERROR")
+		return upstreamRequestError(api, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		gc.recordStatus(ctx, api, fmt.Sprintf("HTTP_%d", resp.StatusCode))
+		kind := ErrUpstream
+		if resp.StatusCode == http.StatusTooManyRequests {
+			kind = ErrUpstreamQuota
+		}
+		return fmt.Errorf("%s request: %w: HTTP %d", api, kind, resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		gc.recordStatus(ctx, api, "INVALID_RESPONSE")
+		return fmt.Errorf("%s request: %w: invalid response: %v", api, ErrUpstream, err)
+	}
+
+	status := out.googleStatus()
+	gc.recordStatus(ctx, api, status.Status)
+	if status.Status == "OK" {
+		return nil
+	}
+
+	return &GoogleAPIError{
+		API:     api,
+		Status:  status.Status,
+		Message: status.ErrorMessage,
+		kind:    googleStatusKind(status.Status),
+	}
+}
+
+// apiKeyParam matches the key query parameter of a request URL
+var apiKeyParam = regexp.MustCompile(`([?&]key=)[^&#\s"]*`)
+
+// redactAPIKey hides the API key in a URL or in text quoting one
+func redactAPIKey(s string) string {
+	return apiKeyParam.ReplaceAllString(s, "${1}REDACTED")
+}
+
+// redactURLError hides the API key in the URL a failed request reports, so
+// the error is safe to log, trace and return
+func redactURLError(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		urlErr.URL = redactAPIKey(urlErr.URL)
+	}
+	return err
+}
+
+func (gc *GoogleClient) recordStatus(ctx context.Context, api, status string) {
+	gc.metrics.CountUpstream(api, status)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("google.status", status))
+
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	if gc.statuses[api] == nil {
+		gc.statuses[api] = make(map[string]int)
+	}
+	gc.statuses[api][status]++
+}
+
+// StatusCounts returns how many responses were seen per API and status
+func (gc *GoogleClient) StatusCounts() map[string]map[string]int {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+
+	counts := make(map[string]map[string]int, len(gc.statuses))
+	for api, statuses := range gc.statuses {
+		counts[api] = make(map[string]int, len(statuses))
+		for status, n := range statuses {
+			counts[api][status] = n
+		}
+	}
+	return counts
+}
+
+// Probe makes one cheap geocoding call to confirm the Google API is
+// reachable and accepts the key. A request that matches nothing still
+// proves both.
+func (gc *GoogleClient) Probe(ctx context.Context) error {
+	var resp GoogleGeocodingResponse
+	err := gc.Get(ctx, "geocode", "geocode/json", url.Values{"address": {"London"}}, &resp)
+	if errors.Is(err, ErrZeroResults) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newStubGoogleClient returns a GoogleClient pointed at a local server that
+// answers every request with handler
+func newStubGoogleClient(t *testing.T, handler http.HandlerFunc) *GoogleClient {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	gc := NewGoogleClient(Config{GoogleMapsAPIKey: "test-key"}, server.Client(), nil)
+	gc.baseURL = server.URL
+	return gc
+}
+
+// googleStatusHandler answers every request with the given status and no results
+func googleStatusHandler(status, message string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"results": [], "routes": [], "status": %q, "error_message": %q}`, status, message)
+	}
+}
+
+func TestGoogleClient_Get(t *testing.T) {
+	var gotPath, gotKey string
+	gc := newStubGoogleClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotKey = r.URL.Query().Get("key")
+		fmt.Fprint(w, `{"results": [{"formatted_address": "Madrid, Spain"}], "status": "OK"}`)
+	})
+
+	var resp GoogleGeocodingResponse
+	err := gc.Get(context.Background(), "geocode", "geocode/json", url.Values{"address": {"Madrid"}}, &resp)
+	assert.NoError(t, err)
+	assert.Equal(t, "/geocode/json", gotPath)
+	assert.Equal(t, "test-key", gotKey)
+	assert.Equal(t, "OK", resp.Status)
+	assert.Equal(t, "Madrid, Spain", resp.Results[0].FormattedAddress)
+}
+
+func TestGoogleClient_GetStatuses(t *testing.T) {
+	tests := []struct {
+		status       string
+		expectedKind error
+	}{
+		{"ZERO_RESULTS", ErrZeroResults},
+		{"OVER_QUERY_LIMIT", ErrUpstreamQuota},
+		{"OVER_DAILY_LIMIT", ErrUpstreamQuota},
+		{"REQUEST_DENIED", ErrUpstream},
+		{"INVALID_REQUEST", ErrUpstream},
+		{"UNKNOWN_ERROR", ErrUpstream},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			gc := newStubGoogleClient(t, googleStatusHandler(tt.status, "details from google"))
+
+			var resp GooglePlacesResponse
+			err := gc.Get(context.Background(), "places", "place/nearbysearch/json", url.Values{}, &resp)
+			assert.ErrorIs(t, err, tt.expectedKind)
+
+			var apiErr *GoogleAPIError
+			assert.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, "places", apiErr.API)
+			assert.Equal(t, tt.status, apiErr.Status)
+			assert.Equal(t, "details from google", apiErr.Message)
+			assert.Equal(t, 1, gc.StatusCounts()["places"][tt.status])
+		})
+	}
+}
+
+func TestGoogleClient_GetHTTPErrors(t *testing.T) {
+	t.Run("Too many requests", func(t *testing.T) {
+		gc := newStubGoogleClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		})
+		err := gc.Get(context.Background(), "geocode", "geocode/json", url.Values{}, &GoogleGeocodingResponse{})
+		assert.ErrorIs(t, err, ErrUpstreamQuota)
+		assert.Equal(t, 1, gc.StatusCounts()["geocode"]["HTTP_429"])
+	})
+
+	t.Run("Malformed body", func(t *testing.T) {
+		gc := newStubGoogleClient(t, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "<html>")
+		})
+		err := gc.Get(context.Background(), "geocode", "geocode/json", url.Values{}, &GoogleGeocodingResponse{})
+		assert.ErrorIs(t, err, ErrUpstream)
+	})
+
+	t.Run("Transport error hides the key", func(t *testing.T) {
+		server := httptest.NewServer(nil)
+		server.Close()
+		gc := NewGoogleClient(Config{GoogleMapsAPIKey: "test-key"}, server.Client(), nil)
+		gc.baseURL = server.URL
+
+		err := gc.Get(context.Background(), "geocode", "geocode/json", url.Values{"address": {"Madrid"}}, &GoogleGeocodingResponse{})
+		assert.ErrorIs(t, err, ErrUpstream)
+		assert.NotContains(t, err.Error(), "test-key")
+		assert.Contains(t, err.Error(), "key=REDACTED")
+	})
+}
+
+func TestAirportService_GeocodeLocationStatuses(t *testing.T) {
+	t.Run("Zero results means not found", func(t *testing.T) {
+		as := NewAirportService(NewConfigStore(Config{}), newStubGoogleClient(t, googleStatusHandler("ZERO_RESULTS", "")))
+		_, err := as.GeocodeLocation(context.Background(), "Atlantis")
+		assert.ErrorIs(t, err, ErrGeocodeNotFound)
+	})
+
+	t.Run("Quota is surfaced", func(t *testing.T) {
+		as := NewAirportService(NewConfigStore(Config{}), newStubGoogleClient(t, googleStatusHandler("OVER_QUERY_LIMIT", "")))
+		_, err := as.GeocodeLocation(context.Background(), "Madrid")
+		assert.ErrorIs(t, err, ErrUpstreamQuota)
+	})
+}
+
+func TestAirportService_FindNearbyAirportsDenied(t *testing.T) {
+	as := NewAirportService(NewConfigStore(Config{}), newStubGoogleClient(t, googleStatusHandler("REQUEST_DENIED", "The provided API key is invalid.")))
+	_, err := as.FindNearbyAirports(context.Background(), Location{Name: "Madrid"}, 1000)
+	assert.ErrorIs(t, err, ErrUpstream)
+	assert.Contains(t, err.Error(), "REQUEST_DENIED")
+}
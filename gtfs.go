@@ -0,0 +1,632 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GTFSFeed is a GTFS static feed (https://gtfs.org/schedule/reference/)
+// loaded into memory: the stops, routes and trips with their stop times,
+// the service calendar and fares
+type GTFSFeed struct {
+	Agencies map[string]*GTFSAgency
+	Stops    map[string]*GTFSStop
+	Routes   map[string]*GTFSRoute
+	Trips    map[string]*GTFSTrip
+
+	services     map[string]*gtfsService
+	fares        map[string]gtfsFare            // by route_id
+	vehicleFares map[string]map[string]gtfsFare // by route_id and vehicle_type
+}
+
+type GTFSAgency struct {
+	ID       string
+	Name     string
+	Location *time.Location // agency_timezone; stop times are local to it
+}
+
+type GTFSStop struct {
+	ID     string
+	Name   string
+	Lat    float64
+	Lng    float64
+	Parent string // parent_station
+}
+
+type GTFSRoute struct {
+	ID        string
+	Agency    *GTFSAgency
+	ShortName string
+	LongName  string
+	Type      int // route_type, e.g. 2 rail, 3 bus, 4 ferry
+}
+
+type GTFSTrip struct {
+	ID        string
+	Route     *GTFSRoute
+	ServiceID string
+	Headsign  string
+	StopTimes []GTFSStopTime // in stop_sequence order
+}
+
+// GTFSStopTime is a trip's call at a stop. Times are offsets from the
+// start of the service day and may pass 24h for trips running past
+// midnight.
+type GTFSStopTime struct {
+	Stop      *GTFSStop
+	Arrival   time.Duration
+	Departure time.Duration
+	sequence  int
+}
+
+// gtfsService is a calendar.txt entry with its calendar_dates.txt
+// exceptions
+type gtfsService struct {
+	weekdays   [7]bool // indexed by time.Weekday
+	start, end string  // YYYYMMDD, inclusive; empty without a calendar.txt entry
+	added      map[string]bool
+	removed    map[string]bool
+}
+
+type gtfsFare struct {
+	price    float64
+	currency string
+}
+
+// Route types (route_type), including the extended types
+func isRailRouteType(t int) bool  { return t == 2 || (t >= 100 && t < 200) }
+func isBusRouteType(t int) bool   { return t == 3 || (t >= 200 && t < 300) || (t >= 700 && t < 800) }
+func isFerryRouteType(t int) bool { return t == 4 || t == 1000 || t == 1200 }
+
+// LoadGTFS reads a feed from a directory or a .zip file
+func LoadGTFS(path string) (*GTFSFeed, error) {
+	var fsys fs.FS
+	if strings.HasSuffix(path, ".zip") {
+		zr, err := zip.OpenReader(path)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		fsys = zr
+	} else {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		fsys = os.DirFS(path)
+	}
+
+	feed, err := parseGTFS(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("GTFS feed %s: %w", path, err)
+	}
+	return feed, nil
+}
+
+func parseGTFS(fsys fs.FS) (*GTFSFeed, error) {
+	feed := &GTFSFeed{
+		Agencies:     make(map[string]*GTFSAgency),
+		Stops:        make(map[string]*GTFSStop),
+		Routes:       make(map[string]*GTFSRoute),
+		Trips:        make(map[string]*GTFSTrip),
+		services:     make(map[string]*gtfsService),
+		fares:        make(map[string]gtfsFare),
+		vehicleFares: make(map[string]map[string]gtfsFare),
+	}
+
+	for _, load := range []struct {
+		file     string
+		required bool
+		row      func(r gtfsRow) error
+	}{
+		{"agency.txt", true, feed.addAgency},
+		{"stops.txt", true, feed.addStop},
+		{"routes.txt", true, feed.addRoute},
+		{"trips.txt", true, feed.addTrip},
+		{"stop_times.txt", true, feed.addStopTime},
+		{"calendar.txt", false, feed.addCalendar},
+		{"calendar_dates.txt", false, feed.addCalendarDate},
+	} {
+		if err := readGTFSFile(fsys, load.file, load.required, load.row); err != nil {
+			return nil, err
+		}
+	}
+	if err := feed.loadFares(fsys); err != nil {
+		return nil, err
+	}
+	if err := readGTFSFile(fsys, "vehicle_fares.txt", false, feed.addVehicleFare); err != nil {
+		return nil, err
+	}
+	if len(feed.services) == 0 {
+		return nil, errors.New("calendar.txt or calendar_dates.txt is required")
+	}
+
+	for _, trip := range feed.Trips {
+		sort.SliceStable(trip.StopTimes, func(i, j int) bool {
+			return trip.StopTimes[i].sequence < trip.StopTimes[j].sequence
+		})
+	}
+	return feed, nil
+}
+
+// gtfsRow looks up the fields of one CSV record by column name
+type gtfsRow struct {
+	file    string
+	line    int
+	columns map[string]int
+	record  []string
+}
+
+func (r gtfsRow) get(column string) string {
+	if i, ok := r.columns[column]; ok && i < len(r.record) {
+		return strings.TrimSpace(r.record[i])
+	}
+	return ""
+}
+
+func (r gtfsRow) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s line %d: %s", r.file, r.line, fmt.Sprintf(format, args...))
+}
+
+// readGTFSFile calls row for every record of a feed file
+func readGTFSFile(fsys fs.FS, name string, required bool, row func(gtfsRow) error) error {
+	f, err := fsys.Open(name)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cr := csv.NewReader(f)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))] = i
+	}
+
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := row(gtfsRow{file: name, line: line, columns: columns, record: record}); err != nil {
+			return err
+		}
+	}
+}
+
+func (feed *GTFSFeed) addAgency(r gtfsRow) error {
+	loc, err := time.LoadLocation(r.get("agency_timezone"))
+	if err != nil {
+		return r.errorf("agency_timezone: %v", err)
+	}
+	agency := &GTFSAgency{ID: r.get("agency_id"), Name: r.get("agency_name"), Location: loc}
+	feed.Agencies[agency.ID] = agency
+	return nil
+}
+
+func (feed *GTFSFeed) addStop(r gtfsRow) error {
+	lat, errLat := strconv.ParseFloat(r.get("stop_lat"), 64)
+	lng, errLng := strconv.ParseFloat(r.get("stop_lon"), 64)
+	if errLat != nil || errLng != nil {
+		return r.errorf("invalid stop_lat or stop_lon")
+	}
+	stop := &GTFSStop{ID: r.get("stop_id"), Name: r.get("stop_name"), Lat: lat, Lng: lng, Parent: r.get("parent_station")}
+	feed.Stops[stop.ID] = stop
+	return nil
+}
+
+func (feed *GTFSFeed) addRoute(r gtfsRow) error {
+	routeType, err := strconv.Atoi(r.get("route_type"))
+	if err != nil {
+		return r.errorf("invalid route_type %q", r.get("route_type"))
+	}
+
+	// agency_id may be left out when the feed has a single agency
+	agency := feed.Agencies[r.get("agency_id")]
+	if agency == nil && len(feed.Agencies) == 1 {
+		for _, only := range feed.Agencies {
+			agency = only
+		}
+	}
+	if agency == nil {
+		return r.errorf("unknown agency_id %q", r.get("agency_id"))
+	}
+
+	route := &GTFSRoute{ID: r.get("route_id"), Agency: agency, ShortName: r.get("route_short_name"),
+		LongName: r.get("route_long_name"), Type: routeType}
+	feed.Routes[route.ID] = route
+	return nil
+}
+
+func (feed *GTFSFeed) addTrip(r gtfsRow) error {
+	route := feed.Routes[r.get("route_id")]
+	if route == nil {
+		return r.errorf("unknown route_id %q", r.get("route_id"))
+	}
+	trip := &GTFSTrip{ID: r.get("trip_id"), Route: route, ServiceID: r.get("service_id"), Headsign: r.get("trip_headsign")}
+	feed.Trips[trip.ID] = trip
+	return nil
+}
+
+func (feed *GTFSFeed) addStopTime(r gtfsRow) error {
+	trip := feed.Trips[r.get("trip_id")]
+	if trip == nil {
+		return r.errorf("unknown trip_id %q", r.get("trip_id"))
+	}
+	stop := feed.Stops[r.get("stop_id")]
+	if stop == nil {
+		return r.errorf("unknown stop_id %q", r.get("stop_id"))
+	}
+
+	sequence, err := strconv.Atoi(r.get("stop_sequence"))
+	if err != nil {
+		return r.errorf("invalid stop_sequence %q", r.get("stop_sequence"))
+	}
+
+	// Untimed stops are interpolated by the producer's own tools; without
+	// either time the call can't be used
+	arrivalTime, departureTime := r.get("arrival_time"), r.get("departure_time")
+	switch {
+	case arrivalTime == "" && departureTime == "":
+		return nil
+	case arrivalTime == "":
+		arrivalTime = departureTime
+	case departureTime == "":
+		departureTime = arrivalTime
+	}
+	arrival, err := parseGTFSTime(arrivalTime)
+	if err != nil {
+		return r.errorf("%v", err)
+	}
+	departure, err := parseGTFSTime(departureTime)
+	if err != nil {
+		return r.errorf("%v", err)
+	}
+
+	trip.StopTimes = append(trip.StopTimes, GTFSStopTime{Stop: stop, Arrival: arrival, Departure: departure, sequence: sequence})
+	return nil
+}
+
+// parseGTFSTime parses an H:MM:SS service day time, which passes 24:00:00
+// for trips after midnight
+func parseGTFSTime(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	var fields [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (i > 0 && n > 59) {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		fields[i] = n
+	}
+	return time.Duration(fields[0])*time.Hour + time.Duration(fields[1])*time.Minute + time.Duration(fields[2])*time.Second, nil
+}
+
+func (feed *GTFSFeed) service(id string) *gtfsService {
+	svc := feed.services[id]
+	if svc == nil {
+		svc = &gtfsService{added: make(map[string]bool), removed: make(map[string]bool)}
+		feed.services[id] = svc
+	}
+	return svc
+}
+
+func (feed *GTFSFeed) addCalendar(r gtfsRow) error {
+	svc := feed.service(r.get("service_id"))
+	for day, column := range []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday", "saturday"} {
+		svc.weekdays[day] = r.get(column) == "1"
+	}
+	svc.start, svc.end = r.get("start_date"), r.get("end_date")
+	if len(svc.start) != 8 || len(svc.end) != 8 {
+		return r.errorf("start_date and end_date must be YYYYMMDD")
+	}
+	return nil
+}
+
+func (feed *GTFSFeed) addCalendarDate(r gtfsRow) error {
+	svc := feed.service(r.get("service_id"))
+	switch date := r.get("date"); r.get("exception_type") {
+	case "1":
+		svc.added[date] = true
+	case "2":
+		svc.removed[date] = true
+	default:
+		return r.errorf("exception_type must be 1 or 2")
+	}
+	return nil
+}
+
+// loadFares reads the fare of each route from fare_attributes.txt and the
+// route_id rules in fare_rules.txt. Zone-based rules aren't supported.
+func (feed *GTFSFeed) loadFares(fsys fs.FS) error {
+	attributes := make(map[string]gtfsFare)
+	err := readGTFSFile(fsys, "fare_attributes.txt", false, func(r gtfsRow) error {
+		price, err := strconv.ParseFloat(r.get("price"), 64)
+		if err != nil {
+			return r.errorf("invalid price %q", r.get("price"))
+		}
+		attributes[r.get("fare_id")] = gtfsFare{price: price, currency: r.get("currency_type")}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return readGTFSFile(fsys, "fare_rules.txt", false, func(r gtfsRow) error {
+		fare, ok := attributes[r.get("fare_id")]
+		if !ok {
+			return r.errorf("unknown fare_id %q", r.get("fare_id"))
+		}
+		if routeID := r.get("route_id"); routeID != "" {
+			feed.fares[routeID] = fare
+		}
+		return nil
+	})
+}
+
+// addVehicleFare reads a row of vehicle_fares.txt, an extension of this
+// service for ferry feeds: the fare for taking a vehicle_type (car,
+// motorcycle, van or bicycle) on board a route, on top of the passenger's
+func (feed *GTFSFeed) addVehicleFare(r gtfsRow) error {
+	route := feed.Routes[r.get("route_id")]
+	if route == nil {
+		return r.errorf("unknown route_id %q", r.get("route_id"))
+	}
+	vehicle := r.get("vehicle_type")
+	if !slices.Contains(vehicleTypes, vehicle) {
+		return r.errorf("unknown vehicle_type %q", vehicle)
+	}
+	price, err := strconv.ParseFloat(r.get("price"), 64)
+	if err != nil {
+		return r.errorf("invalid price %q", r.get("price"))
+	}
+
+	if feed.vehicleFares[route.ID] == nil {
+		feed.vehicleFares[route.ID] = make(map[string]gtfsFare)
+	}
+	feed.vehicleFares[route.ID][vehicle] = gtfsFare{price: price, currency: r.get("currency_type")}
+	return nil
+}
+
+// RunsOn reports whether a trip's service runs on the service day of date
+// (its calendar date; the time of day is ignored)
+func (feed *GTFSFeed) RunsOn(trip *GTFSTrip, date time.Time) bool {
+	svc := feed.services[trip.ServiceID]
+	if svc == nil {
+		return false
+	}
+	day := date.Format("20060102")
+	switch {
+	case svc.removed[day]:
+		return false
+	case svc.added[day]:
+		return true
+	}
+	return svc.start != "" && svc.start <= day && day <= svc.end && svc.weekdays[date.Weekday()]
+}
+
+// Fare returns the fare of a route, if the feed has one
+func (feed *GTFSFeed) Fare(route *GTFSRoute) (price float64, currency string, ok bool) {
+	fare, ok := feed.fares[route.ID]
+	return fare.price, fare.currency, ok
+}
+
+// VehicleFares returns the fares in currency for taking each vehicle type
+// on board a route, nil if there are none
+func (feed *GTFSFeed) VehicleFares(route *GTFSRoute, currency string) map[string]float64 {
+	var prices map[string]float64
+	for vehicle, fare := range feed.vehicleFares[route.ID] {
+		if fare.currency != currency {
+			continue
+		}
+		if prices == nil {
+			prices = make(map[string]float64)
+		}
+		prices[vehicle] = fare.price
+	}
+	return prices
+}
+
+// StopsNear returns the stops within radius meters of p
+func (feed *GTFSFeed) StopsNear(p LatLng, radius float64) []*GTFSStop {
+	var stops []*GTFSStop
+	for _, stop := range feed.Stops {
+		if CalculateDistance(p.Lat, p.Lng, stop.Lat, stop.Lng)*1000 <= radius {
+			stops = append(stops, stop)
+		}
+	}
+	return stops
+}
+
+// serviceDay is the instant stop times on date's calendar day count from:
+// noon minus 12 hours in loc, which is midnight except on days the clocks
+// change
+func serviceDay(date time.Time, loc *time.Location) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 12, 0, 0, 0, loc).Add(-12 * time.Hour)
+}
+
+// stopLocation turns a GTFS stop into a Location of the given type
+func stopLocation(stop *GTFSStop, locationType string) Location {
+	return Location{Name: stop.Name, Latitude: stop.Lat, Longitude: stop.Lng, Type: locationType, Code: stop.ID}
+}
+
+// GTFSLeg is a ride on one trip from its Board-th to its Alight-th stop
+// time, on the service day starting at Day
+type GTFSLeg struct {
+	Trip          *GTFSTrip
+	Board, Alight int
+	Day           time.Time
+}
+
+func (leg GTFSLeg) Departure() time.Time {
+	return leg.Day.Add(leg.Trip.StopTimes[leg.Board].Departure)
+}
+
+func (leg GTFSLeg) Arrival() time.Time {
+	return leg.Day.Add(leg.Trip.StopTimes[leg.Alight].Arrival)
+}
+
+// DirectTrips finds the trips on routes whose type routeTypes accepts that
+// call at a stop within fromRadius meters of from and later at one within
+// toRadius of to, leaving between date and the end of the days-th service
+// day from date's, earliest first. Each trip is ridden from the last stop
+// it reaches near from to the first one near to.
+func (feed *GTFSFeed) DirectTrips(from, to LatLng, fromRadius, toRadius float64, date time.Time, days int, routeTypes func(int) bool) []GTFSLeg {
+	boarding := stopSet(feed.StopsNear(from, fromRadius))
+	alighting := stopSet(feed.StopsNear(to, toRadius))
+	if len(boarding) == 0 || len(alighting) == 0 {
+		return nil
+	}
+
+	var legs []GTFSLeg
+	for _, trip := range feed.Trips {
+		if !routeTypes(trip.Route.Type) {
+			continue
+		}
+		loc := trip.Route.Agency.Location
+		end := serviceDay(date.In(loc), loc).AddDate(0, 0, days)
+
+		// Yesterday's trips can still be running after midnight
+		for offset := -1; offset < days; offset++ {
+			day := serviceDay(date.In(loc).AddDate(0, 0, offset), loc)
+			if !feed.RunsOn(trip, day) {
+				continue
+			}
+			leg, ok := rideBetween(trip, day, boarding, alighting)
+			if ok && !leg.Departure().Before(date) && leg.Departure().Before(end) {
+				legs = append(legs, leg)
+			}
+		}
+	}
+
+	sort.Slice(legs, func(i, j int) bool {
+		if !legs[i].Departure().Equal(legs[j].Departure()) {
+			return legs[i].Departure().Before(legs[j].Departure())
+		}
+		return legs[i].Trip.ID < legs[j].Trip.ID
+	})
+	return legs
+}
+
+func stopSet(stops []*GTFSStop) map[*GTFSStop]bool {
+	set := make(map[*GTFSStop]bool, len(stops))
+	for _, stop := range stops {
+		set[stop] = true
+	}
+	return set
+}
+
+// rideBetween finds the shortest ride on trip from a boarding stop to a
+// later alighting stop. A stop in both sets is alighted at once aboard.
+func rideBetween(trip *GTFSTrip, day time.Time, boarding, alighting map[*GTFSStop]bool) (GTFSLeg, bool) {
+	board := -1
+	for i, st := range trip.StopTimes {
+		switch {
+		case board >= 0 && alighting[st.Stop]:
+			return GTFSLeg{Trip: trip, Board: board, Alight: i, Day: day}, true
+		case boarding[st.Stop]:
+			board = i
+		}
+	}
+	return GTFSLeg{}, false
+}
+
+// Option describes a leg as a TransportOption of the given mode between
+// stops of the given location type. Its path runs through the stops on the
+// way, and it's priced with the route's fare when that is in EUR, like every
+// price on a route, or else by distance at farePerKm. The fares for taking a
+// vehicle on board, which only ferry feeds have, come along.
+func (feed *GTFSFeed) Option(leg GTFSLeg, mode, locationType string, farePerKm float64) TransportOption {
+	calls := leg.Trip.StopTimes[leg.Board : leg.Alight+1]
+	path := make([]LatLng, len(calls))
+	distance := 0.0
+	for i, st := range calls {
+		path[i] = LatLng{Lat: st.Stop.Lat, Lng: st.Stop.Lng}
+		if i > 0 {
+			distance += CalculateDistance(path[i-1].Lat, path[i-1].Lng, path[i].Lat, path[i].Lng)
+		}
+	}
+
+	route := leg.Trip.Route
+	provider := route.Agency.Name
+	if route.ShortName != "" {
+		provider += " " + route.ShortName
+	}
+
+	option := TransportOption{
+		Mode:      mode,
+		From:      stopLocation(calls[0].Stop, locationType),
+		To:        stopLocation(calls[len(calls)-1].Stop, locationType),
+		Duration:  leg.Arrival().Sub(leg.Departure()),
+		Departure: leg.Departure(),
+		Arrival:   leg.Arrival(),
+		Provider:  provider,
+		Distance:  math.Round(distance*10) / 10,
+		Path:      path,
+	}
+	option.Currency = "EUR"
+	if price, currency, ok := feed.Fare(route); ok && currency == option.Currency {
+		option.Price = price
+	} else {
+		option.Price = math.Round(option.Distance*farePerKm*100) / 100
+	}
+	option.From.TimeZone = route.Agency.Location.String()
+	option.To.TimeZone = option.From.TimeZone
+	option.VehiclePrices = feed.VehicleFares(route, option.Currency)
+	option.CO2 = EstimateCO2(option)
+	return option
+}
+
+// gtfsModeSearch looks up one mode in a GTFS feed for the rail, coach and
+// ferry providers
+type gtfsModeSearch struct {
+	mode         string         // TransportOption.Mode of the results
+	locationType string         // Location.Type of their stops
+	routeTypes   func(int) bool // the routes that run the mode
+	farePerKm    float64        // EUR, for routes without a fare
+}
+
+// search returns the direct trips from stops within fromRadius meters of
+// from to stops within toRadius of to that leave from date until the end of
+// the days-th day, earliest first. A place without coordinates has none.
+func (ms gtfsModeSearch) search(ctx context.Context, feed *GTFSFeed, from, to Location, fromRadius, toRadius float64, date time.Time, days int) []TransportOption {
+	fromPoint, okFrom := locationPoint(from)
+	toPoint, okTo := locationPoint(to)
+	if !okFrom || !okTo {
+		return nil
+	}
+
+	var options []TransportOption
+	for _, leg := range feed.DirectTrips(fromPoint, toPoint, fromRadius, toRadius, date, days, ms.routeTypes) {
+		options = append(options, feed.Option(leg, ms.mode, ms.locationType, ms.farePerKm))
+	}
+
+	LoggerFromContext(ctx).Debug("timetable search", slog.String("mode", ms.mode),
+		slog.String(logKeyOrigin, from.Name), slog.String(logKeyDestination, to.Name), slog.Int("departures", len(options)))
+	return options
+}
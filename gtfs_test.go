@@ -0,0 +1,222 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadTestFeed(t *testing.T) *GTFSFeed {
+	t.Helper()
+	feed, err := LoadGTFS(filepath.Join("testdata", "gtfs", "rail"))
+	require.NoError(t, err)
+	return feed
+}
+
+func TestLoadGTFS(t *testing.T) {
+	feed := loadTestFeed(t)
+	assert.Len(t, feed.Stops, 6)
+	assert.Len(t, feed.Routes, 4)
+	assert.Len(t, feed.Trips, 6)
+
+	trip := feed.Trips["av-03001"]
+	require.NotNil(t, trip)
+	assert.Equal(t, "Renfe", trip.Route.Agency.Name)
+	assert.Equal(t, "Europe/Madrid", trip.Route.Agency.Location.String())
+	require.Len(t, trip.StopTimes, 3)
+	assert.Equal(t, "GRX", trip.StopTimes[0].Stop.ID)
+	assert.Equal(t, 10*time.Hour+25*time.Minute, trip.StopTimes[1].Departure)
+
+	late := feed.Trips["av-03933"]
+	assert.Equal(t, 25*time.Hour+45*time.Minute, late.StopTimes[1].Arrival, "times past midnight")
+
+	price, currency, ok := feed.Fare(feed.Routes["av-bcn"])
+	assert.True(t, ok)
+	assert.Equal(t, 89.5, price)
+	assert.Equal(t, "EUR", currency)
+	_, _, ok = feed.Fare(feed.Routes["c1"])
+	assert.False(t, ok)
+
+	t.Run("Zip archive", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "rail.zip")
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		zw := zip.NewWriter(f)
+		files, err := filepath.Glob(filepath.Join("testdata", "gtfs", "rail", "*.txt"))
+		require.NoError(t, err)
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			require.NoError(t, err)
+			w, err := zw.Create(filepath.Base(file))
+			require.NoError(t, err)
+			_, err = w.Write(data)
+			require.NoError(t, err)
+		}
+		require.NoError(t, zw.Close())
+		require.NoError(t, f.Close())
+
+		feed, err := LoadGTFS(path)
+		require.NoError(t, err)
+		assert.Len(t, feed.Trips, 6)
+	})
+
+	t.Run("Missing path", func(t *testing.T) {
+		_, err := LoadGTFS(filepath.Join(t.TempDir(), "missing"))
+		assert.Error(t, err)
+	})
+}
+
+func TestParseGTFS_Errors(t *testing.T) {
+	valid := fstest.MapFS{
+		"agency.txt":     {Data: []byte("agency_id,agency_name,agency_timezone\na,A,UTC\n")},
+		"stops.txt":      {Data: []byte("stop_id,stop_name,stop_lat,stop_lon\ns1,One,1,1\ns2,Two,2,2\n")},
+		"routes.txt":     {Data: []byte("route_id,agency_id,route_type\nr,a,2\n")},
+		"trips.txt":      {Data: []byte("route_id,service_id,trip_id\nr,svc,t\n")},
+		"stop_times.txt": {Data: []byte("trip_id,arrival_time,departure_time,stop_id,stop_sequence\nt,08:00:00,08:00:00,s1,1\nt,09:00:00,09:00:00,s2,2\n")},
+		"calendar.txt":   {Data: []byte("service_id,monday,tuesday,wednesday,thursday,friday,saturday,sunday,start_date,end_date\nsvc,1,1,1,1,1,1,1,20260101,20261231\n")},
+	}
+	_, err := parseGTFS(valid)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name, file, data, expected string
+	}{
+		{"Missing stops", "stops.txt", "", "stops.txt"},
+		{"Bad timezone", "agency.txt", "agency_id,agency_name,agency_timezone\na,A,Mars/Olympus\n", "agency.txt"},
+		{"Bad coordinates", "stops.txt", "stop_id,stop_name,stop_lat,stop_lon\ns1,One,north,1\n", "stops.txt"},
+		{"Unknown route", "trips.txt", "route_id,service_id,trip_id\nx,svc,t\n", `unknown route_id "x"`},
+		{"Unknown stop", "stop_times.txt", "trip_id,arrival_time,departure_time,stop_id,stop_sequence\nt,08:00:00,08:00:00,s9,1\n", `unknown stop_id "s9"`},
+		{"Bad time", "stop_times.txt", "trip_id,arrival_time,departure_time,stop_id,stop_sequence\nt,8am,8am,s1,1\n", "stop_times.txt"},
+		{"No calendar", "calendar.txt", "", "calendar"},
+		{"Unknown vehicle", "vehicle_fares.txt", "route_id,vehicle_type,price,currency_type\nr,tank,10,EUR\n", `unknown vehicle_type "tank"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for name, file := range valid {
+				fsys[name] = file
+			}
+			if tc.data == "" {
+				delete(fsys, tc.file)
+			} else {
+				fsys[tc.file] = &fstest.MapFile{Data: []byte(tc.data)}
+			}
+			_, err := parseGTFS(fsys)
+			assert.ErrorContains(t, err, tc.expected)
+		})
+	}
+}
+
+func TestParseGTFSTime(t *testing.T) {
+	d, err := parseGTFSTime("7:05:30")
+	require.NoError(t, err)
+	assert.Equal(t, 7*time.Hour+5*time.Minute+30*time.Second, d)
+
+	d, err = parseGTFSTime("25:10:00")
+	require.NoError(t, err)
+	assert.Equal(t, 25*time.Hour+10*time.Minute, d)
+
+	for _, s := range []string{"", "07:00", "07:60:00", "aa:00:00"} {
+		_, err := parseGTFSTime(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestGTFSFeed_RunsOn(t *testing.T) {
+	feed := loadTestFeed(t)
+	trip := feed.Trips["av-03063"]
+	madrid := trip.Route.Agency.Location
+
+	assert.True(t, feed.RunsOn(trip, time.Date(2026, 6, 1, 0, 0, 0, 0, madrid)))
+	assert.False(t, feed.RunsOn(trip, time.Date(2026, 12, 25, 0, 0, 0, 0, madrid)), "removed by calendar_dates")
+	assert.False(t, feed.RunsOn(trip, time.Date(2027, 1, 4, 0, 0, 0, 0, madrid)), "after the calendar ends")
+}
+
+func TestGTFSFeed_DirectTrips(t *testing.T) {
+	feed := loadTestFeed(t)
+	madrid := LatLng{40.4168, -3.7038}
+	barcelona := LatLng{41.3874, 2.1686}
+	date := time.Date(2026, 6, 1, 8, 0, 0, 0, feed.Agencies["renfe"].Location)
+
+	legs := feed.DirectTrips(madrid, barcelona, 10000, 10000, date, 1, isRailRouteType)
+	require.Len(t, legs, 3)
+	assert.Equal(t, "av-03063", legs[0].Trip.ID)
+	assert.Equal(t, "av-03163", legs[1].Trip.ID)
+	assert.Equal(t, "av-03933", legs[2].Trip.ID)
+	assert.Equal(t, time.Date(2026, 6, 2, 1, 45, 0, 0, date.Location()), legs[2].Arrival())
+
+	t.Run("Departures before the date are left out", func(t *testing.T) {
+		legs := feed.DirectTrips(madrid, barcelona, 10000, 10000, date.Add(2*time.Hour), 1, isRailRouteType)
+		require.Len(t, legs, 2)
+		assert.Equal(t, "av-03163", legs[0].Trip.ID)
+	})
+
+	t.Run("Last train of the day", func(t *testing.T) {
+		legs := feed.DirectTrips(madrid, barcelona, 10000, 10000, date.Add(15*time.Hour), 1, isRailRouteType)
+		require.Len(t, legs, 1)
+		assert.Equal(t, "av-03933", legs[0].Trip.ID)
+		assert.Empty(t, feed.DirectTrips(madrid, barcelona, 10000, 10000, date.Add(15*time.Hour+45*time.Minute), 1, isRailRouteType), "not the next day's")
+
+		legs = feed.DirectTrips(madrid, barcelona, 10000, 10000, date.Add(15*time.Hour+45*time.Minute), 2, isRailRouteType)
+		require.Len(t, legs, 3, "the next day's when searching two days")
+		assert.Equal(t, time.Date(2026, 6, 2, 9, 0, 0, 0, date.Location()), legs[0].Departure())
+	})
+
+	t.Run("Calls in order", func(t *testing.T) {
+		airport := LatLng{40.4983, -3.5676}
+		legs := feed.DirectTrips(madrid, airport, 10000, 10000, date, 1, isRailRouteType)
+		require.Len(t, legs, 2)
+		assert.Equal(t, "av-03001", legs[0].Trip.ID)
+		assert.Equal(t, 1, legs[0].Board, "boards at Atocha, not Granada")
+		assert.Equal(t, "c1-1040", legs[1].Trip.ID)
+	})
+
+	t.Run("Route types", func(t *testing.T) {
+		granada := LatLng{37.1773, -3.5986}
+		legs := feed.DirectTrips(granada, madrid, 10000, 10000, date.Add(-3*time.Hour), 1, isBusRouteType)
+		require.Len(t, legs, 1)
+		assert.Equal(t, "bus-0600", legs[0].Trip.ID)
+	})
+
+	t.Run("No stops nearby", func(t *testing.T) {
+		assert.Empty(t, feed.DirectTrips(LatLng{48.8566, 2.3522}, barcelona, 10000, 10000, date, 1, isRailRouteType))
+	})
+}
+
+func TestGTFSFeed_Option(t *testing.T) {
+	feed := loadTestFeed(t)
+	day := time.Date(2026, 6, 1, 0, 0, 0, 0, feed.Agencies["renfe"].Location)
+
+	option := feed.Option(GTFSLeg{Trip: feed.Trips["av-03001"], Board: 0, Alight: 2, Day: day}, "train", "station", railFarePerKm)
+	assert.Equal(t, "train", option.Mode)
+	assert.Equal(t, "Renfe AVE", option.Provider)
+	assert.Equal(t, Location{Name: "Granada", Latitude: 37.1843, Longitude: -3.6123, Type: "station", Code: "GRX", TimeZone: "Europe/Madrid"}, option.From)
+	assert.Equal(t, "T4", option.To.Code)
+	assert.Equal(t, day.Add(7*time.Hour), option.Departure)
+	assert.Equal(t, day.Add(10*time.Hour+50*time.Minute), option.Arrival)
+	assert.Equal(t, 3*time.Hour+50*time.Minute, option.Duration)
+	assert.Equal(t, 45.0, option.Price)
+	assert.Len(t, option.Path, 3)
+	assert.InDelta(t, 372, option.Distance, 5, "along the stops")
+	assert.Equal(t, EstimateCO2(option), option.CO2)
+
+	t.Run("Estimated fare", func(t *testing.T) {
+		option := feed.Option(GTFSLeg{Trip: feed.Trips["c1-1040"], Board: 0, Alight: 1, Day: day}, "train", "station", railFarePerKm)
+		assert.Equal(t, "Renfe C1", option.Provider)
+		assert.Equal(t, "EUR", option.Currency)
+		assert.InDelta(t, option.Distance*railFarePerKm, option.Price, 0.01)
+	})
+
+	t.Run("Fare in another currency", func(t *testing.T) {
+		feed := loadTestFeed(t)
+		feed.fares["av-grx"] = gtfsFare{price: 40, currency: "GBP"}
+		option := feed.Option(GTFSLeg{Trip: feed.Trips["av-03001"], Board: 0, Alight: 2, Day: day}, "train", "station", railFarePerKm)
+		assert.Equal(t, "EUR", option.Currency)
+		assert.InDelta(t, option.Distance*railFarePerKm, option.Price, 0.01, "estimated rather than mixed into EUR totals")
+	})
+}
@@ -3,62 +3,223 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 )
 
+// handleSearchRoutes handles GET /search?origin=...&destination=...&date=...
+//
+// Without extra parameters the full, price-sorted route list is returned;
+// sort=duration or sort=co2 orders it by travel time or emissions instead,
+// and vehicle=car (motorcycle, van, bicycle) prices taking it on ferries.
+// Passing limit and/or cursor returns a RoutePage instead, and stream=ndjson
+// or stream=sse (or the matching Accept header) pushes routes as each origin
+// airport's search completes. format=geojson or format=kml draws the routes
+// for a map instead of returning JSON. The results are kept under the search
+// ID returned in X-Search-ID, for GET /search/{id}/ics; a cursor pages
+// through those stored results rather than searching again.
 func (tf *TravelFinder) handleSearchRoutes(w http.ResponseWriter, r *http.Request) {
 	origin := r.URL.Query().Get("origin")
 	destination := r.URL.Query().Get("destination")
 	dateStr := r.URL.Query().Get("date")
 
 	if origin == "" || destination == "" || dateStr == "" {
-		http.Error(w, "Missing required query parameters", http.StatusBadRequest)
+		writeProblem(w, invalidInput("origin, destination and date are required"))
 		return
 	}
 
 	date, err := time.Parse("2006-01-02", dateStr)
 	if err != nil {
-		http.Error(w, "Invalid date format. Use YYYY-MM-DD", http.StatusBadRequest)
+		writeProblem(w, invalidInput("invalid date format, use YYYY-MM-DD"))
 		return
 	}
 
-	routes, err := tf.FindRoutes(origin, destination, date)
+	sortBy := r.URL.Query().Get("sort")
+	switch {
+	case sortBy == "":
+		sortBy = "price"
+	case routeOrders[sortBy] == nil:
+		writeProblem(w, invalidInput("unsupported sort %q (use price, duration or co2)", sortBy))
+		return
+	case r.URL.Query().Get("stream") != "":
+		writeProblem(w, invalidInput("streamed routes can't be sorted"))
+		return
+	}
+
+	vehicle := r.URL.Query().Get("vehicle")
+	if vehicle != "" && !slices.Contains(vehicleTypes, vehicle) {
+		writeProblem(w, invalidInput("unsupported vehicle %q (use car, motorcycle, van or bicycle)", vehicle))
+		return
+	}
+
+	// Map formats need every route at once, so they are never streamed
+	mapFormat := r.URL.Query().Get("format")
+	switch {
+	case mapFormat == "" || mapFormat == "json":
+		mapFormat = ""
+	case routeMapFormats[mapFormat].write == nil:
+		writeProblem(w, invalidInput("unsupported format %q (use json, geojson or kml)", mapFormat))
+		return
+	case r.URL.Query().Get("stream") != "":
+		writeProblem(w, invalidInput("format=%s can't be streamed", mapFormat))
+		return
+	}
+
+	format, err := streamFormat(r)
+	if err != nil {
+		writeProblem(w, err)
+		return
+	}
+
+	if format != "" && mapFormat == "" {
+		// Streaming asked for with the Accept header rather than stream=
+		if r.URL.Query().Get("sort") != "" {
+			writeProblem(w, invalidInput("streamed routes can't be sorted"))
+			return
+		}
+		streamer, err := newRouteStreamer(w, format)
+		if err != nil {
+			writeProblem(w, err)
+			return
+		}
+		searchID := tf.searches.Create(searchOwner(r))
+		w.Header().Set("X-Search-ID", searchID)
+		streamer.Finish(tf.StreamRoutes(r.Context(), origin, destination, date, func(routes []Route) error {
+			if vehicle != "" {
+				if routes = AddVehicle(routes, vehicle); len(routes) == 0 {
+					return nil
+				}
+			}
+			tf.searches.Append(searchID, routes)
+			return streamer.WriteRoutes(routes)
+		}))
+		return
+	}
+
+	limitStr := r.URL.Query().Get("limit")
+	cursor := r.URL.Query().Get("cursor")
+	paginate := limitStr != "" || cursor != ""
+
+	limit, offset, searchID, err := parsePageParams(limitStr, cursor)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error finding routes: %v", err), http.StatusInternalServerError)
+		writeProblem(w, err)
+		return
+	}
+
+	var routes []Route
+	if searchID != "" {
+		var ok bool
+		if routes, ok = tf.searches.Get(searchID, searchOwner(r)); !ok {
+			writeProblem(w, fmt.Errorf("%w: search %s is unknown or has expired, search again without a cursor", ErrNotFound, searchID))
+			return
+		}
+	} else {
+		routes, err = tf.FindRoutes(r.Context(), origin, destination, date)
+		if err != nil {
+			writeProblem(w, fmt.Errorf("error finding routes: %w", err))
+			return
+		}
+		if vehicle != "" {
+			routes = AddVehicle(routes, vehicle)
+		}
+		SortRoutes(routes, sortBy)
+		searchID = tf.searches.Save(searchOwner(r), routes)
+	}
+
+	w.Header().Set("X-Search-ID", searchID)
+	var page RoutePage
+	if paginate {
+		page = paginateRoutes(searchID, routes, limit, offset)
+	}
+
+	if mapFormat != "" {
+		// With limit or cursor only the page is drawn
+		if paginate {
+			routes = page.Routes
+		}
+		w.Header().Set("Content-Type", routeMapFormats[mapFormat].contentType)
+		routeMapFormats[mapFormat].write(w, routes)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	if paginate {
+		json.NewEncoder(w).Encode(page)
+		return
+	}
 	json.NewEncoder(w).Encode(routes)
 }
 
+// handleSearchICS handles GET /search/{id}/ics?route=N, exporting route N
+// (1-based, default 1, in the order the search returned them) of a recent
+// search as an iCalendar file
+func (tf *TravelFinder) handleSearchICS(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	routes, ok := tf.searches.Get(id, searchOwner(r))
+	if !ok {
+		writeProblem(w, fmt.Errorf("%w: search %s is unknown or has expired", ErrNotFound, id))
+		return
+	}
+
+	index := 1
+	if routeStr := r.URL.Query().Get("route"); routeStr != "" {
+		parsed, err := strconv.Atoi(routeStr)
+		if err != nil || parsed < 1 {
+			writeProblem(w, invalidInput("route must be a positive number"))
+			return
+		}
+		index = parsed
+	}
+	if index > len(routes) {
+		writeProblem(w, fmt.Errorf("%w: search %s has %d routes", ErrNotFound, id, len(routes)))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="route-%s-%d.ics"`, id, index))
+	route := tf.timeZones.AddTimeZones(r.Context(), routes[index-1])
+	if err := WriteICS(w, route, fmt.Sprintf("%s-%d", id, index), time.Now()); err != nil {
+		// The status is already sent, so the failure can only be logged
+		LoggerFromContext(r.Context()).Warn("calendar export failed", slog.String("search_id", id), errorAttr(err))
+	}
+}
+
+// searchOwner identifies who a stored search belongs to: the ID of the API
+// key that authorized the request, or "" when authentication is off
+func searchOwner(r *http.Request) string {
+	key, _ := APIKeyFromContext(r.Context())
+	return key.ID
+}
+
 // handleNearbyAirports handles GET /airports?location=...&radius=...
 func (tf *TravelFinder) handleNearbyAirports(w http.ResponseWriter, r *http.Request) {
 	location := r.URL.Query().Get("location")
 	radiusStr := r.URL.Query().Get("radius")
 
 	if location == "" {
-		http.Error(w, "Missing location parameter", http.StatusBadRequest)
+		writeProblem(w, invalidInput("location is required"))
 		return
 	}
 
-	radius := tf.config.DefaultRadius
+	radius := tf.config.Load().DefaultRadius
 	if radiusStr != "" {
 		if parsed, err := parseInt(radiusStr); err == nil {
 			radius = parsed
 		}
 	}
 
-	loc, err := tf.airportSvc.GeocodeLocation(location)
+	loc, err := tf.airportSvc.GeocodeLocation(r.Context(), location)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Geocoding failed: %v", err), http.StatusInternalServerError)
+		writeProblem(w, fmt.Errorf("geocoding failed: %w", err))
 		return
 	}
 
-	airports, err := tf.airportSvc.FindNearbyAirports(loc, radius)
+	airports, err := tf.airportSvc.FindNearbyAirports(r.Context(), loc, radius)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Error finding airports: %v", err), http.StatusInternalServerError)
+		writeProblem(w, fmt.Errorf("error finding airports: %w", err))
 		return
 	}
 
@@ -1,63 +1,71 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestHandleSearchRoutes(t *testing.T) {
 	os.Setenv("GOOGLE_MAPS_API_KEY", "test-key")
-	config := LoadConfig()
+	config, err := LoadConfig()
+	require.NoError(t, err)
 	tf := NewTravelFinder(config)
+	tf.google.baseURL = newStubGoogleClient(t, googleStatusHandler("REQUEST_DENIED", "")).baseURL
 
 	req := httptest.NewRequest("GET", "/search?origin=Madrid&destination=Barcelona&date=2024-07-01", nil)
 	w := httptest.NewRecorder()
 	tf.handleSearchRoutes(w, req)
 	resp := w.Result()
-	// The real API call will fail with a mock key, so expect 500 error
-	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	// Google rejects the mock key, so expect an upstream error
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
 }
 
 func TestHandleNearbyAirports(t *testing.T) {
 	os.Setenv("GOOGLE_MAPS_API_KEY", "test-key")
-	config := LoadConfig()
+	config, err := LoadConfig()
+	require.NoError(t, err)
 	tf := NewTravelFinder(config)
+	tf.google.baseURL = newStubGoogleClient(t, googleStatusHandler("REQUEST_DENIED", "")).baseURL
 
 	req := httptest.NewRequest("GET", "/airports?location=Madrid&radius=30000", nil)
 	w := httptest.NewRecorder()
 	tf.handleNearbyAirports(w, req)
 	resp := w.Result()
-	// The real API call will fail with a mock key, so expect 500 error
-	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	// Google rejects the mock key, so expect an upstream error
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
 }
 
 func TestAirportService_GeocodeLocation(t *testing.T) {
-	as := &AirportService{config: Config{GoogleMapsAPIKey: "test-key"}, client: &http.Client{}}
-	_, err := as.GeocodeLocation("Madrid")
+	as := NewAirportService(NewConfigStore(Config{GoogleMapsAPIKey: "test-key"}), newStubGoogleClient(t, googleStatusHandler("REQUEST_DENIED", "")))
+	_, err := as.GeocodeLocation(context.Background(), "Madrid")
 	assert.Error(t, err) // Should error with mock key
 }
 
 func TestFlightService_SearchFlights(t *testing.T) {
-	fs := &FlightService{config: Config{}, client: &http.Client{}}
+	fs := &FlightService{config: NewConfigStore(Config{}), client: &http.Client{}}
 	from := Location{Name: "Madrid", Code: "MAD"}
 	to := Location{Name: "Barcelona", Code: "BCN"}
 	date := time.Now()
-	options, err := fs.SearchFlights(from, to, date)
+	options, err := fs.SearchFlights(context.Background(), from, to, date)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, options)
 }
 
 func TestTransportService_GetGroundTransport(t *testing.T) {
-	ts := &TransportService{config: Config{GoogleMapsAPIKey: "test-key"}, client: &http.Client{}}
+	ts := NewTransportService(NewConfigStore(Config{GoogleMapsAPIKey: "test-key"}), newStubGoogleClient(t, googleStatusHandler("REQUEST_DENIED", "")))
 	from := Location{Name: "Madrid", Latitude: 40.4168, Longitude: -3.7038}
 	to := Location{Name: "Barcelona", Latitude: 41.3851, Longitude: 2.1734}
 	date := time.Now()
-	_, err := ts.GetGroundTransport(from, to, date)
+	_, err := ts.GetGroundTransport(context.Background(), from, to, date)
 	// Accept both error and nil, since the mock implementation may not always error
 	if err == nil {
 		t.Log("No error returned, but this may be expected with mock data.")
@@ -65,3 +73,242 @@ func TestTransportService_GetGroundTransport(t *testing.T) {
 		assert.Error(t, err)
 	}
 }
+
+func TestHandleSearchRoutes_InvalidPagination(t *testing.T) {
+	tf := NewTravelFinder(Config{GoogleMapsAPIKey: "test-key"})
+
+	req := httptest.NewRequest("GET", "/search?origin=Madrid&destination=Barcelona&date=2024-07-01&limit=-1", nil)
+	w := httptest.NewRecorder()
+	tf.handleSearchRoutes(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+}
+
+func TestHandleSearchRoutes_InvalidStreamFormat(t *testing.T) {
+	tf := NewTravelFinder(Config{GoogleMapsAPIKey: "test-key"})
+
+	req := httptest.NewRequest("GET", "/search?origin=Madrid&destination=Barcelona&date=2024-07-01&stream=xml", nil)
+	w := httptest.NewRecorder()
+	tf.handleSearchRoutes(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Result().StatusCode)
+	assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+}
+
+func TestHandleSearchRoutes_MissingParameters(t *testing.T) {
+	tf := NewTravelFinder(Config{GoogleMapsAPIKey: "test-key"})
+
+	req := httptest.NewRequest("GET", "/search?origin=Madrid", nil)
+	w := httptest.NewRecorder()
+	tf.handleSearchRoutes(w, req)
+
+	var problem Problem
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&problem))
+	assert.Equal(t, http.StatusBadRequest, problem.Status)
+	assert.Equal(t, "invalid_input", problem.Code)
+}
+
+func TestHandleSearchICS(t *testing.T) {
+	tf := newStubSearchFinder(t)
+	router := NewRouter(Config{}, tf, nil)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/search?origin=Granada&destination=Tel%20Aviv&date=2024-07-01", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	searchID := w.Header().Get("X-Search-ID")
+	require.NotEmpty(t, searchID)
+
+	t.Run("Export", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/search/"+searchID+"/ics?route=2", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Header().Get("Content-Disposition"), "route-"+searchID+"-2.ics")
+		assert.Equal(t, 3, strings.Count(w.Body.String(), "BEGIN:VEVENT"), "taxi and two connecting flights")
+		assert.Contains(t, w.Body.String(), "UID:"+searchID+"-2-1@travel-routes")
+		assert.Contains(t, w.Body.String(), "TZID:Europe/Madrid\r\n")
+		assert.Contains(t, w.Body.String(), "DTEND;TZID=Asia/Jerusalem:")
+	})
+
+	t.Run("Paginated results carry the ID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/search?origin=Granada&destination=Tel%20Aviv&date=2024-07-01&limit=1", nil))
+		var page RoutePage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		assert.Equal(t, w.Header().Get("X-Search-ID"), page.SearchID)
+		require.NotEmpty(t, page.NextCursor)
+
+		stored := len(tf.searches.order)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/search?origin=Granada&destination=Tel%20Aviv&date=2024-07-01&limit=1&cursor="+page.NextCursor, nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		var next RoutePage
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &next))
+		assert.Equal(t, page.SearchID, next.SearchID, "later pages come from the same search")
+		assert.Equal(t, page.SearchID, w.Header().Get("X-Search-ID"))
+		assert.Equal(t, stored, len(tf.searches.order), "nothing is searched or stored again")
+		assert.NotEqual(t, page.Routes[0].Description, next.Routes[0].Description)
+	})
+
+	for _, tc := range []struct {
+		name, path string
+		status     int
+	}{
+		{"Unknown search", "/search/nope/ics", http.StatusNotFound},
+		{"Route out of range", "/search/" + searchID + "/ics?route=9", http.StatusNotFound},
+		{"Invalid route", "/search/" + searchID + "/ics?route=first", http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+			assert.Equal(t, tc.status, w.Code)
+			assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestHandleSearchICS_Owner(t *testing.T) {
+	ks := newTestKeyStore(t)
+	_, owner, err := ks.Issue("owner", 0, 0)
+	require.NoError(t, err)
+	_, other, err := ks.Issue("other", 0, 0)
+	require.NoError(t, err)
+	router := NewRouter(Config{}, newStubSearchFinder(t), ks)
+	get := func(path, secret string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("X-API-Key", secret)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("/search?origin=Granada&destination=Tel%20Aviv&date=2024-07-01&limit=1", owner)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page RoutePage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+
+	assert.Equal(t, http.StatusOK, get("/search/"+page.SearchID+"/ics", owner).Code)
+	assert.Equal(t, http.StatusNotFound, get("/search/"+page.SearchID+"/ics", other).Code)
+	assert.Equal(t, http.StatusNotFound, get("/search?origin=Granada&destination=Tel%20Aviv&date=2024-07-01&cursor="+page.NextCursor, other).Code)
+}
+
+func TestHandleSearchRoutes_MapFormats(t *testing.T) {
+	tf := newStubSearchFinder(t)
+	router := NewRouter(Config{}, tf, nil)
+	search := "/search?origin=Granada&destination=Tel%20Aviv&date=2024-07-01"
+
+	t.Run("GeoJSON", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", search+"&format=geojson", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/geo+json", w.Header().Get("Content-Type"))
+		assert.NotEmpty(t, w.Header().Get("X-Search-ID"))
+
+		var collection struct {
+			Features []json.RawMessage `json:"features"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &collection))
+		assert.Len(t, collection.Features, 11, "2 + 3 + 3 + 3 segments")
+	})
+
+	t.Run("KML page", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", search+"&format=kml&limit=1", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/vnd.google-earth.kml+xml", w.Header().Get("Content-Type"))
+		assert.Equal(t, 1, strings.Count(w.Body.String(), "<Folder>"))
+	})
+
+	for _, tc := range []struct{ name, query, detail string }{
+		{"Unknown format", "&format=gpx", "(use json, geojson or kml)"},
+		{"Streamed", "&format=geojson&stream=ndjson", "format=geojson can't be streamed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", search+tc.query, nil))
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tc.detail)
+		})
+	}
+}
+
+func TestHandleSearchRoutes_Vehicle(t *testing.T) {
+	date := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	tf := newStubSearchFinder(t)
+	tf.ferries = stubFerries{"Ben Gurion Airport (TLV)": {{Mode: "ferry", Departure: date.Add(20 * time.Hour),
+		Arrival: date.Add(21 * time.Hour), Price: 27, Currency: "EUR", VehiclePrices: map[string]float64{"car": 70}}}}
+	router := NewRouter(Config{}, tf, nil)
+	search := "/search?origin=Granada&destination=Tel%20Aviv&date=2024-07-01"
+
+	ferries := func(routes []Route) (prices []float64) {
+		for _, route := range routes {
+			for _, segment := range route.Segments {
+				if segment.Mode == "ferry" {
+					prices = append(prices, segment.Price)
+				}
+			}
+		}
+		return prices
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", search+"&vehicle=car", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var routes []Route
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &routes))
+	require.NotEmpty(t, ferries(routes))
+	for _, price := range ferries(routes) {
+		assert.Equal(t, 97.0, price)
+	}
+
+	t.Run("Vehicle not taken", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", search+"&vehicle=van&stream=ndjson", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), `"ferry"`)
+		assert.Contains(t, w.Body.String(), `"flight"`)
+	})
+
+	t.Run("Unknown vehicle", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", search+"&vehicle=tank", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "(use car, motorcycle, van or bicycle)")
+	})
+}
+
+func TestHandleSearchRoutes_Sort(t *testing.T) {
+	tf := newStubSearchFinder(t)
+	router := NewRouter(Config{}, tf, nil)
+	search := "/search?origin=Granada&destination=Tel%20Aviv&date=2024-07-01"
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", search+"&sort=co2&limit=2", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var page RoutePage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Routes, 2)
+	assert.LessOrEqual(t, page.Routes[0].TotalCO2, page.Routes[1].TotalCO2)
+	assert.Positive(t, page.Routes[0].TotalCO2)
+	assert.Positive(t, page.Routes[0].Segments[1].CO2)
+
+	for _, tc := range []struct{ name, query, detail string }{
+		{"Unknown order", "&sort=stops", "(use price, duration or co2)"},
+		{"Streamed", "&sort=co2&stream=ndjson", "streamed routes can't be sorted"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", search+tc.query, nil))
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tc.detail)
+		})
+	}
+
+	t.Run("Streamed by Accept header", func(t *testing.T) {
+		req := httptest.NewRequest("GET", search+"&sort=co2", nil)
+		req.Header.Set("Accept", "application/x-ndjson")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "streamed routes can't be sorted")
+	})
+}
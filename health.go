@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check reports whether one dependency is usable
+type Check func(ctx context.Context) error
+
+// CheckResult is the outcome of one check in a readiness report
+type CheckResult struct {
+	Status     string    `json:"status"` // "ok" or "fail"
+	Critical   bool      `json:"critical"`
+	Error      string    `json:"error,omitempty"` // checkUnavailable on failure
+	CheckedAt  time.Time `json:"checked_at"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+// HealthReport is the body of /readyz. Status is "ok" when every check
+// passes, "degraded" when only non-critical checks fail and "fail" otherwise.
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+// checkUnavailable is all /readyz says about a failing check; the cause is
+// logged, since the endpoint is public and errors can name internals
+const checkUnavailable = "unavailable"
+
+type healthCheck struct {
+	name     string
+	critical bool
+	check    Check
+}
+
+// HealthChecker runs the registered dependency checks for /readyz. Any part
+// of the service can register a check for what it depends on.
+type HealthChecker struct {
+	timeout time.Duration
+
+	mu     sync.Mutex
+	checks []healthCheck
+}
+
+// NewHealthChecker creates a checker that gives each check at most timeout
+// to answer (0 = no limit beyond the request's own deadline)
+func NewHealthChecker(timeout time.Duration) *HealthChecker {
+	return &HealthChecker{timeout: timeout}
+}
+
+// Register adds a check. A failing critical check makes the service not
+// ready; a failing non-critical one only marks it degraded.
+func (hc *HealthChecker) Register(name string, critical bool, check Check) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.checks = append(hc.checks, healthCheck{name: name, critical: critical, check: check})
+}
+
+// Run executes every check concurrently and summarizes the results
+func (hc *HealthChecker) Run(ctx context.Context) HealthReport {
+	hc.mu.Lock()
+	checks := append([]healthCheck(nil), hc.checks...)
+	hc.mu.Unlock()
+
+	results := make([]CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c healthCheck) {
+			defer wg.Done()
+			results[i] = hc.runCheck(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: "ok", Checks: make(map[string]CheckResult, len(checks))}
+	for i, c := range checks {
+		result := results[i]
+		report.Checks[c.name] = result
+		if result.Status == "ok" {
+			continue
+		}
+		if c.critical {
+			report.Status = "fail"
+		} else if report.Status == "ok" {
+			report.Status = "degraded"
+		}
+	}
+
+	return report
+}
+
+func (hc *HealthChecker) runCheck(ctx context.Context, c healthCheck) CheckResult {
+	if hc.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hc.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := c.check(ctx)
+
+	result := CheckResult{
+		Status:     "ok",
+		Critical:   c.critical,
+		CheckedAt:  start.UTC(),
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = "fail"
+		result.Error = checkUnavailable
+		LoggerFromContext(ctx).Warn("health check failed",
+			slog.String("check", c.name), slog.Bool("critical", c.critical), errorAttr(err))
+	}
+	return result
+}
+
+// handleLiveness answers /healthz: the process is up and serving requests.
+// It deliberately checks no dependencies, so an upstream outage doesn't get
+// the service restarted.
+func (hc *HealthChecker) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// handleReadiness answers /readyz with the per-dependency breakdown, using
+// 503 when a critical check fails
+func (hc *HealthChecker) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	report := hc.Run(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status == "fail" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// cachedCheck remembers a passing check for ttl, so frequent readiness
+// probes don't turn into a stream of upstream calls. Failures aren't kept:
+// the next probe tries again.
+type cachedCheck struct {
+	ttl     time.Duration
+	timeout time.Duration
+	check   Check
+	now     func() time.Time
+
+	mu       sync.Mutex
+	passedAt time.Time
+	running  *checkRun
+}
+
+// checkRun is one run of a cached check; done is closed once err is set
+type checkRun struct {
+	done chan struct{}
+	err  error
+}
+
+// maxDetachedCheck bounds a cached check's run when no timeout is set
+const maxDetachedCheck = 30 * time.Second
+
+// CachedCheck wraps check so it passes without running for ttl after it
+// last passed. The check runs on its own context with the given timeout
+// (0 = 30s), so a caller giving up doesn't cancel the run the others are
+// waiting for; concurrent callers share one run.
+func CachedCheck(ttl, timeout time.Duration, check Check) Check {
+	cc := &cachedCheck{ttl: ttl, timeout: timeout, check: check, now: time.Now}
+	return cc.run
+}
+
+func (cc *cachedCheck) run(ctx context.Context) error {
+	cc.mu.Lock()
+	if !cc.passedAt.IsZero() && cc.now().Sub(cc.passedAt) < cc.ttl {
+		cc.mu.Unlock()
+		return nil
+	}
+	run := cc.running
+	if run == nil {
+		run = &checkRun{done: make(chan struct{})}
+		cc.running = run
+		go cc.probe(run)
+	}
+	cc.mu.Unlock()
+
+	select {
+	case <-run.done:
+		return run.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (cc *cachedCheck) probe(run *checkRun) {
+	timeout := cc.timeout
+	if timeout <= 0 {
+		timeout = maxDetachedCheck
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	run.err = cc.check(ctx)
+
+	cc.mu.Lock()
+	if run.err == nil {
+		cc.passedAt = cc.now()
+	}
+	cc.running = nil
+	cc.mu.Unlock()
+	close(run.done)
+}
+
+// configCheck reports the validation errors of the live configuration, so
+// readiness follows reloads
+func configCheck(store *ConfigStore) Check {
+	return func(ctx context.Context) error {
+		return store.Load().Validate()
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthChecker_Run(t *testing.T) {
+	ok := func(ctx context.Context) error { return nil }
+	broken := func(ctx context.Context) error { return errors.New("broken") }
+
+	hc := NewHealthChecker(time.Second)
+	hc.Register("config", true, ok)
+	report := hc.Run(context.Background())
+	assert.Equal(t, "ok", report.Status)
+	assert.Equal(t, "ok", report.Checks["config"].Status)
+
+	hc.Register("optional", false, broken)
+	report = hc.Run(context.Background())
+	assert.Equal(t, "degraded", report.Status)
+	assert.Equal(t, "unavailable", report.Checks["optional"].Error)
+
+	hc.Register("google", true, broken)
+	report = hc.Run(context.Background())
+	assert.Equal(t, "fail", report.Status)
+	assert.Len(t, report.Checks, 3)
+}
+
+func TestHealthChecker_Timeout(t *testing.T) {
+	hc := NewHealthChecker(10 * time.Millisecond)
+	hc.Register("slow", true, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	buf := captureLogs(t)
+	report := hc.Run(context.Background())
+	assert.Equal(t, "fail", report.Status)
+	assert.Equal(t, "unavailable", report.Checks["slow"].Error)
+	assert.Contains(t, buf.String(), "deadline exceeded", "the cause is logged")
+}
+
+func TestCachedCheck(t *testing.T) {
+	calls := 0
+	var fail error
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	cc := &cachedCheck{
+		ttl: time.Minute,
+		now: func() time.Time { return now },
+		check: func(ctx context.Context) error {
+			calls++
+			return fail
+		},
+	}
+
+	// Failures are retried on every call
+	fail = errors.New("down")
+	assert.EqualError(t, cc.run(context.Background()), "down")
+	assert.EqualError(t, cc.run(context.Background()), "down")
+	assert.Equal(t, 2, calls)
+
+	// A pass is reused for ttl
+	fail = nil
+	assert.NoError(t, cc.run(context.Background()))
+	now = now.Add(30 * time.Second)
+	assert.NoError(t, cc.run(context.Background()))
+	assert.Equal(t, 3, calls)
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, cc.run(context.Background()))
+	assert.Equal(t, 4, calls)
+}
+
+func TestCachedCheck_Detached(t *testing.T) {
+	release := make(chan struct{})
+	calls := 0
+	check := CachedCheck(time.Minute, time.Second, func(ctx context.Context) error {
+		calls++
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	// A caller giving up doesn't cancel the run, and isn't cached
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, check(ctx), context.Canceled)
+
+	close(release)
+	assert.NoError(t, check(context.Background()))
+	assert.NoError(t, check(context.Background()))
+	assert.Equal(t, 1, calls, "the later caller waits for the run already going")
+}
+
+func TestConfigCheck(t *testing.T) {
+	config := DefaultConfig()
+	config.GoogleMapsAPIKey = "key"
+	store := NewConfigStore(config)
+	check := configCheck(store)
+	assert.NoError(t, check(context.Background()))
+
+	store.Store(DefaultConfig())
+	assert.ErrorContains(t, check(context.Background()), "google_maps_api_key is required", "a reload is checked")
+}
+
+func TestGoogleClient_Probe(t *testing.T) {
+	gc := newStubGoogleClient(t, googleStatusHandler("ZERO_RESULTS", ""))
+	assert.NoError(t, gc.Probe(context.Background()))
+
+	gc = newStubGoogleClient(t, googleStatusHandler("REQUEST_DENIED", "The provided API key is invalid."))
+	assert.ErrorIs(t, gc.Probe(context.Background()), ErrUpstream)
+}
+
+func TestRouter_HealthEndpoints(t *testing.T) {
+	config := DefaultConfig()
+	config.GoogleMapsAPIKey = "test-key"
+
+	t.Run("Liveness ignores dependencies", func(t *testing.T) {
+		tf := NewTravelFinder(Config{})
+		w := httptest.NewRecorder()
+		NewRouter(Config{}, tf, nil).ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+	})
+
+	t.Run("Ready", func(t *testing.T) {
+		tf := NewTravelFinder(config)
+		tf.google.baseURL = newStubGoogleClient(t, googleStatusHandler("ZERO_RESULTS", "")).baseURL
+
+		w := httptest.NewRecorder()
+		NewRouter(config, tf, nil).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var report HealthReport
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, "ok", report.Status)
+		assert.Equal(t, "ok", report.Checks["google"].Status)
+		assert.Equal(t, "ok", report.Checks["config"].Status)
+	})
+
+	t.Run("Invalid key is not ready", func(t *testing.T) {
+		tf := NewTravelFinder(config)
+		tf.google.baseURL = newStubGoogleClient(t, googleStatusHandler("REQUEST_DENIED", "The provided API key is invalid.")).baseURL
+
+		w := httptest.NewRecorder()
+		NewRouter(config, tf, nil).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+		var report HealthReport
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, "fail", report.Status)
+		assert.Equal(t, "fail", report.Checks["google"].Status)
+		assert.Equal(t, "unavailable", report.Checks["google"].Error)
+		assert.NotContains(t, w.Body.String(), "REQUEST_DENIED")
+	})
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/walidBarakehe/travel-routes/renderer"
+)
+
+// icsTimeFormat writes times in UTC, for the stamp and for places whose
+// time zone isn't known
+const icsTimeFormat = "20060102T150405Z"
+
+// icsLocalFormat writes local times, whose zone is named by a TZID
+// parameter and described by a VTIMEZONE component
+const icsLocalFormat = "20060102T150405"
+
+// modeLabels are the event titles for each transport mode
+var modeLabels = map[string]string{
+	"flight":           "Flight",
+	"taxi":             "Taxi",
+	"public_transport": "Public transport",
+	"train":            "Train",
+	"bus":              "Bus",
+	"ferry":            "Ferry",
+}
+
+// modeLabel is the display name of a mode, e.g. "Flight"
+func modeLabel(mode string) string {
+	if label, ok := modeLabels[mode]; ok {
+		return label
+	}
+	return mode
+}
+
+// WriteICS writes route as an iCalendar file with one event per segment.
+// uid makes the event UIDs unique and stable, so importing the same route
+// twice updates the events instead of duplicating them. Departures are
+// written in the time zone of where they leave from and arrivals in that of
+// where they arrive, in UTC when it isn't known.
+func WriteICS(w io.Writer, route Route, uid string, stamp time.Time) error {
+	bw := bufio.NewWriter(w)
+	line := func(name, value string) {
+		writeICSLine(bw, name+":"+value)
+	}
+	timeLine := func(name string, t time.Time, zone *time.Location) {
+		if zone == nil {
+			line(name, t.UTC().Format(icsTimeFormat))
+			return
+		}
+		line(name+";TZID="+zone.String(), t.In(zone).Format(icsLocalFormat))
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//travel-routes//route export//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", "PUBLISH")
+
+	zones := icsZones(route.Segments)
+	for _, zone := range zones {
+		writeVTimezone(line, zone)
+	}
+
+	for i, segment := range route.Segments {
+		line("BEGIN", "VEVENT")
+		line("UID", fmt.Sprintf("%s-%d@travel-routes", uid, i+1))
+		line("DTSTAMP", stamp.UTC().Format(icsTimeFormat))
+		timeLine("DTSTART", segment.Departure, zoneLocation(segment.From))
+		timeLine("DTEND", segment.Arrival, zoneLocation(segment.To))
+		line("SUMMARY", icsText(fmt.Sprintf("%s %s → %s", modeLabel(segment.Mode), locationLabel(segment.From), locationLabel(segment.To))))
+		line("LOCATION", icsText(segment.From.Name))
+		if segment.From.Latitude != 0 || segment.From.Longitude != 0 {
+			line("GEO", fmt.Sprintf("%.6f;%.6f", segment.From.Latitude, segment.From.Longitude))
+		}
+
+		description := []string{
+			fmt.Sprintf("From: %s", segment.From.Name),
+			fmt.Sprintf("To: %s", segment.To.Name),
+			fmt.Sprintf("Provider: %s", segment.Provider),
+			fmt.Sprintf("Price: %s", renderer.FormatPrice(segment.Price, segment.Currency)),
+			fmt.Sprintf("Segment %d of %d: %s", i+1, len(route.Segments), route.Description),
+		}
+		if segment.BookingURL != "" {
+			description = append(description, "Booking: "+segment.BookingURL)
+			line("URL", segment.BookingURL)
+		}
+		line("DESCRIPTION", icsText(strings.Join(description, "\n")))
+		line("TRANSP", "OPAQUE")
+		line("END", "VEVENT")
+	}
+
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// zoneLocation loads a place's time zone, nil when it isn't known
+func zoneLocation(loc Location) *time.Location {
+	if loc.TimeZone == "" {
+		return nil
+	}
+	zone, err := time.LoadLocation(loc.TimeZone)
+	if err != nil || zone == time.UTC {
+		return nil
+	}
+	return zone
+}
+
+// icsZone is a time zone used by a calendar and the span of the times
+// written in it
+type icsZone struct {
+	location    *time.Location
+	first, last time.Time
+}
+
+// icsZones lists the zones the segments' times are written in, by name
+func icsZones(segments []TransportOption) []icsZone {
+	byName := make(map[string]*icsZone)
+	add := func(loc Location, t time.Time) {
+		zone := zoneLocation(loc)
+		if zone == nil {
+			return
+		}
+		z, ok := byName[zone.String()]
+		if !ok {
+			z = &icsZone{location: zone, first: t, last: t}
+			byName[zone.String()] = z
+		}
+		if t.Before(z.first) {
+			z.first = t
+		}
+		if t.After(z.last) {
+			z.last = t
+		}
+	}
+	for _, segment := range segments {
+		add(segment.From, segment.Departure)
+		add(segment.To, segment.Arrival)
+	}
+
+	zones := make([]icsZone, 0, len(byName))
+	for _, name := range slices.Sorted(maps.Keys(byName)) {
+		zones = append(zones, *byName[name])
+	}
+	return zones
+}
+
+// writeVTimezone describes a zone with one observance per offset in force
+// between its first and last time, which is all a calendar needs to place
+// them (RFC 5545 section 3.6.5)
+func writeVTimezone(line func(name, value string), zone icsZone) {
+	line("BEGIN", "VTIMEZONE")
+	line("TZID", zone.location.String())
+	for t := zone.first.In(zone.location); ; {
+		name, offset := t.Zone()
+		start, end := t.ZoneBounds()
+
+		kind := "STANDARD"
+		if t.IsDST() {
+			kind = "DAYLIGHT"
+		}
+		// An observance starts in the local time of the one before it
+		begin, from := "19700101T000000", offset
+		if !start.IsZero() {
+			_, from = start.Add(-time.Second).Zone()
+			begin = start.In(time.FixedZone("", from)).Format(icsLocalFormat)
+		}
+
+		line("BEGIN", kind)
+		line("DTSTART", begin)
+		line("TZOFFSETFROM", icsOffset(from))
+		line("TZOFFSETTO", icsOffset(offset))
+		line("TZNAME", icsText(name))
+		line("END", kind)
+
+		if end.IsZero() || end.After(zone.last) {
+			break
+		}
+		t = end.In(zone.location)
+	}
+	line("END", "VTIMEZONE")
+}
+
+// icsOffset formats a UTC offset in seconds as ±hhmm
+func icsOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign, seconds = "-", -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// icsText escapes a TEXT value (RFC 5545 section 3.3.11)
+func icsText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// writeICSLine writes a content line, folded so no line exceeds 75 octets
+// without splitting a UTF-8 character, and terminated with CRLF
+func writeICSLine(w *bufio.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		limit = 74 // continuation lines start with a space
+	}
+	w.WriteString(line + "\r\n")
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteICS_Golden(t *testing.T) {
+	route := renderFixture()[2]
+	var buf bytes.Buffer
+	require.NoError(t, WriteICS(&buf, route, "0123456789abcdef-3", time.Date(2024, 6, 20, 9, 0, 0, 0, time.UTC)))
+	assertGolden(t, filepath.Join("ics", "route"), buf.Bytes())
+}
+
+func TestWriteICS_TimeZones(t *testing.T) {
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+	dep := time.Date(2024, 10, 26, 22, 0, 0, 0, madrid)
+	flight := TransportOption{
+		Mode:      "flight",
+		From:      Location{Name: "Madrid", TimeZone: "Europe/Madrid"},
+		To:        Location{Name: "Tel Aviv", TimeZone: "Asia/Jerusalem"},
+		Departure: dep,
+		Arrival:   dep.Add(5 * time.Hour),
+	}
+
+	t.Run("Local times", func(t *testing.T) {
+		back := TransportOption{
+			Mode:      "flight",
+			From:      flight.To,
+			To:        flight.From,
+			Departure: flight.Arrival.Add(3 * time.Hour),
+			Arrival:   flight.Arrival.Add(8 * time.Hour),
+		}
+		var buf bytes.Buffer
+		require.NoError(t, WriteICS(&buf, Route{Segments: []TransportOption{flight, back}}, "id", dep))
+		ics := buf.String()
+		assert.Contains(t, ics, "DTSTART;TZID=Europe/Madrid:20241026T220000\r\n")
+		assert.Contains(t, ics, "DTEND;TZID=Asia/Jerusalem:20241027T030000\r\n")
+		assert.Contains(t, ics, "DTEND;TZID=Europe/Madrid:20241027T100000\r\n")
+
+		// Summer time ends in Madrid between the flights, so both observances
+		// are described
+		madridZone := ics[strings.Index(ics, "TZID:Europe/Madrid"):]
+		madridZone = madridZone[:strings.Index(madridZone, "END:VTIMEZONE")]
+		assert.Contains(t, madridZone, "BEGIN:DAYLIGHT\r\nDTSTART:20240331T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\nTZNAME:CEST\r\n")
+		assert.Contains(t, madridZone, "BEGIN:STANDARD\r\nDTSTART:20241027T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\nTZNAME:CET\r\n")
+		assert.Equal(t, 2, strings.Count(ics, "BEGIN:VTIMEZONE"))
+	})
+
+	t.Run("UTC when the zone is unknown", func(t *testing.T) {
+		flight := flight
+		flight.From.TimeZone, flight.To.TimeZone = "", "Nowhere/Atlantis"
+
+		var buf bytes.Buffer
+		require.NoError(t, WriteICS(&buf, Route{Segments: []TransportOption{flight}}, "id", dep))
+		assert.Contains(t, buf.String(), "DTSTART:20241026T200000Z\r\n")
+		assert.Contains(t, buf.String(), "DTEND:20241027T010000Z\r\n")
+		assert.NotContains(t, buf.String(), "VTIMEZONE")
+	})
+}
+
+func TestICSText(t *testing.T) {
+	assert.Equal(t, `Taxi\, Cabify\; night \\ day\nline two`, icsText("Taxi, Cabify; night \\ day\nline two"))
+}
+
+func TestWriteICSLine_Folds(t *testing.T) {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	writeICSLine(bw, "DESCRIPTION:"+strings.Repeat("é", 100))
+	require.NoError(t, bw.Flush())
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+	require.Greater(t, len(lines), 1)
+	for i, line := range lines {
+		assert.LessOrEqual(t, len(line), 75, "line %d", i)
+		assert.True(t, strings.ToValidUTF8(line, "?") == line, "line %d splits a character", i)
+		if i > 0 {
+			assert.True(t, strings.HasPrefix(line, " "))
+		}
+	}
+
+	unfolded := strings.ReplaceAll(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n ", "")
+	assert.Equal(t, "DESCRIPTION:"+strings.Repeat("é", 100), unfolded)
+}
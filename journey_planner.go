@@ -0,0 +1,289 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// walkSpeed is how fast passengers walk to, from and between stops, in
+	// km/h over the straight line
+	walkSpeed = 4.5
+
+	// transitWalkRadius is how far from the origin and the destination a
+	// stop can be, in meters
+	transitWalkRadius = 1000
+
+	// transferWalkRadius is how far apart two stops can be to change
+	// between them on foot, in meters
+	transferWalkRadius = 300
+
+	// minTransfer is the least time to change vehicles at a stop
+	minTransfer = 2 * time.Minute
+
+	// transitSearchWindow is how long after the requested time a journey
+	// may start
+	transitSearchWindow = 6 * time.Hour
+)
+
+// JourneyPlanner finds the earliest arriving public transport journeys
+// through a GTFS timetable with the Connection Scan Algorithm
+// (https://arxiv.org/abs/1703.05997). The timetable is indexed once; each
+// query scans the connections of the service days around its departure.
+type JourneyPlanner struct {
+	feed        *GTFSFeed
+	location    *time.Location // the feed's timezone, shared by all agencies
+	stops       []*GTFSStop
+	connections []transitConnection // by departure, then arrival
+	footpaths   [][]footpath        // by stop index
+}
+
+// transitConnection is a vehicle going from one stop to the next without
+// stopping: the hop from a trip's stop time at index to the one after it
+type transitConnection struct {
+	trip               *GTFSTrip
+	index              int
+	from, to           int // stop indices
+	departure, arrival time.Duration
+}
+
+type footpath struct {
+	to       int
+	duration time.Duration
+}
+
+// Journey is a trip through the timetable: the rides in order, with walks
+// to the first stop, between stops where changing and from the last stop.
+// Departure is when to leave the origin, Arrival when the destination is
+// reached on foot.
+type Journey struct {
+	Departure time.Time
+	Arrival   time.Time
+	Rides     []GTFSLeg
+}
+
+// NewJourneyPlanner indexes a feed's connections and the footpaths between
+// its stops
+func NewJourneyPlanner(feed *GTFSFeed) *JourneyPlanner {
+	jp := &JourneyPlanner{feed: feed, location: time.UTC}
+	for _, agency := range feed.Agencies {
+		jp.location = agency.Location
+		break
+	}
+
+	index := make(map[*GTFSStop]int, len(feed.Stops))
+	for _, stop := range feed.Stops {
+		jp.stops = append(jp.stops, stop)
+	}
+	sort.Slice(jp.stops, func(i, j int) bool { return jp.stops[i].ID < jp.stops[j].ID })
+	for i, stop := range jp.stops {
+		index[stop] = i
+	}
+
+	for _, trip := range feed.Trips {
+		for i := 0; i+1 < len(trip.StopTimes); i++ {
+			from, to := trip.StopTimes[i], trip.StopTimes[i+1]
+			jp.connections = append(jp.connections, transitConnection{
+				trip:      trip,
+				index:     i,
+				from:      index[from.Stop],
+				to:        index[to.Stop],
+				departure: from.Departure,
+				arrival:   to.Arrival,
+			})
+		}
+	}
+	sort.Slice(jp.connections, func(i, j int) bool {
+		a, b := jp.connections[i], jp.connections[j]
+		if a.departure != b.departure {
+			return a.departure < b.departure
+		}
+		if a.arrival != b.arrival {
+			return a.arrival < b.arrival
+		}
+		return a.trip.ID < b.trip.ID
+	})
+
+	jp.footpaths = make([][]footpath, len(jp.stops))
+	for i, stop := range jp.stops {
+		for _, near := range feed.StopsNear(LatLng{Lat: stop.Lat, Lng: stop.Lng}, transferWalkRadius) {
+			if j := index[near]; j != i {
+				jp.footpaths[i] = append(jp.footpaths[i], footpath{to: j, duration: walkTime(stop.Lat, stop.Lng, near.Lat, near.Lng)})
+			}
+		}
+	}
+	return jp
+}
+
+// walkTime is how long walking between two points takes, rounded up to the
+// minute
+func walkTime(lat1, lng1, lat2, lng2 float64) time.Duration {
+	hours := CalculateDistance(lat1, lng1, lat2, lng2) / walkSpeed
+	return time.Duration(math.Ceil(hours*60)) * time.Minute
+}
+
+// transitEvent is a connection on a given service day
+type transitEvent struct {
+	conn *transitConnection
+	day  int // index into the days being scanned
+}
+
+// transitLabel is how a stop is best reached: on foot from the origin, on
+// a ride (from entering the trip to leaving it here) or on foot from
+// another stop. ready is the earliest a trip can be boarded there.
+type transitLabel struct {
+	reached     bool
+	ready       time.Time
+	arrival     time.Time
+	enter, exit transitEvent
+	walkFrom    int // -1 unless reached on foot from another stop
+	access      bool
+}
+
+type tripInstance struct {
+	trip *GTFSTrip
+	day  int
+}
+
+// Plan finds the journey from from to to that leaves no earlier than
+// departure and arrives first, and false when there's none within
+// transitSearchWindow. Journeys start and end with a walk of at most
+// transitWalkRadius.
+func (jp *JourneyPlanner) Plan(from, to LatLng, departure time.Time) (Journey, bool) {
+	egress := make(map[int]time.Duration)
+	for i, stop := range jp.stops {
+		if CalculateDistance(to.Lat, to.Lng, stop.Lat, stop.Lng)*1000 <= transitWalkRadius {
+			egress[i] = walkTime(stop.Lat, stop.Lng, to.Lat, to.Lng)
+		}
+	}
+	if len(egress) == 0 {
+		return Journey{}, false
+	}
+
+	labels := make([]transitLabel, len(jp.stops))
+	accessible := false
+	for i, stop := range jp.stops {
+		if CalculateDistance(from.Lat, from.Lng, stop.Lat, stop.Lng)*1000 <= transitWalkRadius {
+			ready := departure.Add(walkTime(from.Lat, from.Lng, stop.Lat, stop.Lng))
+			labels[i] = transitLabel{reached: true, ready: ready, arrival: ready, walkFrom: -1, access: true}
+			accessible = true
+		}
+	}
+	if !accessible {
+		return Journey{}, false
+	}
+
+	// Yesterday's trips may still run after midnight and a late departure
+	// can arrive tomorrow
+	local := departure.In(jp.location)
+	days := make([]time.Time, 3)
+	for i := range days {
+		days[i] = serviceDay(local.AddDate(0, 0, i-1), jp.location)
+	}
+
+	var best transitLabel
+	onboard := make(map[tripInstance]transitEvent)
+	running := make(map[tripInstance]bool)
+	end := departure.Add(transitSearchWindow)
+
+	jp.scan(days, departure, func(e transitEvent) bool {
+		dep := days[e.day].Add(e.conn.departure)
+		if dep.After(end) || (best.reached && !dep.Before(best.arrival)) {
+			return false
+		}
+
+		key := tripInstance{e.conn.trip, e.day}
+		enter, riding := onboard[key]
+		if !riding {
+			runs, known := running[key]
+			if !known {
+				runs = jp.feed.RunsOn(e.conn.trip, days[e.day])
+				running[key] = runs
+			}
+			if l := labels[e.conn.from]; !runs || !l.reached || l.ready.After(dep) {
+				return true
+			}
+			enter = e
+			onboard[key] = e
+		}
+
+		arrival := days[e.day].Add(e.conn.arrival)
+		ready := arrival.Add(minTransfer)
+		if l := &labels[e.conn.to]; !l.reached || ready.Before(l.ready) {
+			*l = transitLabel{reached: true, ready: ready, arrival: arrival, enter: enter, exit: e, walkFrom: -1}
+			for _, fp := range jp.footpaths[e.conn.to] {
+				walked := ready.Add(fp.duration)
+				if l := &labels[fp.to]; !l.reached || walked.Before(l.ready) {
+					*l = transitLabel{reached: true, ready: walked, arrival: arrival.Add(fp.duration), walkFrom: e.conn.to}
+				}
+			}
+		}
+		if walk, ok := egress[e.conn.to]; ok {
+			if reach := arrival.Add(walk); !best.reached || reach.Before(best.arrival) {
+				best = transitLabel{reached: true, arrival: reach, enter: enter, exit: e, walkFrom: -1}
+			}
+		}
+		return true
+	})
+	if !best.reached {
+		return Journey{}, false
+	}
+
+	// Follow the rides back to the stop walked to from the origin
+	journey := Journey{Arrival: best.arrival}
+	for l := best; ; {
+		journey.Rides = append(journey.Rides, GTFSLeg{
+			Trip:   l.enter.conn.trip,
+			Board:  l.enter.conn.index,
+			Alight: l.exit.conn.index + 1,
+			Day:    days[l.enter.day],
+		})
+		stop := l.enter.conn.from
+		if labels[stop].walkFrom >= 0 {
+			stop = labels[stop].walkFrom
+		}
+		if labels[stop].access {
+			first := jp.stops[stop]
+			journey.Departure = days[l.enter.day].Add(l.enter.conn.departure).
+				Add(-walkTime(from.Lat, from.Lng, first.Lat, first.Lng))
+			break
+		}
+		l = labels[stop]
+	}
+	for i, j := 0, len(journey.Rides)-1; i < j; i, j = i+1, j-1 {
+		journey.Rides[i], journey.Rides[j] = journey.Rides[j], journey.Rides[i]
+	}
+	return journey, true
+}
+
+// scan visits the connections of the given service days that leave from
+// start on, in order of their departure, until visit returns false. Each
+// day's connections are already sorted, so the days are merged.
+func (jp *JourneyPlanner) scan(days []time.Time, start time.Time, visit func(transitEvent) bool) {
+	next := make([]int, len(days))
+	for d, day := range days {
+		offset := start.Sub(day)
+		next[d] = sort.Search(len(jp.connections), func(i int) bool { return jp.connections[i].departure >= offset })
+	}
+	for {
+		pick := -1
+		var earliest time.Time
+		for d := range days {
+			if next[d] >= len(jp.connections) {
+				continue
+			}
+			dep := days[d].Add(jp.connections[next[d]].departure)
+			if pick < 0 || dep.Before(earliest) {
+				pick, earliest = d, dep
+			}
+		}
+		if pick < 0 {
+			return
+		}
+		if !visit(transitEvent{conn: &jp.connections[next[pick]], day: pick}) {
+			return
+		}
+		next[pick]++
+	}
+}
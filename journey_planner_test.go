@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPlanner(t *testing.T) *JourneyPlanner {
+	t.Helper()
+	feed, err := LoadGTFS(filepath.Join("testdata", "gtfs", "transit"))
+	require.NoError(t, err)
+	return NewJourneyPlanner(feed)
+}
+
+func TestJourneyPlanner_Plan(t *testing.T) {
+	jp := newTestPlanner(t)
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+	sol := LatLng{40.4168, -3.7038}
+	t4 := LatLng{40.4919, -3.5933}
+	t123 := LatLng{40.4686, -3.5696}
+
+	t.Run("Change on foot", func(t *testing.T) {
+		// The 08:13 L8 leaves before the two minutes to change, but the
+		// Cercanías platform next door is reached in time for the 08:16
+		journey, ok := jp.Plan(sol, t4, time.Date(2026, 6, 1, 7, 55, 0, 0, madrid))
+		require.True(t, ok)
+		assert.Equal(t, time.Date(2026, 6, 1, 7, 59, 0, 0, madrid), journey.Departure)
+		assert.Equal(t, time.Date(2026, 6, 1, 8, 35, 0, 0, madrid), journey.Arrival)
+		require.Len(t, journey.Rides, 2)
+		assert.Equal(t, "l10-0800", journey.Rides[0].Trip.ID)
+		assert.Equal(t, "c1-0816", journey.Rides[1].Trip.ID)
+		assert.Equal(t, "NMI-C", journey.Rides[1].Trip.StopTimes[journey.Rides[1].Board].Stop.ID)
+	})
+
+	t.Run("Change at the stop", func(t *testing.T) {
+		journey, ok := jp.Plan(sol, t123, time.Date(2026, 6, 1, 8, 5, 0, 0, madrid))
+		require.True(t, ok)
+		require.Len(t, journey.Rides, 2)
+		assert.Equal(t, "l10-0820", journey.Rides[0].Trip.ID)
+		assert.Equal(t, "l8-0840", journey.Rides[1].Trip.ID)
+		assert.Equal(t, 1, journey.Rides[1].Alight, "gets off before T4")
+		assert.Equal(t, time.Date(2026, 6, 1, 8, 57, 0, 0, madrid), journey.Arrival)
+	})
+
+	t.Run("Yesterday's night bus", func(t *testing.T) {
+		// No weekday service on Saturday, but Friday's night bus leaves
+		// after midnight
+		journey, ok := jp.Plan(sol, t4, time.Date(2026, 6, 6, 0, 15, 0, 0, madrid))
+		require.True(t, ok)
+		require.Len(t, journey.Rides, 1)
+		assert.Equal(t, "n27-2430", journey.Rides[0].Trip.ID)
+		assert.Equal(t, time.Date(2026, 6, 6, 1, 10, 0, 0, madrid), journey.Arrival)
+	})
+
+	t.Run("Nothing in the window", func(t *testing.T) {
+		_, ok := jp.Plan(sol, t4, time.Date(2026, 6, 6, 12, 0, 0, 0, madrid))
+		assert.False(t, ok)
+	})
+
+	t.Run("No stops in walking distance", func(t *testing.T) {
+		_, ok := jp.Plan(LatLng{41.3874, 2.1686}, t4, time.Date(2026, 6, 1, 7, 55, 0, 0, madrid))
+		assert.False(t, ok)
+		_, ok = jp.Plan(sol, LatLng{41.3874, 2.1686}, time.Date(2026, 6, 1, 7, 55, 0, 0, madrid))
+		assert.False(t, ok)
+	})
+}
+
+func TestTransportService_Timetable(t *testing.T) {
+	ts := NewTransportService(NewConfigStore(DefaultConfig()), newStubGoogleClient(t, googleStatusHandler("ZERO_RESULTS", "")))
+	ts.timetable = newTestPlanner(t)
+	madrid, err := time.LoadLocation("Europe/Madrid")
+	require.NoError(t, err)
+	sol := Location{Name: "Puerta del Sol", Latitude: 40.4168, Longitude: -3.7038}
+	airport := Location{Name: "Madrid-Barajas T1", Latitude: 40.4686, Longitude: -3.5696}
+	date := time.Date(2026, 6, 1, 8, 5, 0, 0, madrid)
+
+	option, err := ts.GetGroundTransport(context.Background(), sol, airport, date)
+	require.NoError(t, err)
+	assert.Equal(t, "public_transport", option.Mode)
+	assert.Equal(t, "Metro de Madrid L10, Metro de Madrid L8", option.Provider)
+	assert.Equal(t, 4.5, option.Price, "both fares")
+	assert.Equal(t, sol, option.From)
+	assert.Equal(t, time.Date(2026, 6, 1, 8, 19, 0, 0, madrid), option.Departure)
+	assert.Equal(t, 38*time.Minute, option.Duration)
+	assert.Equal(t, LatLng{40.4168, -3.7038}, option.Path[0])
+	assert.Equal(t, LatLng{40.4686, -3.5696}, option.Path[len(option.Path)-1])
+	assert.NotZero(t, option.Distance)
+	assert.Equal(t, EstimateCO2(option), option.CO2)
+
+	t.Run("Falls back outside the timetable", func(t *testing.T) {
+		option, err := ts.GetGroundTransport(context.Background(), sol, airport, date.Add(12*time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, "taxi", option.Mode)
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Log attribute keys shared across the service, so the same thing is always
+// logged under the same name
+const (
+	logKeyRequestID   = "request_id"
+	logKeyOrigin      = "origin"
+	logKeyDestination = "destination"
+	logKeyAirport     = "airport"
+	logKeyUpstream    = "upstream"
+	logKeyStatus      = "status"
+	logKeyDuration    = "duration_ms"
+	logKeyError       = "error"
+)
+
+// NewLogger builds the service logger writing to w. level is debug, info,
+// warn or error; format is text or json.
+func NewLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q (use debug, info, warn or error)", level)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q (use text or json)", format)
+	}
+}
+
+type loggerContextKey struct{}
+
+// withLogger stores a request-scoped logger in the context
+func withLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// LoggerFromContext returns the request-scoped logger, or the default logger
+// outside a request
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// durationAttr logs a duration in milliseconds, which is easier to query
+// than slog's default nanoseconds
+func durationAttr(d time.Duration) slog.Attr {
+	return slog.Float64(logKeyDuration, float64(d.Microseconds())/1000)
+}
+
+// errorAttr logs an error under the shared key, with any API key quoted
+// from a request URL redacted
+func errorAttr(err error) slog.Attr {
+	return slog.String(logKeyError, redactAPIKey(err.Error()))
+}
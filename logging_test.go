@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs makes a JSON debug logger the default for the test and returns
+// the buffer it writes to
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "debug", "json")
+	require.NoError(t, err)
+
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	return &buf
+}
+
+// logLines decodes every JSON log line written so far
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		lines = append(lines, entry)
+	}
+	return lines
+}
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "warn", "text")
+	require.NoError(t, err)
+	logger.Info("hidden")
+	logger.Warn("shown", "airport", "MAD")
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), "msg=shown airport=MAD")
+
+	buf.Reset()
+	logger, err = NewLogger(&buf, "DEBUG", "json")
+	require.NoError(t, err)
+	logger.Debug("hello")
+	assert.Contains(t, buf.String(), `"msg":"hello"`)
+
+	_, err = NewLogger(&buf, "verbose", "text")
+	assert.ErrorContains(t, err, "invalid log level")
+	_, err = NewLogger(&buf, "info", "xml")
+	assert.ErrorContains(t, err, "invalid log format")
+}
+
+func TestLoggerFromContext(t *testing.T) {
+	assert.Equal(t, slog.Default(), LoggerFromContext(context.Background()))
+
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	assert.Equal(t, logger, LoggerFromContext(withLogger(context.Background(), logger)))
+}
+
+func TestAccessLog_RequestScopedFields(t *testing.T) {
+	buf := captureLogs(t)
+
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LoggerFromContext(r.Context()).Info("inside handler")
+		w.WriteHeader(http.StatusBadGateway)
+	}), RequestID, AccessLog)
+
+	req := httptest.NewRequest("GET", "/search?origin=Madrid", nil)
+	req.Header.Set("X-Request-ID", "req-7")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := logLines(t, buf)
+	require.Len(t, lines, 2)
+
+	assert.Equal(t, "inside handler", lines[0]["msg"])
+	assert.Equal(t, "req-7", lines[0][logKeyRequestID])
+
+	access := lines[1]
+	assert.Equal(t, "request served", access["msg"])
+	assert.Equal(t, "ERROR", access["level"])
+	assert.Equal(t, "req-7", access[logKeyRequestID])
+	assert.Equal(t, "/search?origin=Madrid", access["path"])
+	assert.Equal(t, float64(http.StatusBadGateway), access[logKeyStatus])
+	assert.Contains(t, access, logKeyDuration)
+}
+
+func TestAccessLog_Levels(t *testing.T) {
+	tests := []struct {
+		status int
+		level  string
+	}{
+		{http.StatusOK, "INFO"},
+		{http.StatusNotFound, "WARN"},
+		{http.StatusInternalServerError, "ERROR"},
+	}
+
+	for _, tt := range tests {
+		buf := captureLogs(t)
+		handler := AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+		lines := logLines(t, buf)
+		require.Len(t, lines, 1)
+		assert.Equal(t, tt.level, lines[0]["level"], "status %d", tt.status)
+	}
+}
+
+func TestFindRoutes_LogsFailedSearch(t *testing.T) {
+	buf := captureLogs(t)
+
+	tf := NewTravelFinder(Config{GoogleMapsAPIKey: "test-key"})
+	tf.google.baseURL = newStubGoogleClient(t, googleStatusHandler("REQUEST_DENIED", "")).baseURL
+	_, err := tf.FindRoutes(context.Background(), "Madrid", "Barcelona", time.Now())
+	require.Error(t, err)
+
+	var upstream, search map[string]any
+	for _, line := range logLines(t, buf) {
+		switch line["msg"] {
+		case "upstream call failed":
+			upstream = line
+		case "search failed":
+			search = line
+		}
+	}
+	require.NotNil(t, upstream)
+	require.NotNil(t, search)
+	assert.Equal(t, "geocode", upstream[logKeyUpstream])
+	assert.Equal(t, "Madrid", search[logKeyOrigin])
+	assert.Equal(t, "Barcelona", search[logKeyDestination])
+	assert.Contains(t, search[logKeyError], "REQUEST_DENIED")
+}
+
+func TestLogs_HideAPIKey(t *testing.T) {
+	buf := captureLogs(t)
+
+	// Nothing listens, so every Google call fails with an error quoting
+	// the request URL
+	server := httptest.NewServer(nil)
+	server.Close()
+	tf := NewTravelFinder(Config{GoogleMapsAPIKey: "secret-key", RetryMaxAttempts: 1})
+	tf.google.baseURL = server.URL
+
+	w := httptest.NewRecorder()
+	NewRouter(Config{}, tf, nil).ServeHTTP(w, httptest.NewRequest("GET", "/search?origin=Madrid&destination=Barcelona&date=2024-07-01", nil))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+
+	var upstream, access map[string]any
+	for _, line := range logLines(t, buf) {
+		switch line["msg"] {
+		case "upstream call failed":
+			upstream = line
+		case "request served":
+			access = line
+		}
+	}
+	require.NotNil(t, upstream)
+	require.NotNil(t, access)
+	assert.Contains(t, upstream[logKeyError], "key=REDACTED")
+	assert.Contains(t, access[logKeyError], "key=REDACTED")
+	assert.NotContains(t, buf.String(), "secret-key")
+	assert.NotContains(t, w.Body.String(), "secret-key")
+}
@@ -1,56 +1,158 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/joho/godotenv"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
+const usage = `usage: travel-routes [command] [flags]
+
+commands:
+  serve      run the HTTP server (the default)
+  search     find routes: -origin Granada -destination "Tel Aviv" -date 2024-07-01
+  airports   list airports near -location
+  geocode    resolve -location to coordinates
+  config     print or validate the configuration
+  secrets    create an encrypted secrets file
+
+Run "travel-routes <command> -h" for the flags of a command.`
+
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found (this is okay in production)")
+	envErr := godotenv.Load()
+
+	// Without a command, or with only flags, run the server as before
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
 
-	// Load configuration
-	config := LoadConfig()
+	switch command {
+	case "serve":
+		serve(args, envErr)
+	case "search", "airports", "geocode":
+		os.Exit(runQueryCommand(command, args, os.Stdout, os.Stderr))
+	case "config":
+		os.Exit(runConfigCommand(args, os.Stdout, os.Stderr))
+	case "secrets":
+		os.Exit(runSecretsCommand(args, os.Stdin, os.Stdout, os.Stderr))
+	case "help":
+		fmt.Println(usage)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
 
-	// Create travel finder
-	tf := NewTravelFinder(config)
+// serve runs the HTTP server until SIGINT or SIGTERM
+func serve(args []string, envErr error) {
+	// Load configuration: defaults, config file, environment, then flags
+	fs := flag.NewFlagSet("travel-routes serve", flag.ExitOnError)
+	configFlags := RegisterConfigFlags(fs)
+	fs.Parse(args)
 
-	// Set up HTTP routes
-	http.HandleFunc("/search", tf.handleSearchRoutes)
-	http.HandleFunc("/airports", tf.handleNearbyAirports)
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
+	config, err := loadValidConfig(context.Background(), configFlags)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	logger, err := NewLogger(os.Stderr, config.LogLevel, config.LogFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid logging configuration: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
 
-	// Example usage
-	fmt.Println("=== Travel Route Finder ===")
-	fmt.Println("Example: Finding routes from Granada to Tel Aviv on July 1st, 2024")
+	if envErr != nil {
+		logger.Info("no .env file found (this is okay in production)")
+	}
 
-	travelDate := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC)
-	routes, err := tf.FindRoutes("Granada", "Tel Aviv", travelDate)
+	// Install the trace exporter before any spans are started
+	shutdownTracing, err := SetupTracing(context.Background(), config)
 	if err != nil {
-		log.Printf("Error finding routes: %v", err)
-	} else {
-		PrintRoutes(routes)
+		fatal("failed to set up tracing", err)
 	}
 
-	// Start HTTP server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Create travel finder
+	tf := NewTravelFinder(config)
+
+	// Load API keys; without a key file the endpoints stay open
+	var keyStore *KeyStore
+	if config.APIKeysFile != "" {
+		keyStore, err = OpenKeyStore(config.APIKeysFile)
+		if err != nil {
+			fatal("failed to open API key store", err)
+		}
+		go func() {
+			for range time.Tick(time.Minute) {
+				if err := keyStore.Flush(); err != nil {
+					logger.Error("failed to save API key usage", errorAttr(err))
+				}
+			}
+		}()
 	}
 
-	fmt.Printf("Server starting on port %s...\n", port)
+	// Start HTTP server
+	server := NewServer(config, tf, keyStore)
+
+	fmt.Printf("Server starting on port %s...\n", config.Port)
 	fmt.Printf("Endpoints:\n")
 	fmt.Printf("  GET /search?origin=Granada&destination=Tel Aviv&date=2024-07-01\n")
 	fmt.Printf("  GET /airports?location=Granada&radius=300\n")
-	fmt.Printf("  GET /health\n")
+	fmt.Printf("  GET /healthz, GET /readyz\n")
+	if keyStore != nil {
+		logger.Info("API key authentication enabled", slog.String("keys_file", config.APIKeysFile))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Search settings and secrets can be changed without a restart: edit the
+	// config file or send SIGHUP; secrets are also re-read periodically
+	NewConfigReloader(tf.config, configFlags, config.ConfigWatchInterval, config.SecretsRefreshInterval).Start(ctx)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		fatal("server failed", err)
+	case <-ctx.Done():
+	}
+
+	// Stop accepting connections and let in-flight searches finish
+	logger.Info("shutting down, waiting for in-flight requests", slog.Duration("timeout", config.ShutdownTimeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("graceful shutdown failed", errorAttr(err))
+	}
+	if keyStore != nil {
+		if err := keyStore.Flush(); err != nil {
+			logger.Error("failed to save API key usage", errorAttr(err))
+		}
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		logger.Error("failed to flush traces", errorAttr(err))
+	}
+	logger.Info("server stopped")
+}
 
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, errorAttr(err))
+	os.Exit(1)
 }
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the Prometheus collectors for the service. All methods are
+// safe to call on a nil *Metrics, which records nothing.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests     *prometheus.CounterVec
+	httpDuration     *prometheus.HistogramVec
+	upstreamRequests *prometheus.CounterVec
+	upstreamDuration *prometheus.HistogramVec
+	searchDuration   *prometheus.HistogramVec
+	searchCalls      prometheus.Histogram
+	routesReturned   prometheus.Histogram
+}
+
+// NewMetrics creates the collectors on a dedicated registry, together with
+// the standard Go runtime and process collectors
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "travel_http_requests_total",
+			Help: "HTTP requests served, by handler, method and status code.",
+		}, []string{"handler", "method", "code"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "travel_http_request_duration_seconds",
+			Help:    "HTTP request latency by handler.",
+			Buckets: []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"handler"}),
+		upstreamRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "travel_upstream_requests_total",
+			Help: "Outbound API calls by API (geocode, places, directions, flights) and resulting status.",
+		}, []string{"api", "status"}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "travel_upstream_request_duration_seconds",
+			Help:    "Outbound API call latency by API.",
+			Buckets: []float64{.025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+		}, []string{"api"}),
+		searchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "travel_search_duration_seconds",
+			Help:    "Time to run a route search, by outcome (ok or error).",
+			Buckets: []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"outcome"}),
+		searchCalls: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "travel_search_google_calls",
+			Help:    "Google API calls made by a single route search.",
+			Buckets: []float64{2, 4, 6, 8, 10, 15, 20, 30, 50},
+		}),
+		routesReturned: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "travel_search_routes_returned",
+			Help:    "Routes found by a single route search.",
+			Buckets: []float64{0, 1, 2, 5, 10, 20, 50, 100},
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.upstreamRequests,
+		m.upstreamDuration,
+		m.searchDuration,
+		m.searchCalls,
+		m.routesReturned,
+	)
+
+	return m
+}
+
+// WatchBudget exports the Google daily budget as a gauge
+func (m *Metrics) WatchBudget(budget *QuotaBudget) {
+	if m == nil {
+		return
+	}
+
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "travel_google_budget_remaining",
+		Help: "Google API calls left in today's budget (-1 when unlimited).",
+	}, func() float64 {
+		return float64(budget.Remaining())
+	}))
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// InstrumentHandler records request counts and latency under the given
+// handler name
+func (m *Metrics) InstrumentHandler(name string, next http.HandlerFunc) http.HandlerFunc {
+	if m == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		m.httpRequests.WithLabelValues(name, r.Method, strconv.Itoa(rec.status)).Inc()
+		m.httpDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	}
+}
+
+// CountUpstream records the status of one outbound call
+func (m *Metrics) CountUpstream(api, status string) {
+	if m == nil {
+		return
+	}
+	m.upstreamRequests.WithLabelValues(api, status).Inc()
+}
+
+// ObserveUpstreamLatency records how long one outbound call took
+func (m *Metrics) ObserveUpstreamLatency(api string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.upstreamDuration.WithLabelValues(api).Observe(duration.Seconds())
+}
+
+// ObserveSearch records a finished route search
+func (m *Metrics) ObserveSearch(ctx context.Context, routes int, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	} else {
+		m.routesReturned.Observe(float64(routes))
+	}
+	m.searchDuration.WithLabelValues(outcome).Observe(duration.Seconds())
+	m.searchCalls.Observe(float64(googleCalls(ctx)))
+}
+
+type callCounterContextKey struct{}
+
+// withCallCounter attaches a counter of Google API calls to the context so
+// a whole search can be attributed its calls
+func withCallCounter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, callCounterContextKey{}, new(int64))
+}
+
+// countGoogleCall increments the counter attached by withCallCounter
+func countGoogleCall(ctx context.Context) {
+	if counter, ok := ctx.Value(callCounterContextKey{}).(*int64); ok {
+		atomic.AddInt64(counter, 1)
+	}
+}
+
+// googleCalls returns the number of calls counted on the context
+func googleCalls(ctx context.Context) int64 {
+	if counter, ok := ctx.Value(callCounterContextKey{}).(*int64); ok {
+		return atomic.LoadInt64(counter)
+	}
+	return 0
+}
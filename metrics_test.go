@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics_NilIsSafe(t *testing.T) {
+	var m *Metrics
+	m.CountUpstream("geocode", "OK")
+	m.ObserveUpstreamLatency("geocode", time.Second)
+	m.ObserveSearch(context.Background(), 3, time.Second, nil)
+	m.WatchBudget(NewQuotaBudget(0, 0))
+
+	called := false
+	m.InstrumentHandler("search", func(w http.ResponseWriter, r *http.Request) { called = true })(
+		httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.True(t, called)
+}
+
+func TestMetrics_InstrumentHandler(t *testing.T) {
+	m := NewMetrics()
+	h := m.InstrumentHandler("search", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/search", nil))
+	h(httptest.NewRecorder(), httptest.NewRequest("GET", "/search", nil))
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.httpRequests.WithLabelValues("search", "GET", "400")))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.httpDuration))
+}
+
+func TestMetrics_GoogleClientUpstream(t *testing.T) {
+	m := NewMetrics()
+	gc := newStubGoogleClient(t, googleStatusHandler("OVER_DAILY_LIMIT", ""))
+	gc.metrics = m
+
+	ctx := withCallCounter(context.Background())
+	gc.Get(ctx, "places", "place/nearbysearch/json", url.Values{}, &GooglePlacesResponse{})
+	gc.Get(ctx, "places", "place/nearbysearch/json", url.Values{}, &GooglePlacesResponse{})
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.upstreamRequests.WithLabelValues("places", "OVER_DAILY_LIMIT")))
+	assert.Equal(t, int64(2), googleCalls(ctx))
+}
+
+func TestMetrics_ObserveSearch(t *testing.T) {
+	m := NewMetrics()
+	ctx := withCallCounter(context.Background())
+	countGoogleCall(ctx)
+	countGoogleCall(ctx)
+	countGoogleCall(ctx)
+
+	m.ObserveSearch(ctx, 4, time.Second, nil)
+	m.ObserveSearch(ctx, 0, time.Second, errors.New("geocoding failed"))
+
+	assert.Equal(t, 2, testutil.CollectAndCount(m.searchDuration))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.routesReturned))
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	config := Config{GoogleMapsAPIKey: "test-key", MetricsToken: "scraper-secret"}
+	tf := NewTravelFinder(config)
+	router := NewRouter(config, tf, nil)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+
+	scrape := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusUnauthorized, scrape("").Code)
+	assert.Equal(t, http.StatusUnauthorized, scrape("wrong").Code)
+
+	w := scrape("scraper-secret")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	body, _ := io.ReadAll(w.Body)
+	assert.Contains(t, string(body), `travel_http_requests_total{code="200",handler="health",method="GET"} 1`)
+	assert.Contains(t, string(body), "travel_google_budget_remaining -1")
+	assert.Contains(t, string(body), "go_goroutines")
+}
@@ -10,15 +10,16 @@ type Location struct {
 	Name      string  `json:"name"`
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
-	Type      string  `json:"type"` // "city", "airport", "station"
+	Type      string  `json:"type"` // "city", "airport", "station", "bus_station", "port"
 	Code      string  `json:"code"` // IATA code for airports
 	Country   string  `json:"country,omitempty"`
 	PlaceID   string  `json:"place_id,omitempty"`
+	TimeZone  string  `json:"time_zone,omitempty"` // IANA name, e.g. "Europe/Madrid", when known
 }
 
 // TransportOption represents a transportation option
 type TransportOption struct {
-	Mode       string        `json:"mode"` // "flight", "train", "bus", "taxi"
+	Mode       string        `json:"mode"` // "flight", "train", "bus", "ferry", "taxi"
 	From       Location      `json:"from"`
 	To         Location      `json:"to"`
 	Duration   time.Duration `json:"duration"`
@@ -28,12 +29,23 @@ type TransportOption struct {
 	Arrival    time.Time     `json:"arrival"`
 	Provider   string        `json:"provider"`
 	BookingURL string        `json:"booking_url,omitempty"`
+	Distance   float64       `json:"distance_km,omitempty"`
+	CO2        float64       `json:"co2_kg"`                // estimated emissions per passenger, kg CO2e
+	CabinClass string        `json:"cabin_class,omitempty"` // flights: economy, premium_economy, business or first
+	Path       []LatLng      `json:"path,omitempty"`        // the way the segment travels: Directions for ground legs, the great circle for flights
+
+	// Ferries: the fare for taking each vehicle type on board, on top of
+	// Price, and the vehicle carried when one was searched for (its fare
+	// is then included in Price)
+	VehiclePrices map[string]float64 `json:"vehicle_prices,omitempty"`
+	Vehicle       string             `json:"vehicle,omitempty"`
 }
 
 // Route represents a complete travel route
 type Route struct {
 	Segments    []TransportOption `json:"segments"`
 	TotalPrice  float64           `json:"total_price"`
+	TotalCO2    float64           `json:"total_co2_kg"`
 	Currency    string            `json:"currency"`
 	TotalTime   time.Duration     `json:"total_time"`
 	Departure   time.Time         `json:"departure"`
@@ -46,3 +58,11 @@ type AirportDistance struct {
 	Airport  Location `json:"airport"`
 	Distance float64  `json:"distance_km"`
 }
+
+// RoutePage represents one page of search results
+type RoutePage struct {
+	SearchID   string  `json:"search_id,omitempty"`
+	Routes     []Route `json:"routes"`
+	Total      int     `json:"total"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
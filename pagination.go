@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	cursorPrefix    = "offset:"
+)
+
+// encodeCursor turns a stored search's ID and a result offset into an
+// opaque cursor
+func encodeCursor(searchID string, offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(searchID + "/" + cursorPrefix + strconv.Itoa(offset)))
+}
+
+// decodeCursor recovers the search ID and result offset from a cursor made
+// by encodeCursor
+func decodeCursor(cursor string) (searchID string, offset int, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", 0, invalidInput("malformed cursor")
+	}
+	searchID, rest, ok := strings.Cut(string(raw), "/")
+	if !ok || searchID == "" || !strings.HasPrefix(rest, cursorPrefix) {
+		return "", 0, invalidInput("malformed cursor")
+	}
+
+	offset, err = strconv.Atoi(strings.TrimPrefix(rest, cursorPrefix))
+	if err != nil || offset < 0 {
+		return "", 0, invalidInput("malformed cursor")
+	}
+
+	return searchID, offset, nil
+}
+
+// parsePageParams reads the limit and cursor query values. A missing limit
+// falls back to defaultPageSize; anything above maxPageSize is capped. The
+// search ID is empty for the first page.
+func parsePageParams(limitStr, cursor string) (limit, offset int, searchID string, err error) {
+	limit = defaultPageSize
+	if limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 {
+			return 0, 0, "", invalidInput("limit must be a positive integer")
+		}
+		if limit > maxPageSize {
+			limit = maxPageSize
+		}
+	}
+
+	if cursor != "" {
+		searchID, offset, err = decodeCursor(cursor)
+		if err != nil {
+			return 0, 0, "", err
+		}
+	}
+
+	return limit, offset, searchID, nil
+}
+
+// paginateRoutes cuts one page out of a stored, sorted result set
+func paginateRoutes(searchID string, routes []Route, limit, offset int) RoutePage {
+	page := RoutePage{SearchID: searchID, Routes: []Route{}, Total: len(routes)}
+	if offset >= len(routes) {
+		return page
+	}
+
+	end := offset + limit
+	if end > len(routes) {
+		end = len(routes)
+	}
+
+	page.Routes = routes[offset:end]
+	if end < len(routes) {
+		page.NextCursor = encodeCursor(searchID, end)
+	}
+
+	return page
+}
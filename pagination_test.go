@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, offset := range []int{0, 1, 20, 12345} {
+		searchID, decoded, err := decodeCursor(encodeCursor("5f4979b9bc08ccb1", offset))
+		assert.NoError(t, err)
+		assert.Equal(t, "5f4979b9bc08ccb1", searchID)
+		assert.Equal(t, offset, decoded)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	tests := []string{
+		"not base64!",
+		encodeCursorRaw("offset:5"),
+		encodeCursorRaw("/offset:5"),
+		encodeCursorRaw("id/limit:5"),
+		encodeCursorRaw("id/offset:-1"),
+		encodeCursorRaw("id/offset:abc"),
+	}
+	for _, cursor := range tests {
+		_, _, err := decodeCursor(cursor)
+		assert.Error(t, err, cursor)
+	}
+}
+
+func TestParsePageParams(t *testing.T) {
+	tests := []struct {
+		name           string
+		limit          string
+		cursor         string
+		expectedLimit  int
+		expectedOffset int
+		expectedSearch string
+		expectError    bool
+	}{
+		{name: "Defaults", expectedLimit: defaultPageSize},
+		{name: "Explicit limit", limit: "5", expectedLimit: 5},
+		{name: "Limit is capped", limit: "1000", expectedLimit: maxPageSize},
+		{name: "Cursor sets offset", limit: "5", cursor: encodeCursor("id", 10), expectedLimit: 5, expectedOffset: 10, expectedSearch: "id"},
+		{name: "Zero limit", limit: "0", expectError: true},
+		{name: "Non-numeric limit", limit: "ten", expectError: true},
+		{name: "Bad cursor", cursor: "garbage", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit, offset, searchID, err := parsePageParams(tt.limit, tt.cursor)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedLimit, limit)
+			assert.Equal(t, tt.expectedOffset, offset)
+			assert.Equal(t, tt.expectedSearch, searchID)
+		})
+	}
+}
+
+func TestPaginateRoutes(t *testing.T) {
+	routes := make([]Route, 5)
+	for i := range routes {
+		routes[i] = Route{TotalPrice: float64(i)}
+	}
+
+	t.Run("First page", func(t *testing.T) {
+		page := paginateRoutes("id", routes, 2, 0)
+		assert.Equal(t, "id", page.SearchID)
+		assert.Equal(t, 5, page.Total)
+		assert.Len(t, page.Routes, 2)
+		assert.Equal(t, 0.0, page.Routes[0].TotalPrice)
+		assert.Equal(t, encodeCursor("id", 2), page.NextCursor)
+	})
+
+	t.Run("Last page", func(t *testing.T) {
+		page := paginateRoutes("id", routes, 2, 4)
+		assert.Len(t, page.Routes, 1)
+		assert.Equal(t, 4.0, page.Routes[0].TotalPrice)
+		assert.Empty(t, page.NextCursor)
+	})
+
+	t.Run("Offset past the end", func(t *testing.T) {
+		page := paginateRoutes("id", routes, 2, 10)
+		assert.NotNil(t, page.Routes)
+		assert.Empty(t, page.Routes)
+		assert.Empty(t, page.NextCursor)
+	})
+}
+
+func encodeCursorRaw(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
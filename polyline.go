@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+// DecodePolyline decodes a path in Google's encoded polyline format, as
+// returned by the Directions API
+// (https://developers.google.com/maps/documentation/utilities/polylinealgorithm)
+func DecodePolyline(encoded string) ([]LatLng, error) {
+	var path []LatLng
+	var lat, lng int
+
+	for i := 0; i < len(encoded); {
+		var deltas [2]int
+		for d := range deltas {
+			var result, shift int
+			for {
+				if i >= len(encoded) {
+					return nil, errors.New("polyline ends in the middle of a point")
+				}
+				b := int(encoded[i]) - 63
+				i++
+				if b < 0 || b > 63 {
+					return nil, errors.New("invalid character in polyline")
+				}
+				result |= (b & 0x1f) << shift
+				shift += 5
+				if b < 0x20 {
+					break
+				}
+			}
+			if result&1 != 0 {
+				deltas[d] = ^(result >> 1)
+			} else {
+				deltas[d] = result >> 1
+			}
+		}
+
+		lat += deltas[0]
+		lng += deltas[1]
+		path = append(path, LatLng{Lat: float64(lat) / 1e5, Lng: float64(lng) / 1e5})
+	}
+	return path, nil
+}
+
+// EncodePolyline is the inverse of DecodePolyline
+func EncodePolyline(path []LatLng) string {
+	var b strings.Builder
+	var prevLat, prevLng int
+	for _, p := range path {
+		lat, lng := int(math.Round(p.Lat*1e5)), int(math.Round(p.Lng*1e5))
+		for _, delta := range []int{lat - prevLat, lng - prevLng} {
+			v := delta << 1
+			if delta < 0 {
+				v = ^v
+			}
+			for v >= 0x20 {
+				b.WriteByte(byte((0x20 | (v & 0x1f)) + 63))
+				v >>= 5
+			}
+			b.WriteByte(byte(v + 63))
+		}
+		prevLat, prevLng = lat, lng
+	}
+	return b.String()
+}
+
+// SimplifyPath drops points with the Douglas–Peucker algorithm so that no
+// point of path is further than tolerance meters from the simplified line.
+// The first and last points are always kept.
+func SimplifyPath(path []LatLng, tolerance float64) []LatLng {
+	if len(path) <= 2 || tolerance <= 0 {
+		return path
+	}
+
+	keep := make([]bool, len(path))
+	keep[0], keep[len(path)-1] = true, true
+
+	// Work through the spans left to check instead of recursing, so long
+	// paths can't exhaust the stack
+	spans := [][2]int{{0, len(path) - 1}}
+	for len(spans) > 0 {
+		first, last := spans[len(spans)-1][0], spans[len(spans)-1][1]
+		spans = spans[:len(spans)-1]
+
+		farthest, distance := 0, 0.0
+		for i := first + 1; i < last; i++ {
+			if d := distanceToSegment(path[i], path[first], path[last]); d > distance {
+				farthest, distance = i, d
+			}
+		}
+		if distance > tolerance {
+			keep[farthest] = true
+			spans = append(spans, [2]int{first, farthest}, [2]int{farthest, last})
+		}
+	}
+
+	simplified := make([]LatLng, 0, len(path))
+	for i, p := range path {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+// distanceToSegment is the distance from p to the line segment a-b in
+// meters. Over the few kilometers between Directions points the Earth is
+// flat enough to project the three points onto a plane around a.
+func distanceToSegment(p, a, b LatLng) float64 {
+	const metersPerDegree = 6371000 * math.Pi / 180
+	scale := math.Cos(a.Lat * math.Pi / 180)
+	project := func(q LatLng) (float64, float64) {
+		return (q.Lng - a.Lng) * scale * metersPerDegree, (q.Lat - a.Lat) * metersPerDegree
+	}
+
+	px, py := project(p)
+	bx, by := project(b)
+	if length := bx*bx + by*by; length > 0 {
+		t := math.Max(0, math.Min(1, (px*bx+py*by)/length))
+		px, py = px-t*bx, py-t*by
+	}
+	return math.Hypot(px, py)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodePolyline(t *testing.T) {
+	// The example from Google's polyline algorithm documentation
+	path, err := DecodePolyline("_p~iF~ps|U_ulLnnqC_mqNvxq`@")
+	require.NoError(t, err)
+	assert.Equal(t, []LatLng{{38.5, -120.2}, {40.7, -120.95}, {43.252, -126.453}}, path)
+	assert.Equal(t, "_p~iF~ps|U_ulLnnqC_mqNvxq`@", EncodePolyline(path))
+
+	path, err = DecodePolyline("")
+	assert.NoError(t, err)
+	assert.Empty(t, path)
+
+	_, err = DecodePolyline("_p~iF~ps|U_")
+	assert.EqualError(t, err, "polyline ends in the middle of a point")
+	_, err = DecodePolyline("_p~iF ps|U")
+	assert.EqualError(t, err, "invalid character in polyline")
+}
+
+func TestSimplifyPath(t *testing.T) {
+	// Points along a street heading north with a 5 m wobble, then a turn east
+	path := []LatLng{{37.0, -3.6}, {37.001, -3.60005}, {37.002, -3.6}, {37.003, -3.60005}, {37.004, -3.6}, {37.004, -3.59}}
+
+	assert.Equal(t, []LatLng{{37.0, -3.6}, {37.004, -3.6}, {37.004, -3.59}}, SimplifyPath(path, 10))
+	assert.Equal(t, path, SimplifyPath(path, 1), "the wobble is kept at a tighter tolerance")
+	assert.Equal(t, path, SimplifyPath(path, 0))
+	assert.Equal(t, path[:2], SimplifyPath(path[:2], 10))
+}
+
+func TestTransportService_Path(t *testing.T) {
+	from := Location{Name: "Granada", Latitude: 37.1773, Longitude: -3.5986}
+	to := Location{Name: "Malaga Airport", Latitude: 36.6749, Longitude: -4.4991}
+	steps := []string{
+		EncodePolyline([]LatLng{{37.1773, -3.5986}, {37.1, -3.7}}),
+		EncodePolyline([]LatLng{{37.1, -3.7}, {36.9, -4.1}, {36.6749, -4.4991}}),
+	}
+	overview := EncodePolyline([]LatLng{{37.1773, -3.5986}, {36.6749, -4.4991}})
+
+	ground := func(body string) TransportOption {
+		gc := newStubGoogleClient(t, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, body)
+		})
+		option, err := NewTransportService(NewConfigStore(DefaultConfig()), gc).GetGroundTransport(context.Background(), from, to, time.Now())
+		require.NoError(t, err)
+		require.Equal(t, "public_transport", option.Mode)
+		return option
+	}
+
+	t.Run("Steps", func(t *testing.T) {
+		option := ground(fmt.Sprintf(`{"status": "OK", "routes": [{"overview_polyline": {"points": %q},
+			"legs": [{"duration": {"value": 3600}, "distance": {"value": 130000},
+				"steps": [{"polyline": {"points": %q}}, {"polyline": {"points": %q}}]}]}]}`, overview, steps[0], steps[1]))
+		assert.Equal(t, []LatLng{{37.1773, -3.5986}, {37.1, -3.7}, {36.9, -4.1}, {36.6749, -4.4991}}, option.Path)
+
+		data, err := json.Marshal(option)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), `"path":[[37.1773,-3.5986],[37.1,-3.7],[36.9,-4.1],[36.6749,-4.4991]]`)
+	})
+
+	t.Run("Overview", func(t *testing.T) {
+		option := ground(fmt.Sprintf(`{"status": "OK", "routes": [{"overview_polyline": {"points": %q},
+			"legs": [{"duration": {"value": 3600}, "distance": {"value": 130000}}]}]}`, overview))
+		assert.Equal(t, []LatLng{{37.1773, -3.5986}, {36.6749, -4.4991}}, option.Path)
+	})
+
+	t.Run("Malformed polyline", func(t *testing.T) {
+		option := ground(`{"status": "OK", "routes": [{"overview_polyline": {"points": "_p~iF~ps|U_"},
+			"legs": [{"duration": {"value": 3600}, "distance": {"value": 130000}}]}]}`)
+		assert.Nil(t, option.Path)
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// RailProvider finds train connections between two places
+type RailProvider interface {
+	// SearchTrains returns the trains from a station near from to a station
+	// near to that leave on date's day, no earlier than date, earliest
+	// first. Finding none is not an error.
+	SearchTrains(ctx context.Context, from, to Location, date time.Time) ([]TransportOption, error)
+}
+
+// railFarePerKm prices trains whose feed has no fare for their route
+const railFarePerKm = 0.12
+
+var railSearch = gtfsModeSearch{mode: "train", locationType: "station", routeTypes: isRailRouteType, farePerKm: railFarePerKm}
+
+// GTFSRail answers rail searches from the rail routes of a GTFS timetable.
+// Stations within StationRadius of a place count as serving it; only
+// direct trains are offered.
+type GTFSRail struct {
+	feed   *GTFSFeed
+	config *ConfigStore
+}
+
+func NewGTFSRail(feed *GTFSFeed, config *ConfigStore) *GTFSRail {
+	return &GTFSRail{feed: feed, config: config}
+}
+
+func (gr *GTFSRail) SearchTrains(ctx context.Context, from, to Location, date time.Time) ([]TransportOption, error) {
+	radius := float64(gr.config.Load().StationRadius)
+	return railSearch.search(ctx, gr.feed, from, to, radius, radius, date, 1), nil
+}
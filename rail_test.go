@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGTFSRail_SearchTrains(t *testing.T) {
+	rail := NewGTFSRail(loadTestFeed(t), NewConfigStore(DefaultConfig()))
+	granada := Location{Name: "Granada", Latitude: 37.1773, Longitude: -3.5986}
+	madrid := Location{Name: "Madrid", Latitude: 40.4168, Longitude: -3.7038}
+	date := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	trains, err := rail.SearchTrains(context.Background(), granada, madrid, date)
+	require.NoError(t, err)
+	require.Len(t, trains, 1, "the bus is not a train")
+	assert.Equal(t, "train", trains[0].Mode)
+	assert.Equal(t, "station", trains[0].From.Type)
+	assert.Equal(t, "Madrid Puerta de Atocha", trains[0].To.Name)
+	assert.Equal(t, time.Date(2026, 6, 1, 5, 0, 0, 0, time.UTC), trains[0].Departure.UTC())
+
+	t.Run("Station radius", func(t *testing.T) {
+		config := DefaultConfig()
+		config.StationRadius = 500
+		rail := NewGTFSRail(loadTestFeed(t), NewConfigStore(config))
+		trains, err := rail.SearchTrains(context.Background(), granada, madrid, date)
+		require.NoError(t, err)
+		assert.Empty(t, trains)
+	})
+
+	t.Run("No coordinates", func(t *testing.T) {
+		trains, err := rail.SearchTrains(context.Background(), Location{Name: "Nowhere"}, madrid, date)
+		require.NoError(t, err)
+		assert.Empty(t, trains)
+	})
+}
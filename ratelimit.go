@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket is a token-bucket rate limiter. A bucket with a rate of zero
+// or less never limits.
+type TokenBucket struct {
+	rate  float64 // tokens per second
+	burst float64
+	now   func() time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a full bucket refilling at rate tokens per second.
+// The burst is the rate rounded up, and at least one.
+func NewTokenBucket(rate float64) *TokenBucket {
+	burst := math.Max(1, math.Ceil(rate))
+	return &TokenBucket{
+		rate:   rate,
+		burst:  burst,
+		now:    time.Now,
+		tokens: burst,
+	}
+}
+
+// reserve takes a token, returning how long the caller must wait before
+// using it
+func (tb *TokenBucket) reserve() time.Duration {
+	if tb == nil || tb.rate <= 0 {
+		return 0
+	}
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := tb.now()
+	if !tb.last.IsZero() {
+		tb.tokens = math.Min(tb.burst, tb.tokens+now.Sub(tb.last).Seconds()*tb.rate)
+	}
+	tb.last = now
+
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
+
+// Allow takes a token if one is available right now, without waiting
+func (tb *TokenBucket) Allow() bool {
+	if tb == nil || tb.rate <= 0 {
+		return true
+	}
+	if tb.reserve() == 0 {
+		return true
+	}
+
+	// Give the token back; the caller is rejected rather than delayed
+	tb.mu.Lock()
+	tb.tokens++
+	tb.mu.Unlock()
+	return false
+}
+
+// Wait blocks until a token is available or ctx is done
+func (tb *TokenBucket) Wait(ctx context.Context) error {
+	return sleepContext(ctx, tb.reserve())
+}
+
+// QuotaBudget tracks outbound calls against a daily budget that resets at
+// midnight UTC. A limit of zero or less means no budget.
+type QuotaBudget struct {
+	limit   int
+	reserve int
+	now     func() time.Time
+
+	mu   sync.Mutex
+	day  string
+	used map[string]int
+	sum  int
+}
+
+// NewQuotaBudget creates a budget of limit calls per day. Once no more than
+// reserve calls are left the budget reports itself as low.
+func NewQuotaBudget(limit, reserve int) *QuotaBudget {
+	return &QuotaBudget{
+		limit:   limit,
+		reserve: reserve,
+		now:     time.Now,
+		used:    make(map[string]int),
+	}
+}
+
+// rollover resets the counters when the UTC day changes. Callers hold mu.
+func (qb *QuotaBudget) rollover() {
+	day := qb.now().UTC().Format("2006-01-02")
+	if day != qb.day {
+		qb.day = day
+		qb.used = make(map[string]int)
+		qb.sum = 0
+	}
+}
+
+// Spend records one call to api, failing with ErrUpstreamQuota once the
+// daily budget is used up
+func (qb *QuotaBudget) Spend(api string) error {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	qb.rollover()
+	if qb.limit > 0 && qb.sum >= qb.limit {
+		return fmt.Errorf("%w: daily budget of %d Google API calls used up", ErrUpstreamQuota, qb.limit)
+	}
+
+	qb.used[api]++
+	qb.sum++
+	return nil
+}
+
+// Remaining returns the calls left today, or -1 when there is no budget
+func (qb *QuotaBudget) Remaining() int {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	if qb.limit <= 0 {
+		return -1
+	}
+	qb.rollover()
+	return qb.limit - qb.sum
+}
+
+// Low reports whether the budget is down to its reserve
+func (qb *QuotaBudget) Low() bool {
+	remaining := qb.Remaining()
+	return remaining >= 0 && remaining <= qb.reserve
+}
+
+// Used returns today's calls per API
+func (qb *QuotaBudget) Used() map[string]int {
+	qb.mu.Lock()
+	defer qb.mu.Unlock()
+
+	qb.rollover()
+	used := make(map[string]int, len(qb.used))
+	for api, n := range qb.used {
+		used[api] = n
+	}
+	return used
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC)
+	tb := NewTokenBucket(2)
+	tb.now = func() time.Time { return now }
+
+	// The burst is available straight away
+	assert.Equal(t, time.Duration(0), tb.reserve())
+	assert.Equal(t, time.Duration(0), tb.reserve())
+
+	// Then callers have to wait for the refill
+	assert.Equal(t, 500*time.Millisecond, tb.reserve())
+	assert.Equal(t, time.Second, tb.reserve())
+
+	// Tokens refill over time, capped at the burst
+	now = now.Add(time.Hour)
+	assert.Equal(t, time.Duration(0), tb.reserve())
+	assert.Equal(t, time.Duration(0), tb.reserve())
+	assert.Equal(t, 500*time.Millisecond, tb.reserve())
+}
+
+func TestTokenBucket_Unlimited(t *testing.T) {
+	tb := NewTokenBucket(0)
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, time.Duration(0), tb.reserve())
+	}
+}
+
+func TestTokenBucket_WaitCancelled(t *testing.T) {
+	tb := NewTokenBucket(0.001)
+	tb.reserve()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, tb.Wait(ctx), context.Canceled)
+}
+
+func TestQuotaBudget(t *testing.T) {
+	now := time.Date(2024, 7, 1, 23, 0, 0, 0, time.UTC)
+	qb := NewQuotaBudget(3, 1)
+	qb.now = func() time.Time { return now }
+
+	assert.NoError(t, qb.Spend("geocode"))
+	assert.False(t, qb.Low())
+	assert.NoError(t, qb.Spend("places"))
+	assert.True(t, qb.Low())
+	assert.NoError(t, qb.Spend("places"))
+	assert.Equal(t, 0, qb.Remaining())
+	assert.ErrorIs(t, qb.Spend("directions"), ErrUpstreamQuota)
+	assert.Equal(t, map[string]int{"geocode": 1, "places": 2}, qb.Used())
+
+	// The budget resets at midnight UTC
+	now = now.Add(2 * time.Hour)
+	assert.Equal(t, 3, qb.Remaining())
+	assert.False(t, qb.Low())
+	assert.NoError(t, qb.Spend("directions"))
+}
+
+func TestQuotaBudget_Unlimited(t *testing.T) {
+	qb := NewQuotaBudget(0, 0)
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, qb.Spend("geocode"))
+	}
+	assert.Equal(t, -1, qb.Remaining())
+	assert.False(t, qb.Low())
+}
+
+func TestGoogleClient_BudgetExhausted(t *testing.T) {
+	var calls int32
+	gc := newStubGoogleClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		fmt.Fprint(w, `{"results": [], "status": "OK"}`)
+	})
+	gc.budget = NewQuotaBudget(1, 0)
+
+	assert.NoError(t, gc.Get(context.Background(), "geocode", "geocode/json", url.Values{}, &GoogleGeocodingResponse{}))
+	err := gc.Get(context.Background(), "geocode", "geocode/json", url.Values{}, &GoogleGeocodingResponse{})
+	assert.ErrorIs(t, err, ErrUpstreamQuota)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	assert.Equal(t, 1, gc.StatusCounts()["geocode"]["BUDGET_EXHAUSTED"])
+}
+
+func TestTransportService_DegradesToTaxi(t *testing.T) {
+	var calls int32
+	gc := newStubGoogleClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		fmt.Fprint(w, `{"routes": [{"legs": [{"duration": {"value": 3600}, "distance": {"value": 50000}}]}], "status": "OK"}`)
+	})
+	from := Location{Name: "Granada", Latitude: 37.1773, Longitude: -3.5986}
+	to := Location{Name: "Malaga Airport", Latitude: 36.6749, Longitude: -4.4991}
+	ts := NewTransportService(NewConfigStore(Config{}), gc)
+
+	option, err := ts.GetGroundTransport(context.Background(), from, to, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, "public_transport", option.Mode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// With the budget down to its reserve, Directions is skipped
+	gc.budget = NewQuotaBudget(10, 10)
+	option, err = ts.GetGroundTransport(context.Background(), from, to, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, "taxi", option.Mode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ConfigStore holds the live configuration shared by TravelFinder and its
+// services. Readers take a snapshot with Load, so a reload never changes
+// settings under a running search; the next call sees the new values.
+type ConfigStore struct {
+	current atomic.Pointer[Config]
+}
+
+func NewConfigStore(config Config) *ConfigStore {
+	cs := &ConfigStore{}
+	cs.Store(config)
+	return cs
+}
+
+// Load returns the current configuration
+func (cs *ConfigStore) Load() Config {
+	return *cs.current.Load()
+}
+
+// Store replaces the configuration atomically
+func (cs *ConfigStore) Store(config Config) {
+	cs.current.Store(&config)
+}
+
+// ConfigReloader re-reads the configuration on SIGHUP, when the config file
+// changes and periodically to pick up rotated secrets, and applies the
+// settings that can change at runtime. Others, such as the port or timeouts
+// baked into the HTTP server, need a restart and are reported but not
+// applied.
+type ConfigReloader struct {
+	store    *ConfigStore
+	load     func(ctx context.Context) (Config, error)
+	path     string
+	interval time.Duration
+	refresh  time.Duration
+}
+
+// NewConfigReloader reloads into store using the same sources and flags the
+// configuration was first loaded from. The config file, if any, is checked
+// for changes every interval and secrets are re-read every refresh (0
+// disables either).
+func NewConfigReloader(store *ConfigStore, configFlags *ConfigFlags, interval, refresh time.Duration) *ConfigReloader {
+	return &ConfigReloader{
+		store: store,
+		load: func(ctx context.Context) (Config, error) {
+			return loadConfig(ctx, configFlags)
+		},
+		path:     configFlags.Path(),
+		interval: interval,
+		refresh:  refresh,
+	}
+}
+
+// Reload loads and validates the configuration and swaps in the changed
+// runtime settings. An invalid configuration is rejected and the current
+// one kept. trigger describes what caused the reload, for the audit log.
+// Secret values are never logged, only that they were rotated.
+func (cr *ConfigReloader) Reload(ctx context.Context, trigger string) error {
+	logger := slog.Default().With(slog.String("trigger", trigger))
+
+	next, err := cr.load(ctx)
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		logger.Error("config reload rejected, keeping current configuration", errorAttr(err))
+		return err
+	}
+
+	updated := cr.store.Load()
+	var changed, needRestart []string
+	nextFields := next.fields()
+	for i, f := range updated.fields() {
+		from, to := formatConfigValue(f.ptr), formatConfigValue(nextFields[i].ptr)
+		if from == to {
+			continue
+		}
+		if !f.reloadable {
+			needRestart = append(needRestart, f.key())
+			continue
+		}
+		f.assign(nextFields[i])
+		if f.secret {
+			changed = append(changed, f.key()+": rotated")
+		} else {
+			changed = append(changed, fmt.Sprintf("%s: %s -> %s", f.key(), from, to))
+		}
+	}
+
+	cr.store.Store(updated)
+
+	// Periodic refreshes mostly find nothing new; keep those out of the
+	// audit trail
+	level := slog.LevelInfo
+	if len(changed) == 0 && len(needRestart) == 0 {
+		level = slog.LevelDebug
+	}
+	logger.Log(ctx, level, "config reloaded", slog.Any("changed", changed), slog.Any("requires_restart", needRestart))
+	return nil
+}
+
+// Start listens for SIGHUP, watches the config file and refreshes secrets
+// until ctx is done. The signal handler is installed before Start returns.
+func (cr *ConfigReloader) Start(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var watch, refresh <-chan time.Time
+	var tickers []*time.Ticker
+	if cr.path != "" && cr.interval > 0 {
+		ticker := time.NewTicker(cr.interval)
+		tickers = append(tickers, ticker)
+		watch = ticker.C
+	}
+	if cr.refresh > 0 {
+		ticker := time.NewTicker(cr.refresh)
+		tickers = append(tickers, ticker)
+		refresh = ticker.C
+	}
+
+	last := fileStamp(cr.path)
+	go func() {
+		defer signal.Stop(hup)
+		for _, ticker := range tickers {
+			defer ticker.Stop()
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				cr.Reload(ctx, "SIGHUP")
+			case <-watch:
+				if stamp := fileStamp(cr.path); stamp != last {
+					last = stamp
+					cr.Reload(ctx, "file change")
+				}
+			case <-refresh:
+				cr.Reload(ctx, "secrets refresh")
+			}
+		}
+	}()
+}
+
+// fileStamp identifies a version of a file by size and modification time.
+// A missing file has the zero stamp.
+func fileStamp(path string) [2]int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return [2]int64{}
+	}
+	return [2]int64{info.Size(), info.ModTime().UnixNano()}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigStore(t *testing.T) {
+	store := NewConfigStore(Config{MaxAirports: 3})
+	snapshot := store.Load()
+
+	store.Store(Config{MaxAirports: 7})
+	assert.Equal(t, 3, snapshot.MaxAirports, "a snapshot is not changed by a later store")
+	assert.Equal(t, 7, store.Load().MaxAirports)
+}
+
+// newTestReloader loads the config from a file the test can rewrite
+func newTestReloader(t *testing.T, content string, interval time.Duration) (*ConfigReloader, *ConfigStore, string) {
+	t.Setenv("GOOGLE_MAPS_API_KEY", "test-key")
+	path := writeConfigFile(t, content)
+	configFlags := &ConfigFlags{File: path}
+
+	config, err := loadValidConfig(context.Background(), configFlags)
+	require.NoError(t, err)
+	store := NewConfigStore(config)
+	return NewConfigReloader(store, configFlags, interval, 0), store, path
+}
+
+func TestConfigReloader_Reload(t *testing.T) {
+	logs := captureLogs(t)
+	reloader, store, path := newTestReloader(t, "max_airports: 4\nport: \"9000\"\n", 0)
+
+	require.NoError(t, os.WriteFile(path, []byte("max_airports: 6\nmax_distance: 120\nport: \"9001\"\n"), 0o600))
+	require.NoError(t, reloader.Reload(context.Background(), "test"))
+
+	config := store.Load()
+	assert.Equal(t, 6, config.MaxAirports)
+	assert.Equal(t, 120.0, config.MaxDistance)
+	assert.Equal(t, "9000", config.Port, "the port needs a restart")
+
+	lines := logLines(t, logs)
+	require.NotEmpty(t, lines)
+	audit := lines[len(lines)-1]
+	assert.Equal(t, "config reloaded", audit["msg"])
+	assert.Equal(t, "test", audit["trigger"])
+	assert.ElementsMatch(t, []any{"max_airports: 4 -> 6", "max_distance: 500 -> 120"}, audit["changed"])
+	assert.Equal(t, []any{"port"}, audit["requires_restart"])
+}
+
+func TestConfigReloader_RejectsInvalid(t *testing.T) {
+	logs := captureLogs(t)
+	reloader, store, path := newTestReloader(t, "max_airports: 4\n", 0)
+
+	require.NoError(t, os.WriteFile(path, []byte("max_airports: -1\n"), 0o600))
+	assert.ErrorContains(t, reloader.Reload(context.Background(), "test"), "max_airports must be positive")
+	assert.Equal(t, 4, store.Load().MaxAirports)
+
+	require.NoError(t, os.WriteFile(path, []byte("max_airports: lots\n"), 0o600))
+	assert.Error(t, reloader.Reload(context.Background(), "test"))
+	assert.Equal(t, 4, store.Load().MaxAirports)
+
+	lines := logLines(t, logs)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "config reload rejected, keeping current configuration", lines[0]["msg"])
+	assert.Equal(t, "ERROR", lines[0]["level"])
+}
+
+func TestConfigReloader_WatchesFile(t *testing.T) {
+	captureLogs(t)
+	reloader, store, path := newTestReloader(t, "max_airports: 4\n", 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloader.Start(ctx)
+
+	require.NoError(t, os.WriteFile(path, []byte("max_airports: 8\n# changed size\n"), 0o600))
+	assert.Eventually(t, func() bool { return store.Load().MaxAirports == 8 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestConfigReloader_SIGHUP(t *testing.T) {
+	captureLogs(t)
+	reloader, store, path := newTestReloader(t, "default_radius: 1000\n", 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloader.Start(ctx)
+
+	require.NoError(t, os.WriteFile(path, []byte("default_radius: 2000\n"), 0o600))
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+	assert.Eventually(t, func() bool { return store.Load().DefaultRadius == 2000 }, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestAirportService_UsesReloadedConfig(t *testing.T) {
+	var radius string
+	gc := newStubGoogleClient(t, func(w http.ResponseWriter, r *http.Request) {
+		radius = r.URL.Query().Get("radius")
+		fmt.Fprint(w, `{"status": "OK", "results": [
+			{"name": "A (AAA)", "geometry": {"location": {"lat": 40.1, "lng": -3.7}}},
+			{"name": "B (BBB)", "geometry": {"location": {"lat": 40.2, "lng": -3.7}}},
+			{"name": "C (CCC)", "geometry": {"location": {"lat": 40.3, "lng": -3.7}}}
+		]}`)
+	})
+	store := NewConfigStore(Config{DefaultRadius: 1000, MaxAirports: 1, MaxDistance: 500})
+	as := NewAirportService(store, gc)
+	origin := Location{Latitude: 40.0, Longitude: -3.7}
+
+	airports, err := as.FindReachableAirports(context.Background(), origin)
+	require.NoError(t, err)
+	assert.Len(t, airports, 1)
+	assert.Equal(t, "1000", radius)
+
+	store.Store(Config{DefaultRadius: 5000, MaxAirports: 2, MaxDistance: 500})
+	airports, err = as.FindReachableAirports(context.Background(), origin)
+	require.NoError(t, err)
+	assert.Len(t, airports, 2)
+	assert.Equal(t, "5000", radius)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+
+	"github.com/walidBarakehe/travel-routes/renderer"
+)
+
+// rendererRoutes converts routes to what the renderer package draws
+func rendererRoutes(routes []Route) []renderer.Route {
+	converted := make([]renderer.Route, len(routes))
+	for i, route := range routes {
+		segments := make([]renderer.Segment, len(route.Segments))
+		for j, segment := range route.Segments {
+			segments[j] = renderer.Segment{
+				Mode:       segment.Mode,
+				Provider:   segment.Provider,
+				From:       renderer.Place{Name: segment.From.Name, Code: segment.From.Code},
+				To:         renderer.Place{Name: segment.To.Name, Code: segment.To.Code},
+				Departure:  segment.Departure,
+				Arrival:    segment.Arrival,
+				Duration:   segment.Duration,
+				Price:      segment.Price,
+				Currency:   segment.Currency,
+				CO2:        segment.CO2,
+				BookingURL: segment.BookingURL,
+			}
+		}
+		converted[i] = renderer.Route{
+			Description: route.Description,
+			Departure:   route.Departure,
+			Arrival:     route.Arrival,
+			TotalTime:   route.TotalTime,
+			TotalPrice:  route.TotalPrice,
+			Currency:    route.Currency,
+			TotalCO2:    route.TotalCO2,
+			Segments:    segments,
+		}
+	}
+	return converted
+}
+
+// renderRoutes writes routes in one of the renderer package's formats
+func renderRoutes(w io.Writer, format string, routes []Route, opts renderer.Options) error {
+	return renderer.Render(w, format, rendererRoutes(routes), opts)
+}
+
+// locationLabel is the short name of a location: its code if it has one
+func locationLabel(loc Location) string {
+	return renderer.Place{Name: loc.Name, Code: loc.Code}.Label()
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/walidBarakehe/travel-routes/renderer"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// assertGolden compares got with testdata/<name>.golden, rewriting the file
+// instead when the tests run with -update
+func assertGolden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", name+".golden")
+	if *updateGolden {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, got, 0o644))
+	}
+
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "run go test -update to create the golden file")
+	assert.Equal(t, string(want), string(got))
+}
+
+// renderFixture is a taxi-and-flight route, a connection through a hub
+// arriving the next day, and a route with a booking link
+func renderFixture() []Route {
+	granada := Location{Name: "Granada", Latitude: 37.1773, Longitude: -3.5986, Type: "city"}
+	madrid := Location{Name: "Madrid-Barajas Airport", Latitude: 40.4983, Longitude: -3.5676, Code: "MAD", Type: "airport"}
+	frankfurt := Location{Name: "Frankfurt Hub Airport", Latitude: 50.0379, Longitude: 8.5622, Code: "FRA", Type: "airport"}
+	telAviv := Location{Name: "Ben Gurion Airport", Latitude: 32.0055, Longitude: 34.8854, Code: "TLV", Type: "airport"}
+	day := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour, minute int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+
+	segment := func(mode, provider string, from, to Location, dep, arr time.Time, price float64) TransportOption {
+		return TransportOption{Mode: mode, Provider: provider, From: from, To: to, Departure: dep, Arrival: arr,
+			Duration: arr.Sub(dep), Price: price, Currency: "EUR"}
+	}
+
+	routes := []Route{
+		{Segments: []TransportOption{
+			segment("taxi", "Taxi", granada, madrid, at(8, 0), at(13, 15), 532.5),
+			segment("flight", "Airlines", madrid, telAviv, at(15, 0), at(19, 30), 250),
+		}},
+		{Segments: []TransportOption{
+			segment("public_transport", "Public Transport", granada, madrid, at(6, 0), at(10, 40), 42.1),
+			segment("flight", "Airlines", madrid, frankfurt, at(12, 0), at(14, 30), 200),
+			segment("flight", "Airlines", frankfurt, telAviv, at(20, 0), at(28, 45), 160),
+		}},
+		{Segments: []TransportOption{
+			segment("taxi", "Taxi | Cabify", granada, madrid, at(9, 0), at(14, 0), 520),
+			segment("flight", "Airlines", madrid, telAviv, at(16, 0), at(20, 30), 250),
+		}},
+	}
+	routes[2].Segments[1].BookingURL = "https://example.com/book/MAD-TLV"
+	for i := range routes {
+		for j := range routes[i].Segments {
+			routes[i].Segments[j].CO2 = EstimateCO2(routes[i].Segments[j])
+		}
+		routes[i].Currency = "EUR"
+		routes[i].CalculateTotals()
+	}
+	return routes
+}
+
+// TestRenderRoutes checks that converted routes draw exactly like the
+// renderer package's own fixture, which mirrors renderFixture
+func TestRenderRoutes(t *testing.T) {
+	routes := renderFixture()
+
+	for _, format := range renderer.Formats() {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, renderRoutes(&buf, format, routes, renderer.Options{}))
+			want, err := os.ReadFile(filepath.Join("renderer", "testdata", format+".golden"))
+			require.NoError(t, err)
+			assert.Equal(t, string(want), buf.String())
+		})
+	}
+}
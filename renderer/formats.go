@@ -0,0 +1,205 @@
+package renderer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// renderText lists every route with its totals and each segment
+func renderText(w io.Writer, routes []Route, opts Options) error {
+	fmt.Fprintf(w, "\nFound %d routes:\n\n", len(routes))
+	for i, route := range routes {
+		fmt.Fprintf(w, "Route %d: %s\n", i+1, route.Description)
+		fmt.Fprintf(w, "  Total Price: %s\n", FormatPrice(route.TotalPrice, route.Currency))
+		fmt.Fprintf(w, "  Total Time: %s\n", FormatDuration(route.TotalTime))
+		fmt.Fprintf(w, "  Total CO2: %s\n", FormatCO2(route.TotalCO2))
+		fmt.Fprintf(w, "  Departure: %s\n", route.Departure.Format("2006-01-02 15:04"))
+		fmt.Fprintf(w, "  Arrival: %s\n", route.Arrival.Format("2006-01-02 15:04"))
+
+		for j, segment := range route.Segments {
+			fmt.Fprintf(w, "    Segment %d: %s from %s to %s\n", j+1, opts.paint(modeColors[segment.Mode], segment.Mode), segment.From.Name, segment.To.Name)
+			fmt.Fprintf(w, "      Duration: %s, Price: %s, CO2: %s\n", FormatDuration(segment.Duration), FormatPrice(segment.Price, segment.Currency), FormatCO2(segment.CO2))
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// renderTable writes one aligned row per route. The cheapest and the
+// fastest routes are highlighted.
+func renderTable(w io.Writer, routes []Route, opts Options) error {
+	header := []string{"#", "ROUTE", "DEPART", "ARRIVE", "DURATION", "PRICE"}
+	rows := make([][]string, len(routes))
+	cheapest, fastest := 0, 0
+	for i, route := range routes {
+		rows[i] = []string{
+			fmt.Sprint(i + 1),
+			routeModes(route),
+			route.Departure.Format("2006-01-02 15:04"),
+			FormatArrival(route.Departure, route.Arrival),
+			FormatDuration(route.TotalTime),
+			FormatPrice(route.TotalPrice, route.Currency),
+		}
+		if route.TotalPrice < routes[cheapest].TotalPrice {
+			cheapest = i
+		}
+		if route.TotalTime < routes[fastest].TotalTime {
+			fastest = i
+		}
+	}
+
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for col, cell := range row {
+			widths[col] = max(widths[col], utf8.RuneCountInString(cell))
+		}
+	}
+
+	// Pad before painting so escape codes don't upset the alignment. The
+	// number and price columns are right-aligned.
+	cell := func(col int, s string) string {
+		if col == 0 || col == len(header)-1 {
+			return strings.Repeat(" ", widths[col]-utf8.RuneCountInString(s)) + s
+		}
+		return pad(s, widths[col])
+	}
+	writeRow := func(row []string, style func(col int) string) {
+		cells := make([]string, len(row))
+		for col, s := range row {
+			cells[col] = opts.paint(style(col), cell(col, s))
+		}
+		fmt.Fprintln(w, strings.TrimRight(strings.Join(cells, "  "), " "))
+	}
+
+	writeRow(header, func(int) string { return ansiBold })
+	for i, row := range rows {
+		writeRow(row, func(col int) string {
+			switch {
+			case col == 5 && i == cheapest:
+				return ansiGreen
+			case col == 4 && i == fastest:
+				return ansiGreen
+			case col == 0:
+				return ansiDim
+			}
+			return ""
+		})
+	}
+	return nil
+}
+
+// renderCompact writes a one-line summary per route
+func renderCompact(w io.Writer, routes []Route, opts Options) error {
+	for i, route := range routes {
+		fmt.Fprintf(w, "%d. %s  %s  %s → %s  %s\n",
+			i+1,
+			opts.paint(ansiBold, FormatPrice(route.TotalPrice, route.Currency)),
+			FormatDuration(route.TotalTime),
+			route.Departure.Format("Jan 2 15:04"),
+			FormatArrival(route.Departure, route.Arrival),
+			routeModes(route))
+	}
+	return nil
+}
+
+// renderTimeline draws every route's segments as bars on a shared time axis
+// from the earliest departure to the latest arrival, so routes can be
+// compared at a glance
+func renderTimeline(w io.Writer, routes []Route, opts Options) error {
+	if len(routes) == 0 {
+		fmt.Fprintln(w, "No routes.")
+		return nil
+	}
+
+	width := opts.Width
+	if width <= 0 {
+		width = 48
+	}
+	start, end := routes[0].Departure, routes[0].Arrival
+	modeWidth := 0
+	for _, route := range routes {
+		if route.Departure.Before(start) {
+			start = route.Departure
+		}
+		if route.Arrival.After(end) {
+			end = route.Arrival
+		}
+		for _, segment := range route.Segments {
+			modeWidth = max(modeWidth, len(segment.Mode))
+		}
+	}
+	span := end.Sub(start)
+	if span <= 0 {
+		span = time.Minute
+	}
+	column := func(t time.Time) int {
+		return int(float64(t.Sub(start)) / float64(span) * float64(width))
+	}
+
+	indent := strings.Repeat(" ", modeWidth+3)
+	axisEnd := end.Format("15:04")
+	if !dateOf(end).Equal(dateOf(start)) {
+		axisEnd = end.Format("Jan 2 15:04")
+	}
+	axis := start.Format("Jan 2 15:04")
+	fmt.Fprintf(w, "%s%s%s%s\n", indent, axis, strings.Repeat(" ", max(1, width+2-len(axis)-len(axisEnd))), axisEnd)
+
+	for i, route := range routes {
+		fmt.Fprintf(w, "\n%s  %s  %s\n", opts.paint(ansiBold, fmt.Sprintf("Route %d", i+1)),
+			FormatPrice(route.TotalPrice, route.Currency), FormatDuration(route.TotalTime))
+
+		for _, segment := range route.Segments {
+			from, to := column(segment.Departure), column(segment.Arrival)
+			to = min(max(to, from+1), width)
+			from = min(from, to-1)
+
+			bar := strings.Repeat(" ", from) +
+				opts.paint(modeColors[segment.Mode], strings.Repeat("█", to-from)) +
+				strings.Repeat(" ", width-to)
+			fmt.Fprintf(w, "  %s |%s| %s-%s %s → %s\n",
+				pad(segment.Mode, modeWidth), bar,
+				segment.Departure.Format("15:04"), FormatArrival(segment.Departure, segment.Arrival),
+				segment.From.Label(), segment.To.Label())
+		}
+	}
+	return nil
+}
+
+// renderMarkdown writes a summary table and one segment table per route,
+// ready to paste into a ticket
+func renderMarkdown(w io.Writer, routes []Route, opts Options) error {
+	escape := strings.NewReplacer("|", `\|`, "\n", " ").Replace
+
+	fmt.Fprintf(w, "## %d routes\n\n", len(routes))
+	if len(routes) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(w, "| # | Route | Departure | Arrival | Duration | Price |")
+	fmt.Fprintln(w, "|---|-------|-----------|---------|----------|------:|")
+	for i, route := range routes {
+		fmt.Fprintf(w, "| %d | %s | %s | %s | %s | %s |\n", i+1, escape(route.Description),
+			route.Departure.Format("2006-01-02 15:04"), route.Arrival.Format("2006-01-02 15:04"),
+			FormatDuration(route.TotalTime), FormatPrice(route.TotalPrice, route.Currency))
+	}
+
+	for i, route := range routes {
+		fmt.Fprintf(w, "\n### Route %d\n\n", i+1)
+		fmt.Fprintln(w, "| Mode | From | To | Departure | Arrival | Provider | Price |")
+		fmt.Fprintln(w, "|------|------|----|-----------|---------|----------|------:|")
+		for _, segment := range route.Segments {
+			provider := escape(segment.Provider)
+			if segment.BookingURL != "" {
+				provider = fmt.Sprintf("[%s](%s)", provider, segment.BookingURL)
+			}
+			fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s | %s |\n", segment.Mode,
+				escape(segment.From.Name), escape(segment.To.Name),
+				segment.Departure.Format("15:04"), FormatArrival(segment.Departure, segment.Arrival),
+				provider, FormatPrice(segment.Price, segment.Currency))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+// Package renderer draws travel routes for people to read: a detailed
+// listing, aligned tables, one-line summaries, timelines and Markdown.
+// Routes are passed in the package's own types, which carry only what the
+// formats show.
+package renderer
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Place is one end of a segment
+type Place struct {
+	Name string
+	Code string // e.g. an IATA airport code, when it has one
+}
+
+// Label is the short name of a place: its code if it has one
+func (p Place) Label() string {
+	if p.Code != "" {
+		return p.Code
+	}
+	return p.Name
+}
+
+// Segment is one leg of a route
+type Segment struct {
+	Mode       string // "flight", "taxi", "public_transport", "train", "bus", "ferry"
+	Provider   string
+	From, To   Place
+	Departure  time.Time
+	Arrival    time.Time
+	Duration   time.Duration
+	Price      float64
+	Currency   string
+	CO2        float64 // kg CO2e
+	BookingURL string
+}
+
+// Route is a whole journey and its totals
+type Route struct {
+	Description string
+	Departure   time.Time
+	Arrival     time.Time
+	TotalTime   time.Duration
+	TotalPrice  float64
+	Currency    string
+	TotalCO2    float64 // kg CO2e
+	Segments    []Segment
+}
+
+// Options controls how routes are drawn
+type Options struct {
+	Color bool // ANSI colours
+	Width int  // width of the timeline bars; 0 = 48
+}
+
+// Func writes routes in one format
+type Func func(w io.Writer, routes []Route, opts Options) error
+
+// formats are the route formats, by name
+var formats = map[string]Func{
+	"text":     renderText,
+	"table":    renderTable,
+	"compact":  renderCompact,
+	"timeline": renderTimeline,
+	"markdown": renderMarkdown,
+}
+
+// Formats lists the names Render accepts, sorted
+func Formats() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Render writes routes in the named format
+func Render(w io.Writer, format string, routes []Route, opts Options) error {
+	render, ok := formats[format]
+	if !ok {
+		return fmt.Errorf("unknown route format %q", format)
+	}
+	return render(w, routes, opts)
+}
+
+// FormatDuration renders a duration the way people write it: "8h30m",
+// "45m", "2d3h"; seconds are dropped
+func FormatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d <= 0 {
+		return "0m"
+	}
+
+	days := d / (24 * time.Hour)
+	hours := (d % (24 * time.Hour)) / time.Hour
+	minutes := (d % time.Hour) / time.Minute
+
+	var b strings.Builder
+	if days > 0 {
+		fmt.Fprintf(&b, "%dd", days)
+	}
+	if hours > 0 {
+		fmt.Fprintf(&b, "%dh", hours)
+	}
+	if minutes > 0 && days == 0 {
+		fmt.Fprintf(&b, "%dm", minutes)
+	}
+	return b.String()
+}
+
+// FormatPrice renders an amount with its currency
+func FormatPrice(amount float64, currency string) string {
+	return fmt.Sprintf("%.2f %s", amount, currency)
+}
+
+// FormatCO2 renders an emissions figure, e.g. "245.3 kg CO2e"
+func FormatCO2(kg float64) string {
+	return fmt.Sprintf("%.1f kg CO2e", kg)
+}
+
+// FormatArrival renders an arrival time, marking arrivals on a later day
+// than departure with "+N"
+func FormatArrival(departure, arrival time.Time) string {
+	days := int(dateOf(arrival).Sub(dateOf(departure)).Hours() / 24)
+	if days > 0 {
+		return fmt.Sprintf("%s+%d", arrival.Format("15:04"), days)
+	}
+	return arrival.Format("15:04")
+}
+
+func dateOf(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// routeModes lists the modes of a route's segments, e.g. "taxi → flight"
+func routeModes(route Route) string {
+	modes := make([]string, len(route.Segments))
+	for i, segment := range route.Segments {
+		modes[i] = segment.Mode
+	}
+	return strings.Join(modes, " → ")
+}
+
+// ANSI styles
+const (
+	ansiReset   = "\x1b[0m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiBlue    = "\x1b[34m"
+	ansiCyan    = "\x1b[36m"
+	ansiMagenta = "\x1b[35m"
+)
+
+// modeColors gives every transport mode its own colour
+var modeColors = map[string]string{
+	"flight":           ansiBlue,
+	"taxi":             ansiYellow,
+	"public_transport": ansiGreen,
+	"train":            ansiGreen,
+	"bus":              ansiCyan,
+	"ferry":            ansiMagenta,
+}
+
+// paint wraps s in an ANSI style when colours are on
+func (opts Options) paint(style, s string) string {
+	if !opts.Color || style == "" {
+		return s
+	}
+	return style + s + ansiReset
+}
+
+// pad right-pads s to width runes
+func pad(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
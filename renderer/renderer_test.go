@@ -0,0 +1,130 @@
+package renderer
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// assertGolden compares got with testdata/<name>.golden, rewriting the file
+// instead when the tests run with -update
+func assertGolden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", name+".golden")
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(path, got, 0o644))
+	}
+
+	want, err := os.ReadFile(path)
+	require.NoError(t, err, "run go test -update to create the golden file")
+	assert.Equal(t, string(want), string(got))
+}
+
+// fixture is a taxi-and-flight route, a connection through a hub arriving
+// the next day, and a route with a booking link
+func fixture() []Route {
+	granada := Place{Name: "Granada"}
+	madrid := Place{Name: "Madrid-Barajas Airport", Code: "MAD"}
+	frankfurt := Place{Name: "Frankfurt Hub Airport", Code: "FRA"}
+	telAviv := Place{Name: "Ben Gurion Airport", Code: "TLV"}
+	day := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour, minute int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+	}
+
+	segment := func(mode, provider string, from, to Place, dep, arr time.Time, price, co2 float64) Segment {
+		return Segment{Mode: mode, Provider: provider, From: from, To: to, Departure: dep, Arrival: arr,
+			Duration: arr.Sub(dep), Price: price, Currency: "EUR", CO2: co2}
+	}
+	route := func(description string, segments ...Segment) Route {
+		route := Route{Description: description, Currency: "EUR", Segments: segments,
+			Departure: segments[0].Departure, Arrival: segments[len(segments)-1].Arrival}
+		route.TotalTime = route.Arrival.Sub(route.Departure)
+		for _, segment := range segments {
+			route.TotalPrice += segment.Price
+			route.TotalCO2 += segment.CO2
+		}
+		return route
+	}
+
+	routes := []Route{
+		route("taxi (Taxi) → flight (Airlines)",
+			segment("taxi", "Taxi", granada, madrid, at(8, 0), at(13, 15), 532.5, 55),
+			segment("flight", "Airlines", madrid, telAviv, at(15, 0), at(19, 30), 250, 577.9)),
+		route("public_transport (Public Transport) → flight (Airlines) → flight (Airlines)",
+			segment("public_transport", "Public Transport", granada, madrid, at(6, 0), at(10, 40), 42.1, 29.2),
+			segment("flight", "Airlines", madrid, frankfurt, at(12, 0), at(14, 30), 200, 231.5),
+			segment("flight", "Airlines", frankfurt, telAviv, at(20, 0), at(28, 45), 160, 481.6)),
+		route("taxi (Taxi | Cabify) → flight (Airlines)",
+			segment("taxi", "Taxi | Cabify", granada, madrid, at(9, 0), at(14, 0), 520, 55),
+			segment("flight", "Airlines", madrid, telAviv, at(16, 0), at(20, 30), 250, 577.9)),
+	}
+	routes[2].Segments[1].BookingURL = "https://example.com/book/MAD-TLV"
+	return routes
+}
+
+func TestRender_Golden(t *testing.T) {
+	routes := fixture()
+
+	for _, tc := range []struct {
+		format string
+		color  bool
+	}{
+		{"text", false},
+		{"table", false},
+		{"table", true},
+		{"compact", false},
+		{"timeline", false},
+		{"timeline", true},
+		{"markdown", false},
+	} {
+		name := tc.format
+		if tc.color {
+			name += "_color"
+		}
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, Render(&buf, tc.format, routes, Options{Color: tc.color}))
+			assertGolden(t, name, buf.Bytes())
+		})
+	}
+}
+
+func TestRender_Empty(t *testing.T) {
+	assert.Equal(t, []string{"compact", "markdown", "table", "text", "timeline"}, Formats())
+	for _, format := range Formats() {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(t, Render(&buf, format, nil, Options{}))
+		})
+	}
+
+	assert.EqualError(t, Render(&bytes.Buffer{}, "xml", nil, Options{}), `unknown route format "xml"`)
+}
+
+func TestFormatDuration(t *testing.T) {
+	for d, expected := range map[time.Duration]string{
+		0:                             "0m",
+		45 * time.Minute:              "45m",
+		8*time.Hour + 30*time.Minute:  "8h30m",
+		3 * time.Hour:                 "3h",
+		90*time.Second + time.Hour:    "1h2m",
+		26*time.Hour + 10*time.Minute: "1d2h",
+		48 * time.Hour:                "2d",
+	} {
+		assert.Equal(t, expected, FormatDuration(d), d.String())
+	}
+}
+
+func TestFormatArrival(t *testing.T) {
+	dep := time.Date(2024, 7, 1, 20, 0, 0, 0, time.UTC)
+	assert.Equal(t, "22:30", FormatArrival(dep, dep.Add(150*time.Minute)))
+	assert.Equal(t, "04:45+1", FormatArrival(dep, dep.Add(8*time.Hour+45*time.Minute)))
+}
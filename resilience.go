@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy describes how failed upstream calls are retried
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// Attempts returns the total number of attempts, at least one
+func (p RetryPolicy) Attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// Backoff returns a jittered delay before the given retry (1 for the first
+// retry). It uses "full jitter": a random duration between zero and the
+// exponentially growing cap.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+
+	ceiling := p.BaseDelay << uint(retry-1)
+	if ceiling <= 0 || (p.MaxDelay > 0 && ceiling > p.MaxDelay) {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// Cap limits a delay asked for by the upstream, such as Retry-After, to
+// MaxDelay so one response can't stall a call for longer
+func (p RetryPolicy) Cap(d time.Duration) time.Duration {
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return d
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Circuit breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half_open"
+)
+
+// CircuitBreaker stops calls to an upstream after too many consecutive
+// failures, then lets a single trial call through once the cooldown expires
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewCircuitBreaker creates a breaker. A threshold below one disables it.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+		state:     breakerClosed,
+	}
+}
+
+// Allow reports whether a call may proceed
+func (cb *CircuitBreaker) Allow() bool {
+	if cb.threshold < 1 {
+		return true
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case breakerOpen:
+		if cb.now().Sub(cb.openedAt) < cb.cooldown {
+			return false
+		}
+		cb.state = breakerHalfOpen
+		cb.probing = true
+		return true
+	case breakerHalfOpen:
+		// Only one trial call at a time
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// RecordSuccess closes the breaker
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.state = breakerClosed
+	cb.failures = 0
+	cb.probing = false
+}
+
+// RecordFailure counts a failure, opening the breaker at the threshold or
+// straight away if the trial call of a half-open breaker failed
+func (cb *CircuitBreaker) RecordFailure() {
+	if cb.threshold < 1 {
+		return
+	}
+
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	if cb.state == breakerHalfOpen || cb.failures >= cb.threshold {
+		cb.state = breakerOpen
+		cb.openedAt = cb.now()
+		cb.probing = false
+	}
+}
+
+// Release gives up a call whose outcome says nothing about the upstream,
+// such as one the caller cancelled, so a half-open breaker lets the next
+// trial call through
+func (cb *CircuitBreaker) Release() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.probing = false
+}
+
+// State returns the current breaker state
+func (cb *CircuitBreaker) State() string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+// ResilientTransport is an http.RoundTripper that applies a per-attempt
+// timeout, retries network errors, 5xx and 429 responses with jittered
+// backoff, and keeps a circuit breaker per upstream host
+type ResilientTransport struct {
+	base    http.RoundTripper
+	retry   RetryPolicy
+	timeout time.Duration
+
+	breakerThreshold int
+	breakerCooldown  time.Duration
+
+	mu       sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+// NewResilientTransport wraps base (http.DefaultTransport if nil) using the
+// retry, timeout and breaker settings from config
+func NewResilientTransport(config Config, base http.RoundTripper) *ResilientTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &ResilientTransport{
+		base: base,
+		retry: RetryPolicy{
+			MaxAttempts: config.RetryMaxAttempts,
+			BaseDelay:   config.RetryBaseDelay,
+			MaxDelay:    config.RetryMaxDelay,
+		},
+		timeout:          config.UpstreamTimeout,
+		breakerThreshold: config.BreakerThreshold,
+		breakerCooldown:  config.BreakerCooldown,
+		breakers:         make(map[string]*CircuitBreaker),
+	}
+}
+
+// Breaker returns the circuit breaker for a host, creating it on first use
+func (t *ResilientTransport) Breaker(host string) *CircuitBreaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	cb, ok := t.breakers[host]
+	if !ok {
+		cb = NewCircuitBreaker(t.breakerThreshold, t.breakerCooldown)
+		t.breakers[host] = cb
+	}
+	return cb
+}
+
+// RoundTrip implements http.RoundTripper. Only requests without a body are
+// retried, which covers every GET the services make.
+func (t *ResilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	breaker := t.Breaker(req.URL.Host)
+	attempts := t.retry.Attempts()
+	if req.Body != nil && req.Body != http.NoBody {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		if !breaker.Allow() {
+			return nil, fmt.Errorf("%w: circuit breaker open for %s", ErrUpstreamUnavailable, req.URL.Host)
+		}
+
+		resp, err := t.attempt(req)
+		retryable := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+
+		// 429 means we are being throttled, not that the upstream is down,
+		// and a caller giving up says nothing about the upstream either. The
+		// per-attempt timeout has its own context, so it still counts.
+		switch {
+		case req.Context().Err() != nil:
+			breaker.Release()
+		case err != nil || resp.StatusCode >= 500:
+			breaker.RecordFailure()
+		default:
+			breaker.RecordSuccess()
+		}
+
+		if !retryable || attempt >= attempts || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		delay := t.retry.Backoff(attempt)
+		if resp != nil {
+			if retryAfter := t.retry.Cap(parseRetryAfter(resp.Header.Get("Retry-After"))); retryAfter > delay {
+				delay = retryAfter
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt performs one try with the per-call timeout. The timeout stays
+// active until the caller closes the response body.
+func (t *ResilientTransport) attempt(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.base.RoundTrip(req.Clone(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds
+func parseRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
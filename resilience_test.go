@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+
+	for retry, ceiling := range map[int]time.Duration{1: 100, 2: 200, 3: 300, 10: 300} {
+		for i := 0; i < 50; i++ {
+			delay := policy.Backoff(retry)
+			assert.GreaterOrEqual(t, delay, time.Duration(0))
+			assert.LessOrEqual(t, delay, ceiling*time.Millisecond)
+		}
+	}
+
+	assert.Equal(t, time.Duration(0), RetryPolicy{}.Backoff(1))
+	assert.Equal(t, 1, RetryPolicy{}.Attempts())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC)
+	cb := NewCircuitBreaker(2, time.Minute)
+	cb.now = func() time.Time { return now }
+
+	assert.True(t, cb.Allow())
+	cb.RecordFailure()
+	assert.Equal(t, breakerClosed, cb.State())
+	cb.RecordFailure()
+	assert.Equal(t, breakerOpen, cb.State())
+	assert.False(t, cb.Allow())
+
+	// After the cooldown a single trial call is let through
+	now = now.Add(time.Minute)
+	assert.True(t, cb.Allow())
+	assert.Equal(t, breakerHalfOpen, cb.State())
+	assert.False(t, cb.Allow())
+
+	// A failed trial reopens the breaker immediately
+	cb.RecordFailure()
+	assert.Equal(t, breakerOpen, cb.State())
+
+	now = now.Add(time.Minute)
+	assert.True(t, cb.Allow())
+	cb.RecordSuccess()
+	assert.Equal(t, breakerClosed, cb.State())
+	assert.True(t, cb.Allow())
+}
+
+func TestCircuitBreaker_Disabled(t *testing.T) {
+	cb := NewCircuitBreaker(0, time.Minute)
+	for i := 0; i < 10; i++ {
+		cb.RecordFailure()
+	}
+	assert.True(t, cb.Allow())
+}
+
+// countingServer fails the first failures requests with status, then succeeds
+func countingServer(t *testing.T, failures int32, status int) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		fmt.Fprint(w, `{"status": "OK"}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func testResilienceConfig() Config {
+	return Config{
+		RetryMaxAttempts: 3,
+		RetryBaseDelay:   time.Millisecond,
+		RetryMaxDelay:    5 * time.Millisecond,
+		UpstreamTimeout:  time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  time.Minute,
+	}
+}
+
+func TestResilientTransport_Retries(t *testing.T) {
+	t.Run("Recovers from server errors", func(t *testing.T) {
+		server, calls := countingServer(t, 2, http.StatusServiceUnavailable)
+		client := &http.Client{Transport: NewResilientTransport(testResilienceConfig(), nil)}
+
+		resp, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+		assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+	})
+
+	t.Run("Retries rate limiting", func(t *testing.T) {
+		server, calls := countingServer(t, 1, http.StatusTooManyRequests)
+		client := &http.Client{Transport: NewResilientTransport(testResilienceConfig(), nil)}
+
+		resp, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+		assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+	})
+
+	t.Run("Gives up after max attempts", func(t *testing.T) {
+		server, calls := countingServer(t, 10, http.StatusBadGateway)
+		client := &http.Client{Transport: NewResilientTransport(testResilienceConfig(), nil)}
+
+		resp, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+		resp.Body.Close()
+		assert.Equal(t, int32(3), atomic.LoadInt32(calls))
+	})
+
+	t.Run("Does not retry client errors", func(t *testing.T) {
+		server, calls := countingServer(t, 10, http.StatusBadRequest)
+		client := &http.Client{Transport: NewResilientTransport(testResilienceConfig(), nil)}
+
+		resp, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, int32(1), atomic.LoadInt32(calls))
+	})
+}
+
+func TestResilientTransport_CircuitBreaker(t *testing.T) {
+	server, calls := countingServer(t, 100, http.StatusInternalServerError)
+	config := testResilienceConfig()
+	config.RetryMaxAttempts = 1
+	config.BreakerThreshold = 2
+	client := &http.Client{Transport: NewResilientTransport(config, nil)}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	_, err := client.Get(server.URL)
+	assert.ErrorIs(t, err, ErrUpstreamUnavailable)
+	assert.Equal(t, int32(2), atomic.LoadInt32(calls))
+}
+
+func TestResilientTransport_CallerCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	t.Cleanup(server.Close)
+
+	config := testResilienceConfig()
+	config.BreakerThreshold = 1
+	transport := NewResilientTransport(config, nil)
+	client := &http.Client{Transport: transport}
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		req, err := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+		require.NoError(t, err)
+		_, err = client.Do(req)
+		cancel()
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+
+	assert.Equal(t, breakerClosed, transport.Breaker(strings.TrimPrefix(server.URL, "http://")).State())
+
+	t.Run("Half-open trial", func(t *testing.T) {
+		breaker := NewCircuitBreaker(1, 0)
+		breaker.RecordFailure()
+		require.True(t, breaker.Allow())
+		breaker.Release()
+		assert.True(t, breaker.Allow(), "an abandoned trial doesn't block the next one")
+	})
+}
+
+func TestResilientTransport_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	config := testResilienceConfig()
+	config.RetryMaxAttempts = 1
+	config.UpstreamTimeout = 20 * time.Millisecond
+	config.BreakerThreshold = 1
+	transport := NewResilientTransport(config, nil)
+	gc := NewGoogleClient(config, &http.Client{Transport: transport}, nil)
+	gc.baseURL = server.URL
+
+	err := gc.Get(context.Background(), "geocode", "geocode/json", url.Values{}, &GoogleGeocodingResponse{})
+	assert.ErrorIs(t, err, ErrUpstreamTimeout)
+	assert.Equal(t, breakerOpen, transport.Breaker(strings.TrimPrefix(server.URL, "http://")).State(), "an upstream timeout counts against it")
+}
+
+func TestGoogleClient_RetriesOverQueryLimit(t *testing.T) {
+	var calls int32
+	gc := newStubGoogleClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			fmt.Fprint(w, `{"results": [], "status": "OVER_QUERY_LIMIT"}`)
+			return
+		}
+		fmt.Fprint(w, `{"results": [], "status": "OK"}`)
+	})
+	gc.retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	err := gc.Get(context.Background(), "places", "place/nearbysearch/json", url.Values{}, &GooglePlacesResponse{})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestResilientTransport_RetryAfterCapped(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"status": "OK"}`)
+	}))
+	t.Cleanup(server.Close)
+	client := &http.Client{Transport: NewResilientTransport(testResilienceConfig(), nil)}
+
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Less(t, time.Since(start), time.Second, "waits retry_max_delay, not an hour")
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Wed, 21 Oct 2015 07:28:00 GMT"))
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/walidBarakehe/travel-routes/renderer"
+)
+
+// routeMapFormats are the formats that draw routes on a map, with their
+// content types
+var routeMapFormats = map[string]struct {
+	contentType string
+	write       func(w io.Writer, routes []Route) error
+}{
+	"geojson": {"application/geo+json", WriteGeoJSON},
+	"kml":     {"application/vnd.google-earth.kml+xml", WriteKML},
+}
+
+// geoJSONFeature is one segment of a route in a GeoJSON FeatureCollection
+type geoJSONFeature struct {
+	Type       string            `json:"type"`
+	Geometry   *geoJSONGeometry  `json:"geometry"` // null when a location has no coordinates
+	Properties segmentProperties `json:"properties"`
+}
+
+// geoJSONGeometry is a LineString, or a MultiLineString for a path cut at
+// the antimeridian. Positions are [longitude, latitude].
+type geoJSONGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+func newGeoJSONGeometry(path []LatLng) *geoJSONGeometry {
+	parts := splitAntimeridian(path)
+	lines := make([][][2]float64, len(parts))
+	for i, part := range parts {
+		lines[i] = make([][2]float64, len(part))
+		for j, p := range part {
+			lines[i][j] = [2]float64{roundCoordinate(p.Lng), roundCoordinate(p.Lat)}
+		}
+	}
+
+	if len(lines) == 1 {
+		return &geoJSONGeometry{Type: "LineString", Coordinates: lines[0]}
+	}
+	return &geoJSONGeometry{Type: "MultiLineString", Coordinates: lines}
+}
+
+// segmentProperties describe a segment on the map
+type segmentProperties struct {
+	Route           int       `json:"route"`   // 1-based, in result order
+	Segment         int       `json:"segment"` // 1-based within the route
+	Mode            string    `json:"mode"`
+	From            string    `json:"from"`
+	To              string    `json:"to"`
+	Provider        string    `json:"provider"`
+	Price           float64   `json:"price"`
+	Currency        string    `json:"currency"`
+	Departure       time.Time `json:"departure"`
+	Arrival         time.Time `json:"arrival"`
+	DurationMinutes int       `json:"duration_minutes"`
+	DistanceKm      float64   `json:"distance_km,omitempty"`
+	CO2Kg           float64   `json:"co2_kg"`
+	BookingURL      string    `json:"booking_url,omitempty"`
+}
+
+func newSegmentProperties(route, index int, segment TransportOption) segmentProperties {
+	return segmentProperties{
+		Route:           route + 1,
+		Segment:         index + 1,
+		Mode:            segment.Mode,
+		From:            segment.From.Name,
+		To:              segment.To.Name,
+		Provider:        segment.Provider,
+		Price:           segment.Price,
+		Currency:        segment.Currency,
+		Departure:       segment.Departure,
+		Arrival:         segment.Arrival,
+		DurationMinutes: int(segment.Duration.Minutes()),
+		DistanceKm:      segment.Distance,
+		CO2Kg:           segment.CO2,
+		BookingURL:      segment.BookingURL,
+	}
+}
+
+// roundCoordinate keeps six decimals, about 10 cm, which is plenty for a map
+func roundCoordinate(deg float64) float64 {
+	return math.Round(deg*1e6) / 1e6
+}
+
+// WriteGeoJSON writes routes as a GeoJSON FeatureCollection with one
+// feature per segment
+func WriteGeoJSON(w io.Writer, routes []Route) error {
+	features := []geoJSONFeature{}
+	for i, route := range routes {
+		for j, segment := range route.Segments {
+			feature := geoJSONFeature{Type: "Feature", Properties: newSegmentProperties(i, j, segment)}
+			if path := segmentPath(segment); path != nil {
+				feature.Geometry = newGeoJSONGeometry(path)
+			}
+			features = append(features, feature)
+		}
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		Type     string           `json:"type"`
+		Features []geoJSONFeature `json:"features"`
+	}{"FeatureCollection", features})
+}
+
+// KML document structure; only the elements used here
+type kmlDocument struct {
+	XMLName xml.Name    `xml:"http://www.opengis.net/kml/2.2 kml"`
+	Name    string      `xml:"Document>name"`
+	Styles  []kmlStyle  `xml:"Document>Style"`
+	Folders []kmlFolder `xml:"Document>Folder"`
+}
+
+type kmlStyle struct {
+	ID    string `xml:"id,attr"`
+	Color string `xml:"LineStyle>color"` // aabbggrr
+	Width int    `xml:"LineStyle>width"`
+}
+
+type kmlFolder struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description"`
+	Begin       string         `xml:"TimeSpan>begin"`
+	End         string         `xml:"TimeSpan>end"`
+	StyleURL    string         `xml:"styleUrl"`
+	Data        []kmlData      `xml:"ExtendedData>Data"`
+	LineString  *kmlLineString `xml:"LineString"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+// kmlColors are the line colours per mode, matching the terminal ones
+var kmlColors = map[string]string{
+	"flight":           "ffff0000", // blue
+	"taxi":             "ff00ffff", // yellow
+	"public_transport": "ff00ff00", // green
+	"train":            "ff00ff00",
+	"bus":              "ffffff00", // cyan
+	"ferry":            "ffff00ff", // magenta
+}
+
+// WriteKML writes routes as a KML document with a folder per route and a
+// placemark per segment, for Google Earth and most GIS tools
+func WriteKML(w io.Writer, routes []Route) error {
+	doc := kmlDocument{Name: fmt.Sprintf("%d routes", len(routes))}
+
+	styled := map[string]bool{}
+	for i, route := range routes {
+		folder := kmlFolder{Name: fmt.Sprintf("Route %d: %s", i+1, route.Description)}
+		for j, segment := range route.Segments {
+			if !styled[segment.Mode] {
+				styled[segment.Mode] = true
+				color, ok := kmlColors[segment.Mode]
+				if !ok {
+					color = "ff888888"
+				}
+				doc.Styles = append(doc.Styles, kmlStyle{ID: segment.Mode, Color: color, Width: 3})
+			}
+
+			props := newSegmentProperties(i, j, segment)
+			placemark := kmlPlacemark{
+				Name:        fmt.Sprintf("%s %s → %s", modeLabel(segment.Mode), locationLabel(segment.From), locationLabel(segment.To)),
+				Description: fmt.Sprintf("%s, %s", segment.Provider, renderer.FormatPrice(segment.Price, segment.Currency)),
+				Begin:       segment.Departure.Format(time.RFC3339),
+				End:         segment.Arrival.Format(time.RFC3339),
+				StyleURL:    "#" + segment.Mode,
+				Data: []kmlData{
+					{"mode", props.Mode},
+					{"from", props.From},
+					{"to", props.To},
+					{"provider", props.Provider},
+					{"price", fmt.Sprintf("%.2f", props.Price)},
+					{"currency", props.Currency},
+					{"departure", props.Departure.Format(time.RFC3339)},
+					{"arrival", props.Arrival.Format(time.RFC3339)},
+					{"duration_minutes", fmt.Sprint(props.DurationMinutes)},
+					{"co2_kg", fmt.Sprintf("%.1f", props.CO2Kg)},
+				},
+			}
+			if segment.Distance > 0 {
+				placemark.Data = append(placemark.Data, kmlData{"distance_km", fmt.Sprintf("%.1f", segment.Distance)})
+			}
+			if segment.BookingURL != "" {
+				placemark.Data = append(placemark.Data, kmlData{"booking_url", segment.BookingURL})
+			}
+			if path := segmentPath(segment); path != nil {
+				coords := make([]string, len(path))
+				for k, p := range path {
+					coords[k] = fmt.Sprintf("%g,%g", roundCoordinate(p.Lng), roundCoordinate(p.Lat))
+				}
+				placemark.LineString = &kmlLineString{Tessellate: 1, Coordinates: strings.Join(coords, " ")}
+			}
+			folder.Placemarks = append(folder.Placemarks, placemark)
+		}
+		doc.Folders = append(doc.Folders, folder)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteGeoJSON(t *testing.T) {
+	routes := renderFixture()
+	var buf bytes.Buffer
+	require.NoError(t, WriteGeoJSON(&buf, routes))
+
+	var collection struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Geometry struct {
+				Type        string       `json:"type"`
+				Coordinates [][2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties map[string]any `json:"properties"`
+		} `json:"features"`
+	}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &collection))
+	assert.Equal(t, "FeatureCollection", collection.Type)
+	require.Len(t, collection.Features, 7, "one feature per segment")
+
+	taxi := collection.Features[0]
+	assert.Equal(t, "LineString", taxi.Geometry.Type)
+	assert.Equal(t, [][2]float64{{-3.5986, 37.1773}, {-3.5676, 40.4983}}, taxi.Geometry.Coordinates, "longitude first")
+	assert.Equal(t, "taxi", taxi.Properties["mode"])
+	assert.Equal(t, 532.5, taxi.Properties["price"])
+	assert.Equal(t, "2024-07-01T08:00:00Z", taxi.Properties["departure"])
+
+	flight := collection.Features[6]
+	assert.Greater(t, len(flight.Geometry.Coordinates), 2, "flights follow the great circle")
+	assert.Equal(t, float64(3), flight.Properties["route"])
+	assert.Equal(t, "https://example.com/book/MAD-TLV", flight.Properties["booking_url"])
+
+	t.Run("No coordinates", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteGeoJSON(&buf, []Route{{Segments: []TransportOption{{Mode: "flight"}}}}))
+		assert.Contains(t, buf.String(), `"geometry":null`)
+	})
+
+	t.Run("Across the antimeridian", func(t *testing.T) {
+		flight := TransportOption{Mode: "flight",
+			From: Location{Latitude: 35.7720, Longitude: 140.3929}, To: Location{Latitude: 33.9416, Longitude: -118.4085}}
+		var buf bytes.Buffer
+		require.NoError(t, WriteGeoJSON(&buf, []Route{{Segments: []TransportOption{flight}}}))
+
+		var collection struct {
+			Features []struct {
+				Geometry struct {
+					Type        string         `json:"type"`
+					Coordinates [][][2]float64 `json:"coordinates"`
+				} `json:"geometry"`
+			} `json:"features"`
+		}
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &collection))
+		assert.Equal(t, "MultiLineString", collection.Features[0].Geometry.Type)
+		assert.Len(t, collection.Features[0].Geometry.Coordinates, 2)
+	})
+
+	t.Run("No routes", func(t *testing.T) {
+		var buf bytes.Buffer
+		require.NoError(t, WriteGeoJSON(&buf, nil))
+		assert.JSONEq(t, `{"type": "FeatureCollection", "features": []}`, buf.String())
+	})
+}
+
+func TestWriteKML(t *testing.T) {
+	routes := renderFixture()[:1]
+	routes[0].Segments[0].Provider = "Taxi & Co <Granada>"
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteKML(&buf, routes))
+	assertGolden(t, filepath.Join("map", "route.kml"), buf.Bytes())
+
+	var doc kmlDocument
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &doc), "escaped text stays well-formed")
+	assert.Equal(t, "Taxi & Co <Granada>, 532.50 EUR", doc.Folders[0].Placemarks[0].Description)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// SearchStore keeps recent search results in memory so they can be fetched
+// again by ID, e.g. to export a route to a calendar after booking or to
+// page through them. Each search belongs to the API key that ran it and is
+// only returned to that key. Results expire after ttl, and once limit
+// searches are stored the oldest is dropped.
+type SearchStore struct {
+	ttl   time.Duration
+	limit int
+	now   func() time.Time
+
+	mu       sync.Mutex
+	searches map[string]*storedSearch
+	order    []string // IDs, oldest first
+}
+
+type storedSearch struct {
+	owner   string // ID of the API key that ran the search, "" without auth
+	routes  []Route
+	expires time.Time
+}
+
+func NewSearchStore(ttl time.Duration, limit int) *SearchStore {
+	return &SearchStore{
+		ttl:      ttl,
+		limit:    limit,
+		now:      time.Now,
+		searches: make(map[string]*storedSearch),
+	}
+}
+
+// Create starts an empty search for owner and returns its ID. Routes are
+// added with Append as they are found.
+func (ss *SearchStore) Create(owner string) string {
+	id, err := randomHex(8)
+	if err != nil {
+		id = time.Now().Format("20060102150405.000000000")
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	ss.evict()
+	ss.searches[id] = &storedSearch{owner: owner, expires: ss.now().Add(ss.ttl)}
+	ss.order = append(ss.order, id)
+	return id
+}
+
+// Save stores a finished search for owner and returns its ID
+func (ss *SearchStore) Save(owner string, routes []Route) string {
+	id := ss.Create(owner)
+	ss.Append(id, routes)
+	return id
+}
+
+// Append adds routes to a search, keeping the order they were returned in
+func (ss *SearchStore) Append(id string, routes []Route) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if search, ok := ss.searches[id]; ok {
+		search.routes = append(search.routes, routes...)
+	}
+}
+
+// Get returns the routes of a search by owner that hasn't expired. Another
+// owner's search is reported as missing, so IDs can't be probed.
+func (ss *SearchStore) Get(id, owner string) ([]Route, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	search, ok := ss.searches[id]
+	if !ok || search.owner != owner || !ss.now().Before(search.expires) {
+		return nil, false
+	}
+	return search.routes, true
+}
+
+// evict drops expired searches and, if the store is full, the oldest ones.
+// Searches expire in creation order, so both come off the front.
+func (ss *SearchStore) evict() {
+	now := ss.now()
+	drop := 0
+	for drop < len(ss.order) {
+		search := ss.searches[ss.order[drop]]
+		if now.Before(search.expires) && len(ss.order)-drop < ss.limit {
+			break
+		}
+		delete(ss.searches, ss.order[drop])
+		drop++
+	}
+	ss.order = ss.order[drop:]
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchStore(t *testing.T) {
+	now := time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+	ss := NewSearchStore(time.Hour, 2)
+	ss.now = func() time.Time { return now }
+
+	first := ss.Save("key-1", []Route{{Description: "a"}})
+	routes, ok := ss.Get(first, "key-1")
+	assert.True(t, ok)
+	assert.Equal(t, "a", routes[0].Description)
+
+	streamed := ss.Create("key-1")
+	ss.Append(streamed, []Route{{Description: "b"}})
+	ss.Append(streamed, []Route{{Description: "c"}})
+	routes, _ = ss.Get(streamed, "key-1")
+	assert.Len(t, routes, 2)
+
+	_, ok = ss.Get("unknown", "key-1")
+	assert.False(t, ok)
+
+	t.Run("Other owners", func(t *testing.T) {
+		_, ok := ss.Get(first, "key-2")
+		assert.False(t, ok)
+		_, ok = ss.Get(first, "")
+		assert.False(t, ok)
+	})
+
+	t.Run("Oldest dropped when full", func(t *testing.T) {
+		third := ss.Save("", nil)
+		_, ok := ss.Get(first, "key-1")
+		assert.False(t, ok)
+		_, ok = ss.Get(third, "")
+		assert.True(t, ok)
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		_, ok := ss.Get(streamed, "key-1")
+		assert.False(t, ok)
+
+		ss.Save("", nil)
+		assert.Len(t, ss.order, 1, "expired searches are dropped on the next save")
+	})
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// SecretProvider fetches secrets from outside the process environment.
+// Secrets are keyed like config file keys (google_maps_api_key); keys the
+// backend doesn't hold are left out, so the environment value still applies.
+type SecretProvider interface {
+	Secrets(ctx context.Context) (map[string]string, error)
+}
+
+// NewSecretProvider returns the backend selected by config.SecretsBackend,
+// or nil for "env", where secrets come only from the environment and
+// <env>_FILE files
+func NewSecretProvider(config Config) (SecretProvider, error) {
+	if err := config.validateSecretsBackend(); err != nil {
+		return nil, err
+	}
+
+	switch config.SecretsBackend {
+	case "file":
+		key, _ := parseSecretsKey(config.SecretsKey)
+		return &EncryptedFileSecrets{path: config.SecretsFile, key: key}, nil
+	case "vault":
+		return &VaultSecrets{
+			addr:   strings.TrimSuffix(config.VaultAddr, "/"),
+			token:  config.VaultToken,
+			path:   strings.Trim(config.VaultPath, "/"),
+			client: &http.Client{Timeout: config.UpstreamTimeout},
+		}, nil
+	}
+	return nil, nil
+}
+
+// ResolveSecrets overlays the secrets held by the configured backend onto
+// config. Only secret settings are taken from the backend.
+func ResolveSecrets(ctx context.Context, config *Config) error {
+	provider, err := NewSecretProvider(*config)
+	if err != nil || provider == nil {
+		return err
+	}
+
+	secrets, err := provider.Secrets(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets from %s backend: %w", config.SecretsBackend, err)
+	}
+	for _, f := range config.fields() {
+		val, ok := secrets[f.key()]
+		if !ok || !f.secret {
+			continue
+		}
+		if err := f.set(val); err != nil {
+			return fmt.Errorf("secret %s: %w", f.key(), err)
+		}
+	}
+	return nil
+}
+
+// readSecretFile reads the secret named by $<env>_FILE, as mounted by Docker
+// and Kubernetes secrets. The file is read on every load so a rotated secret
+// is picked up by the next reload.
+func readSecretFile(env string) (string, bool, error) {
+	path := os.Getenv(env + "_FILE")
+	if path == "" {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s_FILE: %w", env, err)
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+// EncryptedFileSecrets reads secrets from a local file encrypted with
+// AES-256-GCM. The file holds base64 of nonce followed by the sealed JSON
+// object; write it with "travel-routes secrets encrypt".
+type EncryptedFileSecrets struct {
+	path string
+	key  []byte
+}
+
+func (es *EncryptedFileSecrets) Secrets(ctx context.Context) (map[string]string, error) {
+	data, err := os.ReadFile(es.path)
+	if err != nil {
+		return nil, err
+	}
+	return decryptSecrets(es.key, data)
+}
+
+// parseSecretsKey decodes a base64 AES-256 key
+func parseSecretsKey(encoded string) ([]byte, error) {
+	if encoded == "" {
+		return nil, errors.New("is required to open the secrets file")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.New("must be base64")
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// NewSecretsKey generates a random key for an encrypted secrets file,
+// base64 encoded for SECRETS_KEY
+func NewSecretsKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// EncryptSecrets seals secrets for an encrypted secrets file
+func EncryptSecrets(key []byte, secrets map[string]string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return []byte(base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+func decryptSecrets(key, data []byte) (map[string]string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("secrets file is not in the expected format")
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("secrets file can't be decrypted with this key")
+	}
+
+	var secrets map[string]string
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("secrets file: %w", err)
+	}
+	return secrets, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// VaultSecrets reads a secret from a HashiCorp Vault compatible HTTP API.
+// path is the full API path after /v1/: "secret/data/travel-routes" for a
+// KV version 2 mount or "secret/travel-routes" for version 1.
+type VaultSecrets struct {
+	addr   string
+	token  string
+	path   string
+	client *http.Client
+}
+
+func (vs *VaultSecrets) Secrets(ctx context.Context) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, vs.addr+"/v1/"+vs.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", vs.token)
+
+	resp, err := vs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("vault returned %s for %s: %s", resp.Status, vs.path, strings.TrimSpace(string(body)))
+	}
+
+	// KV version 2 nests the secret under data.data next to data.metadata
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("invalid vault response: %w", err)
+	}
+	data := body.Data
+	if inner, ok := data["data"].(map[string]any); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+
+	secrets := make(map[string]string, len(data))
+	for key, val := range data {
+		if s, ok := val.(string); ok {
+			secrets[key] = s
+		}
+	}
+	return secrets, nil
+}
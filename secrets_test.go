@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSecret writes a secret file the way Docker and Kubernetes mount them
+func writeSecret(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfigSecretFiles(t *testing.T) {
+	t.Run("Read from file", func(t *testing.T) {
+		t.Setenv("GOOGLE_MAPS_API_KEY", "")
+		t.Setenv("GOOGLE_MAPS_API_KEY_FILE", writeSecret(t, "key-from-file\n"))
+
+		config, err := LoadConfig()
+		require.NoError(t, err)
+		assert.Equal(t, "key-from-file", config.GoogleMapsAPIKey)
+	})
+
+	t.Run("Both set", func(t *testing.T) {
+		t.Setenv("GOOGLE_MAPS_API_KEY", "key-from-env")
+		t.Setenv("GOOGLE_MAPS_API_KEY_FILE", writeSecret(t, "key-from-file"))
+
+		_, err := LoadConfig()
+		assert.ErrorContains(t, err, "GOOGLE_MAPS_API_KEY and GOOGLE_MAPS_API_KEY_FILE are both set")
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		t.Setenv("ADMIN_TOKEN_FILE", filepath.Join(t.TempDir(), "missing"))
+
+		_, err := LoadConfig()
+		assert.ErrorContains(t, err, "ADMIN_TOKEN_FILE")
+	})
+}
+
+func TestEncryptedFileSecrets(t *testing.T) {
+	encoded, err := NewSecretsKey()
+	require.NoError(t, err)
+	key, err := parseSecretsKey(encoded)
+	require.NoError(t, err)
+
+	data, err := EncryptSecrets(key, map[string]string{"google_maps_api_key": "AIza-encrypted"})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "AIza-encrypted")
+
+	secrets, err := decryptSecrets(key, data)
+	require.NoError(t, err)
+	assert.Equal(t, "AIza-encrypted", secrets["google_maps_api_key"])
+
+	otherKey, err := NewSecretsKey()
+	require.NoError(t, err)
+	wrong, _ := parseSecretsKey(otherKey)
+	_, err = decryptSecrets(wrong, data)
+	assert.EqualError(t, err, "secrets file can't be decrypted with this key")
+
+	_, err = decryptSecrets(key, []byte("not base64!"))
+	assert.Error(t, err)
+
+	t.Run("Resolved into config", func(t *testing.T) {
+		config := DefaultConfig()
+		config.GoogleMapsAPIKey = "key-from-env"
+		config.SecretsBackend = "file"
+		config.SecretsFile = writeSecret(t, string(data))
+		config.SecretsKey = encoded
+
+		require.NoError(t, ResolveSecrets(context.Background(), &config))
+		assert.Equal(t, "AIza-encrypted", config.GoogleMapsAPIKey)
+	})
+}
+
+func TestParseSecretsKey(t *testing.T) {
+	_, err := parseSecretsKey("")
+	assert.Error(t, err)
+	_, err = parseSecretsKey("!!!")
+	assert.EqualError(t, err, "must be base64")
+	_, err = parseSecretsKey("c2hvcnQ=")
+	assert.EqualError(t, err, "must be 32 bytes, got 5")
+}
+
+// vaultStub is a stand-in for a Vault KV version 2 mount holding one secret
+type vaultStub struct {
+	mu      sync.Mutex
+	secrets map[string]string
+	server  *httptest.Server
+}
+
+func newVaultStub(t *testing.T, token string, secrets map[string]string) *vaultStub {
+	vs := &vaultStub{secrets: secrets}
+	vs.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != token {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"errors":["permission denied"]}`)
+			return
+		}
+		if r.URL.Path != "/v1/secret/data/travel-routes" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"errors":[]}`)
+			return
+		}
+
+		vs.mu.Lock()
+		defer vs.mu.Unlock()
+		data := ""
+		for key, val := range vs.secrets {
+			if data != "" {
+				data += ","
+			}
+			data += fmt.Sprintf("%q: %q", key, val)
+		}
+		fmt.Fprintf(w, `{"data": {"data": {%s}, "metadata": {"version": 3}}}`, data)
+	}))
+	t.Cleanup(vs.server.Close)
+	return vs
+}
+
+func (vs *vaultStub) set(key, val string) {
+	vs.mu.Lock()
+	defer vs.mu.Unlock()
+	vs.secrets[key] = val
+}
+
+func TestVaultSecrets(t *testing.T) {
+	vault := newVaultStub(t, "vault-token", map[string]string{"google_maps_api_key": "AIza-vault", "port": "1"})
+
+	config := DefaultConfig()
+	config.SecretsBackend = "vault"
+	config.VaultAddr = vault.server.URL + "/"
+	config.VaultToken = "vault-token"
+	config.VaultPath = "/secret/data/travel-routes"
+
+	require.NoError(t, ResolveSecrets(context.Background(), &config))
+	assert.Equal(t, "AIza-vault", config.GoogleMapsAPIKey)
+	assert.Equal(t, "8080", config.Port, "only secrets are taken from the backend")
+
+	t.Run("Wrong token", func(t *testing.T) {
+		config := config
+		config.VaultToken = "expired"
+		err := ResolveSecrets(context.Background(), &config)
+		assert.ErrorContains(t, err, "403 Forbidden")
+		assert.ErrorContains(t, err, "permission denied")
+	})
+
+	t.Run("KV version 1", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"data": {"admin_token": "from-kv1"}}`)
+		}))
+		defer server.Close()
+
+		vs := &VaultSecrets{addr: server.URL, path: "secret/travel-routes", client: server.Client()}
+		secrets, err := vs.Secrets(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"admin_token": "from-kv1"}, secrets)
+	})
+
+	t.Run("Missing settings", func(t *testing.T) {
+		config := DefaultConfig()
+		config.SecretsBackend = "vault"
+		err := ResolveSecrets(context.Background(), &config)
+		assert.ErrorContains(t, err, "vault_addr is required")
+		assert.ErrorContains(t, err, "vault_token is required")
+	})
+}
+
+func TestConfigReloader_RotatesSecrets(t *testing.T) {
+	logs := captureLogs(t)
+	vault := newVaultStub(t, "vault-token", map[string]string{"google_maps_api_key": "AIza-old"})
+	t.Setenv("GOOGLE_MAPS_API_KEY", "")
+	t.Setenv("SECRETS_BACKEND", "vault")
+	t.Setenv("VAULT_ADDR", vault.server.URL)
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	t.Setenv("VAULT_PATH", "secret/data/travel-routes")
+
+	config, err := loadValidConfig(context.Background(), nil)
+	require.NoError(t, err)
+	tf := NewTravelFinder(config)
+
+	var gotKey string
+	google := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.URL.Query().Get("key")
+		fmt.Fprint(w, `{"results": [], "status": "OK"}`)
+	}))
+	defer google.Close()
+	tf.google.baseURL = google.URL
+
+	require.NoError(t, tf.google.Get(context.Background(), "geocode", "geocode/json", url.Values{}, &GoogleGeocodingResponse{}))
+	assert.Equal(t, "AIza-old", gotKey)
+
+	vault.set("google_maps_api_key", "AIza-new")
+	reloader := NewConfigReloader(tf.config, nil, 0, 0)
+	require.NoError(t, reloader.Reload(context.Background(), "secrets refresh"))
+
+	require.NoError(t, tf.google.Get(context.Background(), "geocode", "geocode/json", url.Values{}, &GoogleGeocodingResponse{}))
+	assert.Equal(t, "AIza-new", gotKey)
+
+	var audit map[string]any
+	for _, line := range logLines(t, logs) {
+		if line["msg"] == "config reloaded" {
+			audit = line
+		}
+	}
+	require.NotNil(t, audit)
+	assert.Equal(t, "INFO", audit["level"])
+	assert.Equal(t, []any{"google_maps_api_key: rotated"}, audit["changed"])
+	assert.NotContains(t, logs.String(), "AIza-new")
+}
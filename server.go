@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+)
+
+// NewServer builds the HTTP server: routes, middleware and timeouts. A nil
+// keyStore leaves the search endpoints open.
+func NewServer(config Config, tf *TravelFinder, keyStore *KeyStore) *http.Server {
+	return &http.Server{
+		Addr:         ":" + config.Port,
+		Handler:      NewRouter(config, tf, keyStore),
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+		IdleTimeout:  config.IdleTimeout,
+	}
+}
+
+// NewRouter registers every endpoint with its allowed methods and wraps the
+// result in the middleware chain
+func NewRouter(config Config, tf *TravelFinder, keyStore *KeyStore) http.Handler {
+	admin := NewAdminHandler(keyStore, config)
+
+	metrics := tf.metrics
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /search", metrics.InstrumentHandler("search", keyStore.RequireAPIKey(tf.handleSearchRoutes)))
+	mux.HandleFunc("GET /search/{id}/ics", metrics.InstrumentHandler("search_ics", keyStore.RequireAPIKey(tf.handleSearchICS)))
+	mux.HandleFunc("GET /airports", metrics.InstrumentHandler("airports", keyStore.RequireAPIKey(tf.handleNearbyAirports)))
+	mux.HandleFunc("GET /health", metrics.InstrumentHandler("health", handleHealth))
+	mux.HandleFunc("GET /healthz", metrics.InstrumentHandler("healthz", tf.health.handleLiveness))
+	mux.HandleFunc("GET /readyz", metrics.InstrumentHandler("readyz", tf.health.handleReadiness))
+	mux.HandleFunc("GET /admin/keys", metrics.InstrumentHandler("admin_list_keys", admin.handleListKeys))
+	mux.HandleFunc("POST /admin/keys", metrics.InstrumentHandler("admin_issue_key", admin.handleIssueKey))
+	mux.HandleFunc("DELETE /admin/keys/{id}", metrics.InstrumentHandler("admin_revoke_key", admin.handleRevokeKey))
+	mux.HandleFunc("GET /metrics", RequireToken(config.MetricsToken, "/metrics", metrics.Handler()))
+
+	return Chain(mux,
+		RequestID,
+		Tracing,
+		AccessLog,
+		Recover,
+		CORS(config.CORSAllowedOrigins),
+		Gzip,
+		Timeout(config.RequestTimeout),
+	)
+}
+
+// handleHealth is the original plain-text health check, kept for existing
+// monitors. New deployments should probe /healthz and /readyz.
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	config := Config{GoogleMapsAPIKey: "test-key", CORSAllowedOrigins: []string{"*"}}
+	router := NewRouter(config, NewTravelFinder(config), nil)
+
+	t.Run("Health", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "OK", w.Body.String())
+		assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("Method not allowed", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/search", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Contains(t, w.Header().Get("Allow"), "GET")
+	})
+
+	t.Run("Unknown path", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/nope", nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Search validation goes through the chain", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/search?origin=Madrid", nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRouter_RequiresAPIKey(t *testing.T) {
+	config := Config{GoogleMapsAPIKey: "test-key"}
+	router := NewRouter(config, NewTravelFinder(config), newTestKeyStore(t))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/search?origin=Madrid", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code, "closed without a metrics token")
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRouter_NoCORSByDefault(t *testing.T) {
+	config := DefaultConfig()
+	config.GoogleMapsAPIKey = "test-key"
+	router := NewRouter(config, NewTravelFinder(config), nil)
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestNewServer(t *testing.T) {
+	config, err := LoadConfig()
+	require.NoError(t, err)
+	server := NewServer(config, NewTravelFinder(config), nil)
+
+	assert.Equal(t, ":8080", server.Addr)
+	assert.Equal(t, config.ReadTimeout, server.ReadTimeout)
+	assert.Equal(t, config.WriteTimeout, server.WriteTimeout)
+	assert.Equal(t, config.IdleTimeout, server.IdleTimeout)
+}
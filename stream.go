@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	streamNDJSON = "ndjson"
+	streamSSE    = "sse"
+)
+
+// streamFormat picks the streaming format from the stream query parameter,
+// falling back to the Accept header. An empty result means no streaming.
+func streamFormat(r *http.Request) (string, error) {
+	switch format := r.URL.Query().Get("stream"); format {
+	case streamNDJSON, streamSSE:
+		return format, nil
+	case "":
+	default:
+		return "", invalidInput("unsupported stream format %q (use ndjson or sse)", format)
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/x-ndjson"):
+		return streamNDJSON, nil
+	case strings.Contains(accept, "text/event-stream"):
+		return streamSSE, nil
+	}
+
+	return "", nil
+}
+
+// routeStreamer writes routes to the client one at a time, flushing after
+// each batch. Headers are only sent with the first route so that failures
+// before any result can still be reported with a regular error response.
+type routeStreamer struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	format  string
+	started bool
+	count   int
+}
+
+func newRouteStreamer(w http.ResponseWriter, format string) (*routeStreamer, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming not supported by this connection")
+	}
+
+	return &routeStreamer{w: w, flusher: flusher, format: format}, nil
+}
+
+func (s *routeStreamer) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+
+	// Streams outlive the server's write timeout; the request context still
+	// bounds how long the search runs
+	http.NewResponseController(s.w).SetWriteDeadline(time.Time{})
+
+	if s.format == streamSSE {
+		s.w.Header().Set("Content-Type", "text/event-stream")
+		s.w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		s.w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	s.w.WriteHeader(http.StatusOK)
+}
+
+// WriteRoutes sends a batch of routes and flushes them to the client
+func (s *routeStreamer) WriteRoutes(routes []Route) error {
+	s.start()
+
+	for _, route := range routes {
+		if err := s.writeEvent("route", route); err != nil {
+			return err
+		}
+		s.count++
+	}
+
+	s.flusher.Flush()
+	return nil
+}
+
+// Finish terminates the stream. Without an error it sends a final summary
+// (SSE only, NDJSON simply ends); with an error it falls back to a problem
+// response if nothing has been written yet, or sends a problem record otherwise.
+func (s *routeStreamer) Finish(err error) {
+	if err != nil && !s.started {
+		writeProblem(s.w, fmt.Errorf("error finding routes: %w", err))
+		return
+	}
+
+	s.start()
+	if err != nil {
+		err = fmt.Errorf("error finding routes: %w", err)
+		recordCause(s.w, err)
+		s.writeEvent("error", NewProblem(err))
+	} else if s.format == streamSSE {
+		s.writeEvent("done", map[string]int{"count": s.count})
+	}
+	s.flusher.Flush()
+}
+
+func (s *routeStreamer) writeEvent(event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if s.format == streamSSE {
+		_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, data)
+	} else {
+		_, err = fmt.Fprintf(s.w, "%s\n", data)
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		url         string
+		accept      string
+		expected    string
+		expectError bool
+	}{
+		{name: "No streaming", url: "/search", expected: ""},
+		{name: "NDJSON query", url: "/search?stream=ndjson", expected: streamNDJSON},
+		{name: "SSE query", url: "/search?stream=sse", expected: streamSSE},
+		{name: "NDJSON accept header", url: "/search", accept: "application/x-ndjson", expected: streamNDJSON},
+		{name: "SSE accept header", url: "/search", accept: "text/event-stream", expected: streamSSE},
+		{name: "Unknown format", url: "/search?stream=xml", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			format, err := streamFormat(req)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, format)
+		})
+	}
+}
+
+func TestRouteStreamerNDJSON(t *testing.T) {
+	w := httptest.NewRecorder()
+	streamer, err := newRouteStreamer(w, streamNDJSON)
+	assert.NoError(t, err)
+
+	assert.NoError(t, streamer.WriteRoutes([]Route{{TotalPrice: 100}, {TotalPrice: 200}}))
+	assert.NoError(t, streamer.WriteRoutes([]Route{{TotalPrice: 50}}))
+	streamer.Finish(nil)
+
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.True(t, w.Flushed)
+
+	var prices []float64
+	scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for scanner.Scan() {
+		var route Route
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &route))
+		prices = append(prices, route.TotalPrice)
+	}
+	assert.Equal(t, []float64{100, 200, 50}, prices)
+}
+
+func TestRouteStreamerSSE(t *testing.T) {
+	w := httptest.NewRecorder()
+	streamer, err := newRouteStreamer(w, streamSSE)
+	assert.NoError(t, err)
+
+	assert.NoError(t, streamer.WriteRoutes([]Route{{TotalPrice: 100}}))
+	streamer.Finish(nil)
+
+	body := w.Body.String()
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	assert.Contains(t, body, "event: route\ndata: {")
+	assert.Contains(t, body, "event: done\ndata: {\"count\":1}\n\n")
+}
+
+func TestRouteStreamerErrors(t *testing.T) {
+	t.Run("Error before any route", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		streamer, _ := newRouteStreamer(w, streamNDJSON)
+		streamer.Finish(fmt.Errorf("%w: Atlantis", ErrGeocodeNotFound))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		assert.Contains(t, w.Body.String(), "Atlantis")
+	})
+
+	t.Run("Error after routes were sent", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		streamer, _ := newRouteStreamer(w, streamSSE)
+		streamer.WriteRoutes([]Route{{TotalPrice: 100}})
+		streamer.Finish(fmt.Errorf("%w: connection reset", ErrUpstream))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "event: error\ndata: {")
+		assert.Contains(t, w.Body.String(), `"code":"upstream_error"`)
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TimeZoneService finds the time zones of places with the Google Time Zone
+// API. Answers are kept for the life of the process, since a place's zone
+// practically never changes.
+type TimeZoneService struct {
+	google *GoogleClient
+
+	mu    sync.Mutex
+	zones map[LatLng]string
+}
+
+func NewTimeZoneService(google *GoogleClient) *TimeZoneService {
+	return &TimeZoneService{google: google, zones: make(map[LatLng]string)}
+}
+
+// TimeZone returns the IANA name of the zone at p, e.g. "Europe/Madrid"
+func (ts *TimeZoneService) TimeZone(ctx context.Context, p LatLng) (string, error) {
+	ts.mu.Lock()
+	zone, ok := ts.zones[p]
+	ts.mu.Unlock()
+	if ok {
+		return zone, nil
+	}
+
+	params := url.Values{}
+	params.Add("location", fmt.Sprintf("%f,%f", p.Lat, p.Lng))
+	params.Add("timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+
+	var resp GoogleTimeZoneResponse
+	if err := ts.google.Get(ctx, "timezone", "timezone/json", params, &resp); err != nil {
+		return "", fmt.Errorf("time zone lookup failed: %w", err)
+	}
+
+	ts.mu.Lock()
+	ts.zones[p] = resp.TimeZoneID
+	ts.mu.Unlock()
+	return resp.TimeZoneID, nil
+}
+
+// AddTimeZones returns route with the time zone filled in at both ends of
+// every segment. Ends without coordinates, or whose lookup fails, are left
+// without one.
+func (ts *TimeZoneService) AddTimeZones(ctx context.Context, route Route) Route {
+	route.Segments = slices.Clone(route.Segments)
+	for i := range route.Segments {
+		for _, loc := range []*Location{&route.Segments[i].From, &route.Segments[i].To} {
+			p, ok := locationPoint(*loc)
+			if loc.TimeZone != "" || !ok {
+				continue
+			}
+			zone, err := ts.TimeZone(ctx, p)
+			if err != nil {
+				LoggerFromContext(ctx).Warn("no time zone", slog.String("location", loc.Name), errorAttr(err))
+				continue
+			}
+			loc.TimeZone = zone
+		}
+	}
+	return route
+}
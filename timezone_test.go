@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeZoneService_AddTimeZones(t *testing.T) {
+	calls := 0
+	ts := NewTimeZoneService(newStubGoogleClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, "/timezone/json", r.URL.Path)
+		fmt.Fprint(w, `{"status": "OK", "timeZoneId": "Europe/Madrid"}`)
+	}))
+
+	madrid := Location{Name: "Madrid", Latitude: 40.4168, Longitude: -3.7038}
+	route := Route{Segments: []TransportOption{
+		{From: madrid, To: Location{Name: "Granada", TimeZone: "Europe/Madrid"}},
+		{From: madrid, To: Location{Name: "Unplaced"}},
+	}}
+
+	zoned := ts.AddTimeZones(context.Background(), route)
+	assert.Equal(t, "Europe/Madrid", zoned.Segments[0].From.TimeZone)
+	assert.Equal(t, "Europe/Madrid", zoned.Segments[1].From.TimeZone)
+	assert.Empty(t, zoned.Segments[1].To.TimeZone, "no coordinates to look up")
+	assert.Empty(t, route.Segments[0].From.TimeZone, "the stored route is left alone")
+	assert.Equal(t, 1, calls, "Madrid is looked up once")
+}
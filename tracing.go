@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "travel-routes"
+
+// tracer creates the service's spans from the current global provider, so
+// spans are no-ops until SetupTracing installs an exporter
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/walidBarakehe/travel-routes")
+}
+
+// SetupTracing installs the global tracer provider selected by
+// config.TracingExporter: "stdout" prints spans as JSON, "otlp" sends them
+// over OTLP/HTTP (configured with the standard OTEL_EXPORTER_OTLP_* env
+// vars, localhost:4318 by default), and "" or "none" leaves tracing off.
+// The returned function flushes and stops the exporter.
+func SetupTracing(ctx context.Context, config Config) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+
+	switch config.TracingExporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case "otlp":
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q (use stdout, otlp or none)", config.TracingExporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", config.TracingExporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.TracingSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
+
+// endSpan records err on the span, if any, and ends it. Errors can quote
+// request URLs, so the API key is redacted from their text first.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		msg := redactAPIKey(err.Error())
+		span.RecordError(errors.New(msg))
+		span.SetStatus(codes.Error, msg)
+	}
+	span.End()
+}
+
+type rawQueryContextKey struct{}
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newTracedTransport gives each request through base a client span. The
+// query string carries the Google API key, so otelhttp sees the request
+// without it and base gets it back.
+func newTracedTransport(base http.RoundTripper) http.RoundTripper {
+	traced := otelhttp.NewTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if query, ok := req.Context().Value(rawQueryContextKey{}).(string); ok {
+			req = req.Clone(req.Context())
+			req.URL.RawQuery = query
+		}
+		return base.RoundTrip(req)
+	}))
+
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.RawQuery == "" {
+			return traced.RoundTrip(req)
+		}
+		stripped := req.Clone(context.WithValue(req.Context(), rawQueryContextKey{}, req.URL.RawQuery))
+		stripped.URL.RawQuery = ""
+		return traced.RoundTrip(stripped)
+	})
+}
+
+// locationAttributes describes a location on a span under the given prefix
+func locationAttributes(prefix string, loc Location) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String(prefix+".name", loc.Name)}
+	if loc.Code != "" {
+		attrs = append(attrs, attribute.String(prefix+".code", loc.Code))
+	}
+	return attrs
+}
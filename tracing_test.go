@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a global tracer provider that keeps finished spans in
+// memory, restoring the previous provider when the test ends
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	previousPropagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	return recorder
+}
+
+// findSpan returns the first finished span with the given name
+func findSpan(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	require.Failf(t, "span not found", "no span named %q", name)
+	return nil
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestSetupTracing(t *testing.T) {
+	shutdown, err := SetupTracing(context.Background(), Config{TracingExporter: "none"})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = SetupTracing(context.Background(), Config{TracingExporter: "zipkin"})
+	assert.ErrorContains(t, err, "unknown tracing exporter")
+}
+
+func TestTracing_FindRoutesSpans(t *testing.T) {
+	recorder := recordSpans(t)
+
+	tf := NewTravelFinder(Config{GoogleMapsAPIKey: "test-key"})
+	tf.google.baseURL = newStubGoogleClient(t, googleStatusHandler("REQUEST_DENIED", "bad key")).baseURL
+
+	_, err := tf.FindRoutes(context.Background(), "Madrid", "Barcelona", time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC))
+	require.Error(t, err)
+
+	root := findSpan(t, recorder, "FindRoutes")
+	assert.Equal(t, codes.Error, root.Status().Code)
+	assert.Equal(t, "Madrid", spanAttribute(root, "search.origin").AsString())
+	assert.Equal(t, "2024-07-01", spanAttribute(root, "search.date").AsString())
+
+	geocode := findSpan(t, recorder, "google.geocode")
+	assert.Equal(t, root.SpanContext().SpanID(), geocode.Parent().SpanID())
+	assert.Equal(t, "REQUEST_DENIED", spanAttribute(geocode, "google.status").AsString())
+	assert.Equal(t, codes.Error, geocode.Status().Code)
+
+	// The outbound HTTP request is traced underneath the Google call
+	var httpSpans int
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() == geocode.SpanContext().SpanID() {
+			httpSpans++
+		}
+	}
+	assert.Equal(t, 1, httpSpans)
+}
+
+func TestTracing_HidesAPIKey(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var gotKey string
+	stub := newStubGoogleClient(t, func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.URL.Query().Get("key")
+		googleStatusHandler("ZERO_RESULTS", "")(w, r)
+	})
+	tf := NewTravelFinder(Config{GoogleMapsAPIKey: "secret-key"})
+	tf.google.baseURL = stub.baseURL
+
+	err := tf.google.Get(context.Background(), "geocode", "geocode/json", url.Values{"address": {"Madrid"}}, &GoogleGeocodingResponse{})
+	require.ErrorIs(t, err, ErrZeroResults)
+	assert.Equal(t, "secret-key", gotKey, "the request itself keeps the key")
+
+	// Errors quoting a request URL are redacted too
+	_, span := tracer().Start(context.Background(), "failed")
+	endSpan(span, fmt.Errorf("geocode request: %w", &url.Error{Op: "Get", URL: stub.baseURL + "/geocode/json?key=secret-key", Err: errors.New("refused")}))
+
+	require.Len(t, recorder.Ended(), 3)
+	for _, span := range recorder.Ended() {
+		assert.NotContains(t, span.Name(), "secret-key")
+		assert.NotContains(t, span.Status().Description, "secret-key")
+		for _, kv := range span.Attributes() {
+			assert.NotContains(t, kv.Value.Emit(), "secret-key", "%s on %s", kv.Key, span.Name())
+		}
+		for _, event := range span.Events() {
+			for _, kv := range event.Attributes {
+				assert.NotContains(t, kv.Value.Emit(), "secret-key", "%s on %s", kv.Key, span.Name())
+			}
+		}
+	}
+	assert.Contains(t, findSpan(t, recorder, "failed").Status().Description, "key=REDACTED")
+}
+
+func TestTracing_AirportSpan(t *testing.T) {
+	recorder := recordSpans(t)
+
+	tf := NewTravelFinder(Config{GoogleMapsAPIKey: "test-key"})
+	tf.google.baseURL = newStubGoogleClient(t, googleStatusHandler("ZERO_RESULTS", "")).baseURL
+
+	origin := Location{Name: "Granada", Latitude: 37.1773, Longitude: -3.5986}
+	airport := Location{Name: "Madrid Barajas", Code: "MAD", Latitude: 40.4983, Longitude: -3.5676}
+	destination := Location{Name: "Ben Gurion", Code: "TLV"}
+	plan := searchPlan{origin: origin, destinationAirport: destination}
+	routes := tf.routesViaAirport(context.Background(), plan, airport, time.Now())
+
+	span := findSpan(t, recorder, "search.airport")
+	assert.Equal(t, "MAD", spanAttribute(span, "airport.code").AsString())
+	assert.Equal(t, int64(len(routes)), spanAttribute(span, "search.routes").AsInt64())
+
+	directions := findSpan(t, recorder, "google.directions")
+	assert.Equal(t, span.SpanContext().SpanID(), directions.Parent().SpanID())
+	assert.Equal(t, "ZERO_RESULTS", spanAttribute(directions, "google.status").AsString())
+
+	flights := findSpan(t, recorder, "flights.search")
+	assert.Equal(t, "TLV", spanAttribute(flights, "flight.to.code").AsString())
+}
+
+func TestTracing_Middleware(t *testing.T) {
+	recorder := recordSpans(t)
+
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}), RequestID, Tracing)
+
+	req := httptest.NewRequest("GET", "/search", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	span := findSpan(t, recorder, "GET /search")
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	assert.Equal(t, "req-42", spanAttribute(span, "request_id").AsString())
+
+	// Metrics scrapes are left out
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+	assert.Len(t, recorder.Ended(), 1)
+}
@@ -2,64 +2,61 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"math"
 	"net/url"
+	"strings"
 	"time"
 )
 
 type TransportService struct {
-	config Config
-	client *http.Client
+	config    *ConfigStore
+	google    *GoogleClient
+	timetable *JourneyPlanner // local transit timetable, nil to ask Google only
 }
 
-func NewTransportService(config Config, client *http.Client) *TransportService {
+func NewTransportService(config *ConfigStore, google *GoogleClient) *TransportService {
 	return &TransportService{
 		config: config,
-		client: client,
+		google: google,
 	}
 }
 
 // GetGroundTransport gets ground transportation options
-func (ts *TransportService) GetGroundTransport(from, to Location, date time.Time) (TransportOption, error) {
-	// Try public transit first
-	transitOption, err := ts.getPublicTransit(from, to, date)
-	if err == nil {
-		return transitOption, nil
+func (ts *TransportService) GetGroundTransport(ctx context.Context, from, to Location, date time.Time) (TransportOption, error) {
+	// The local timetable answers without a Google call
+	if ts.timetable != nil {
+		if option, ok := ts.getTimetableTransit(from, to, date); ok {
+			return option, nil
+		}
+	}
+
+	// Try public transit first, unless the Google budget is running low
+	if !ts.google.Degraded() {
+		transitOption, err := ts.getPublicTransit(ctx, from, to, date)
+		if err == nil {
+			return transitOption, nil
+		}
 	}
 
 	// Fallback to taxi estimate
 	return ts.getTaxiEstimate(from, to, date)
 }
 
-func (ts *TransportService) getPublicTransit(from, to Location, date time.Time) (TransportOption, error) {
-	baseURL := "https://maps.googleapis.com/maps/api/directions/json"
+func (ts *TransportService) getPublicTransit(ctx context.Context, from, to Location, date time.Time) (TransportOption, error) {
 	params := url.Values{}
 	params.Add("origin", fmt.Sprintf("%f,%f", from.Latitude, from.Longitude))
 	params.Add("destination", fmt.Sprintf("%f,%f", to.Latitude, to.Longitude))
 	params.Add("mode", "transit")
 	params.Add("departure_time", fmt.Sprintf("%d", date.Unix()))
-	params.Add("key", ts.config.GoogleMapsAPIKey)
-
-	resp, err := ts.client.Get(baseURL + "?" + params.Encode())
-	if err != nil {
-		return TransportOption{}, err
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return TransportOption{}, err
-	}
 
 	var directionsResp GoogleDirectionsResponse
-	if err := json.Unmarshal(body, &directionsResp); err != nil {
+	if err := ts.google.Get(ctx, "directions", "directions/json", params, &directionsResp); err != nil {
 		return TransportOption{}, err
 	}
 
-	if directionsResp.Status != "OK" || len(directionsResp.Routes) == 0 || len(directionsResp.Routes[0].Legs) == 0 {
+	if len(directionsResp.Routes) == 0 || len(directionsResp.Routes[0].Legs) == 0 {
 		return TransportOption{}, fmt.Errorf("no transit routes found")
 	}
 
@@ -67,7 +64,13 @@ func (ts *TransportService) getPublicTransit(from, to Location, date time.Time)
 	duration := time.Duration(leg.Duration.Value) * time.Second
 	price := ts.estimateTransportPrice(leg.Distance.Value, "transit")
 
-	return TransportOption{
+	// The path is only for drawing; a bad polyline doesn't lose the option
+	path, err := directionsPath(directionsResp)
+	if err != nil {
+		LoggerFromContext(ctx).Debug("ignoring Directions path", errorAttr(err))
+	}
+
+	option := TransportOption{
 		Mode:      "public_transport",
 		From:      from,
 		To:        to,
@@ -77,7 +80,97 @@ func (ts *TransportService) getPublicTransit(from, to Location, date time.Time)
 		Departure: date,
 		Arrival:   date.Add(duration),
 		Provider:  "Public Transport",
-	}, nil
+		Distance:  float64(leg.Distance.Value) / 1000,
+		Path:      SimplifyPath(path, ts.config.Load().PathTolerance),
+	}
+	option.CO2 = EstimateCO2(option)
+	return option, nil
+}
+
+// getTimetableTransit plans public transport through the local timetable.
+// The option runs from leaving from on foot to reaching to on foot; its
+// path goes through every stop on the way.
+func (ts *TransportService) getTimetableTransit(from, to Location, date time.Time) (TransportOption, bool) {
+	fromPoint, okFrom := locationPoint(from)
+	toPoint, okTo := locationPoint(to)
+	if !okFrom || !okTo {
+		return TransportOption{}, false
+	}
+	journey, ok := ts.timetable.Plan(fromPoint, toPoint, date)
+	if !ok {
+		return TransportOption{}, false
+	}
+
+	option := TransportOption{
+		Mode:      "public_transport",
+		From:      from,
+		To:        to,
+		Duration:  journey.Arrival.Sub(journey.Departure),
+		Currency:  "EUR",
+		Departure: journey.Departure,
+		Arrival:   journey.Arrival,
+		Path:      []LatLng{fromPoint},
+	}
+
+	// Fares are summed when the feed has them for every ride, otherwise
+	// the whole journey is estimated by distance
+	var providers []string
+	fares, fared := 0.0, true
+	for _, ride := range journey.Rides {
+		leg := ts.timetable.feed.Option(ride, "public_transport", "", 0)
+		providers = append(providers, leg.Provider)
+		option.Distance += leg.Distance
+		option.Path = append(option.Path, leg.Path...)
+		if price, currency, ok := ts.timetable.feed.Fare(ride.Trip.Route); ok && currency == "EUR" {
+			fares += price
+		} else {
+			fared = false
+		}
+	}
+	option.Path = append(option.Path, toPoint)
+	option.Provider = strings.Join(providers, ", ")
+	option.Distance = math.Round(option.Distance*10) / 10
+	if fared {
+		option.Price = fares
+	} else {
+		option.Price = ts.estimateTransportPrice(int(option.Distance*1000), "transit")
+	}
+	option.CO2 = EstimateCO2(option)
+	return option, true
+}
+
+// directionsPath decodes the path of the first Directions route. The step
+// polylines are joined because they follow the streets more closely than
+// the overview polyline, which is the fallback.
+func directionsPath(resp GoogleDirectionsResponse) ([]LatLng, error) {
+	route := resp.Routes[0]
+
+	var path []LatLng
+	for _, leg := range route.Legs {
+		for _, step := range leg.Steps {
+			points, err := DecodePolyline(step.Polyline.Points)
+			if err != nil {
+				return nil, fmt.Errorf("step polyline: %w", err)
+			}
+			// Each step starts where the previous one ended
+			if len(path) > 0 && len(points) > 0 && points[0] == path[len(path)-1] {
+				points = points[1:]
+			}
+			path = append(path, points...)
+		}
+	}
+	if len(path) >= 2 {
+		return path, nil
+	}
+
+	path, err := DecodePolyline(route.OverviewPolyline.Points)
+	if err != nil {
+		return nil, fmt.Errorf("overview polyline: %w", err)
+	}
+	if len(path) < 2 {
+		return nil, nil
+	}
+	return path, nil
 }
 
 func (ts *TransportService) getTaxiEstimate(from, to Location, date time.Time) (TransportOption, error) {
@@ -85,7 +178,7 @@ func (ts *TransportService) getTaxiEstimate(from, to Location, date time.Time) (
 	duration := time.Duration(distance/60) * time.Hour // Assume 60km/h average
 	price := ts.estimateTransportPrice(int(distance*1000), "taxi")
 
-	return TransportOption{
+	option := TransportOption{
 		Mode:      "taxi",
 		From:      from,
 		To:        to,
@@ -95,7 +188,10 @@ func (ts *TransportService) getTaxiEstimate(from, to Location, date time.Time) (
 		Departure: date,
 		Arrival:   date.Add(duration),
 		Provider:  "Taxi",
-	}, nil
+		Distance:  math.Round(distance*10) / 10,
+	}
+	option.CO2 = EstimateCO2(option)
+	return option, nil
 }
 
 func (ts *TransportService) estimateTransportPrice(distanceMeters int, mode string) float64 {
@@ -2,102 +2,501 @@
 package main
 
 import (
+	"cmp"
+	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
-	"sort"
+	"slices"
+	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // TravelFinder is the main service
 type TravelFinder struct {
-	config       Config
+	config       *ConfigStore
 	client       *http.Client
+	google       *GoogleClient
 	airportSvc   *AirportService
 	transportSvc *TransportService
 	flightSvc    *FlightService
+	rail         RailProvider  // nil when rail search is off
+	buses        BusProvider   // nil when bus search is off
+	ferries      FerryProvider // nil when ferry search is off
+	metrics      *Metrics
+	health       *HealthChecker
+	searches     *SearchStore
+	timeZones    *TimeZoneService
 }
 
 // NewTravelFinder creates a new travel finder instance
 func NewTravelFinder(config Config) *TravelFinder {
-	client := &http.Client{Timeout: 30 * time.Second}
+	// Timeouts are applied per attempt by the transport and overall through
+	// the request context, so the client itself has none. Each attempt gets
+	// its own client span.
+	client := &http.Client{Transport: NewResilientTransport(config, newTracedTransport(http.DefaultTransport))}
+	metrics := NewMetrics()
+
+	// The services share one store so a reload reaches all of them at once,
+	// including a rotated Google API key
+	store := NewConfigStore(config)
+	google := NewGoogleClient(config, client, metrics)
+	google.apiKey = func() string { return store.Load().GoogleMapsAPIKey }
+	metrics.WatchBudget(google.Budget())
 
-	return &TravelFinder{
-		config:       config,
+	// Readiness depends on the configuration and on Google accepting our
+	// key; the probe is cached so /readyz doesn't spend the daily budget
+	health := NewHealthChecker(config.HealthCheckTimeout)
+	health.Register("config", true, configCheck(store))
+	health.Register("google", true, CachedCheck(config.HealthProbeInterval, config.HealthCheckTimeout, google.Probe))
+
+	tf := &TravelFinder{
+		config:       store,
 		client:       client,
-		airportSvc:   NewAirportService(config, client),
-		transportSvc: NewTransportService(config, client),
-		flightSvc:    NewFlightService(config, client),
+		google:       google,
+		airportSvc:   NewAirportService(store, google),
+		transportSvc: NewTransportService(store, google),
+		flightSvc:    NewFlightService(store, client, metrics),
+		metrics:      metrics,
+		health:       health,
+		searches:     NewSearchStore(config.SearchResultTTL, config.SearchResultLimit),
+		timeZones:    NewTimeZoneService(google),
+	}
+
+	// A broken timetable shouldn't take flight search down with it, so it
+	// only marks the service degraded. A feed used for several modes is
+	// loaded once.
+	feeds := make(map[string]*GTFSFeed)
+	feedErrs := make(map[string]error)
+	loadFeed := func(check, path, disabled string) *GTFSFeed {
+		if path == "" {
+			return nil
+		}
+		if _, ok := feeds[path]; !ok {
+			feed, err := LoadGTFS(path)
+			if err != nil {
+				slog.Error(disabled, slog.String("path", path), errorAttr(err))
+			}
+			feeds[path], feedErrs[path] = feed, err
+		}
+		err := feedErrs[path]
+		health.Register(check, false, func(ctx context.Context) error { return err })
+		return feeds[path]
 	}
+	if feed := loadFeed("rail_timetable", config.RailGTFSPath, "rail search disabled"); feed != nil {
+		tf.rail = NewGTFSRail(feed, store)
+	}
+	if feed := loadFeed("bus_timetable", config.BusGTFSPath, "bus search disabled"); feed != nil {
+		tf.buses = NewGTFSBus(feed, store)
+	}
+	if feed := loadFeed("ferry_timetable", config.FerryGTFSPath, "ferry search disabled"); feed != nil {
+		tf.ferries = NewGTFSFerry(feed, store)
+	}
+	if feed := loadFeed("transit_timetable", config.TransitGTFSPath, "transit timetable disabled"); feed != nil {
+		tf.transportSvc.timetable = NewJourneyPlanner(feed)
+	}
+
+	return tf
 }
 
 // FindRoutes finds all possible routes from origin to destination
-func (tf *TravelFinder) FindRoutes(origin, destination string, travelDate time.Time) ([]Route, error) {
-	var routes []Route
+func (tf *TravelFinder) FindRoutes(ctx context.Context, origin, destination string, travelDate time.Time) (routes []Route, err error) {
+	ctx, span := tf.startSearchSpan(ctx, "FindRoutes", origin, destination, travelDate)
+	ctx = withCallCounter(ctx)
+	defer func(start time.Time) {
+		tf.observeSearch(ctx, origin, destination, len(routes), time.Since(start), err)
+		span.SetAttributes(attribute.Int("search.routes", len(routes)))
+		endSpan(span, err)
+	}(time.Now())
+
+	plan, err := tf.prepareSearch(ctx, origin, destination)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect results per airport so the final order doesn't depend on which
+	// search finished first
+	batches := make([][]Route, len(plan.airports)+1)
+	for result := range tf.searchAirports(ctx, plan, travelDate) {
+		batches[result.index] = result.routes
+	}
+
+	for _, batch := range batches {
+		routes = append(routes, batch...)
+	}
+	if len(routes) == 0 && plan.noFlights != nil {
+		return nil, plan.noFlights
+	}
+
+	// Sort routes by total price
+	SortRoutes(routes, "price")
+
+	return routes, nil
+}
+
+// routeOrders are the orders search results can be sorted in, by name
+var routeOrders = map[string]func(a, b Route) int{
+	"price":    func(a, b Route) int { return cmp.Compare(a.TotalPrice, b.TotalPrice) },
+	"duration": func(a, b Route) int { return cmp.Compare(a.TotalTime, b.TotalTime) },
+	"co2":      func(a, b Route) int { return cmp.Compare(a.TotalCO2, b.TotalCO2) },
+}
+
+// SortRoutes sorts routes by price, duration or co2, keeping the current
+// order of ties. It reports false for an unknown order.
+func SortRoutes(routes []Route, by string) bool {
+	order, ok := routeOrders[by]
+	if ok {
+		slices.SortStableFunc(routes, order)
+	}
+	return ok
+}
+
+// StreamRoutes runs the same search as FindRoutes but hands the routes found
+// through each origin airport to emit as soon as that airport's search
+// completes. Batches arrive in completion order and are not sorted across
+// airports. If emit returns an error the search stops and the error is returned.
+func (tf *TravelFinder) StreamRoutes(ctx context.Context, origin, destination string, travelDate time.Time, emit func([]Route) error) (err error) {
+	count := 0
+	ctx, span := tf.startSearchSpan(ctx, "StreamRoutes", origin, destination, travelDate)
+	ctx = withCallCounter(ctx)
+	defer func(start time.Time) {
+		tf.observeSearch(ctx, origin, destination, count, time.Since(start), err)
+		span.SetAttributes(attribute.Int("search.routes", count))
+		endSpan(span, err)
+	}(time.Now())
+
+	plan, err := tf.prepareSearch(ctx, origin, destination)
+	if err != nil {
+		return err
+	}
+
+	for result := range tf.searchAirports(ctx, plan, travelDate) {
+		if len(result.routes) == 0 {
+			continue
+		}
+		count += len(result.routes)
+		if err := emit(result.routes); err != nil {
+			return err
+		}
+	}
+	if count == 0 && plan.noFlights != nil {
+		return plan.noFlights
+	}
+
+	return nil
+}
+
+// startSearchSpan opens the root span of a route search
+func (tf *TravelFinder) startSearchSpan(ctx context.Context, name, origin, destination string, travelDate time.Time) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(
+		attribute.String("search.origin", origin),
+		attribute.String("search.destination", destination),
+		attribute.String("search.date", travelDate.Format("2006-01-02")),
+	))
+}
 
+// observeSearch records a finished search in the metrics and the log
+func (tf *TravelFinder) observeSearch(ctx context.Context, origin, destination string, routes int, duration time.Duration, err error) {
+	tf.metrics.ObserveSearch(ctx, routes, duration, err)
+
+	attrs := []slog.Attr{
+		slog.String(logKeyOrigin, origin),
+		slog.String(logKeyDestination, destination),
+		slog.Int("routes", routes),
+		slog.Int64("google_calls", googleCalls(ctx)),
+		durationAttr(duration),
+	}
+	if err != nil {
+		LoggerFromContext(ctx).LogAttrs(ctx, slog.LevelWarn, "search failed", append(attrs, errorAttr(err))...)
+		return
+	}
+	LoggerFromContext(ctx).LogAttrs(ctx, slog.LevelInfo, "search completed", attrs...)
+}
+
+// searchPlan is what a route search starts from: both ends of the trip, the
+// airport serving the destination and the airports reachable from the origin.
+// Without a destination airport, noFlights says why and only overland routes
+// are searched; the search fails with it if there are none.
+type searchPlan struct {
+	origin             Location
+	destination        Location
+	destinationAirport Location
+	airports           []Location
+	noFlights          error
+}
+
+// prepareSearch geocodes both ends of the trip and resolves the destination
+// airport and the airports reachable from the origin. A destination without
+// an airport is only an error when there's no timetable to get there by.
+func (tf *TravelFinder) prepareSearch(ctx context.Context, origin, destination string) (searchPlan, error) {
 	// Step 1: Get origin coordinates
-	originLocation, err := tf.airportSvc.GeocodeLocation(origin)
+	originLocation, err := tf.airportSvc.GeocodeLocation(ctx, origin)
 	if err != nil {
-		return nil, fmt.Errorf("failed to geocode origin %s: %v", origin, err)
+		return searchPlan{}, fmt.Errorf("failed to geocode origin %s: %w", origin, err)
 	}
 
 	// Step 2: Get destination coordinates and airport info
-	destinationLocation, err := tf.airportSvc.GeocodeLocation(destination)
+	destinationLocation, err := tf.airportSvc.GeocodeLocation(ctx, destination)
 	if err != nil {
-		return nil, fmt.Errorf("failed to geocode destination %s: %v", destination, err)
+		return searchPlan{}, fmt.Errorf("failed to geocode destination %s: %w", destination, err)
 	}
 
 	// Find destination airport
-	destAirports, err := tf.airportSvc.FindNearbyAirports(destinationLocation, 50000) // 50km radius for destination
-	if err != nil || len(destAirports) == 0 {
-		return nil, fmt.Errorf("no airports found near %s", destination)
+	destAirports, err := tf.airportSvc.FindNearbyAirports(ctx, destinationLocation, 50000) // 50km radius for destination
+	if err != nil {
+		return searchPlan{}, fmt.Errorf("failed to find airports near %s: %w", destination, err)
+	}
+	if len(destAirports) == 0 {
+		noFlights := fmt.Errorf("%w near %s", ErrNoAirports, destination)
+		if len(tf.timetables()) == 0 {
+			return searchPlan{}, noFlights
+		}
+		return searchPlan{origin: originLocation, destination: destinationLocation, noFlights: noFlights}, nil
 	}
 	destinationAirport := destAirports[0] // Use closest airport
 
 	// Step 3: Find airports reachable from origin
-	reachableAirports, err := tf.airportSvc.FindReachableAirports(originLocation)
+	reachableAirports, err := tf.airportSvc.FindReachableAirports(ctx, originLocation)
 	if err != nil {
-		return nil, fmt.Errorf("error finding reachable airports: %v", err)
+		return searchPlan{}, fmt.Errorf("error finding reachable airports: %w", err)
 	}
 
-	// Step 4: For each reachable airport, find routes
-	for _, airport := range reachableAirports {
-		// Get ground transport to airport
-		groundTransport, err := tf.transportSvc.GetGroundTransport(originLocation, airport, travelDate)
-		if err != nil {
-			continue // Skip this airport if no ground transport available
+	return searchPlan{
+		origin:             originLocation,
+		destination:        destinationLocation,
+		destinationAirport: destinationAirport,
+		airports:           reachableAirports,
+	}, nil
+}
+
+// airportResult holds the routes found through one origin airport, or the
+// routes by train, coach or ferry all the way when index is past the last
+// airport
+type airportResult struct {
+	index  int
+	routes []Route
+}
+
+// searchAirports searches the origin airports concurrently, at most
+// AirportConcurrency at a time, along with the trains, coaches and ferries
+// all the way when they're searched. The returned channel is buffered for
+// every search, so abandoning it early doesn't leak goroutines, and it is
+// closed once every search has finished.
+func (tf *TravelFinder) searchAirports(ctx context.Context, plan searchPlan, travelDate time.Time) <-chan airportResult {
+	results := make(chan airportResult, len(plan.airports)+1)
+	slots := make(chan struct{}, tf.config.Load().AirportConcurrency)
+
+	var wg sync.WaitGroup
+	for i, airport := range plan.airports {
+		wg.Add(1)
+		go func(i int, airport Location) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results <- airportResult{
+				index:  i,
+				routes: tf.routesViaAirport(ctx, plan, airport, travelDate),
+			}
+		}(i, airport)
+	}
+
+	if len(tf.timetables()) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- airportResult{
+				index:  len(plan.airports),
+				routes: tf.overlandRoutes(ctx, plan.origin, plan.destination, travelDate),
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+const (
+	// airportConnection is the least time a train, coach or ferry leaves
+	// between reaching the airport and the flight's departure, for check-in
+	// and security
+	airportConnection = 90 * time.Minute
+
+	// portConnection is the least time between landing and a ferry's
+	// departure, to collect bags and get to the port
+	portConnection = 90 * time.Minute
+)
+
+// routesViaAirport builds every route that reaches the destination through
+// the given origin airport. Each flight is reached by ground transport and,
+// when they're searched, also by the latest train, coach and ferry that
+// make it in time. Flights are also followed by the first ferry from the
+// destination airport's coast that can be caught after landing.
+func (tf *TravelFinder) routesViaAirport(ctx context.Context, plan searchPlan, airport Location, travelDate time.Time) (routes []Route) {
+	originLocation, destinationAirport := plan.origin, plan.destinationAirport
+
+	ctx, span := tracer().Start(ctx, "search.airport", trace.WithAttributes(locationAttributes("airport", airport)...))
+	defer func() {
+		span.SetAttributes(attribute.Int("search.routes", len(routes)))
+		span.End()
+	}()
+
+	// Get ground transport to airport
+	groundTransport, groundErr := tf.transportSvc.GetGroundTransport(ctx, originLocation, airport, travelDate)
+	if groundErr != nil {
+		span.AddEvent("no ground transport", trace.WithAttributes(attribute.String("error", groundErr.Error())))
+	}
+	scheduled := tf.searchTimetables(ctx, originLocation, airport, travelDate)
+	if groundErr != nil && len(scheduled) == 0 {
+		LoggerFromContext(ctx).Debug("skipping airport without ground transport",
+			slog.String(logKeyOrigin, originLocation.Name), slog.String(logKeyAirport, airport.Code), errorAttr(groundErr))
+		return nil // Skip this airport if no ground transport available
+	}
+
+	// Check direct flights, then connecting flights
+	var itineraries [][]TransportOption
+	if directFlights, err := tf.flightSvc.SearchFlights(ctx, airport, destinationAirport, travelDate); err == nil {
+		for _, flight := range directFlights {
+			itineraries = append(itineraries, []TransportOption{flight})
+		}
+	}
+	if connectingRoutes, err := tf.flightSvc.FindConnectingFlights(ctx, airport, destinationAirport, travelDate); err == nil {
+		for _, connectingRoute := range connectingRoutes {
+			itineraries = append(itineraries, connectingRoute.Segments)
 		}
+	}
 
-		// Check direct flights
-		directFlights, err := tf.flightSvc.SearchFlights(airport, destinationAirport, travelDate)
-		if err == nil {
-			for _, flight := range directFlights {
-				route := Route{
-					Segments: []TransportOption{groundTransport, flight},
-					Currency: "EUR",
-				}
-				route.CalculateTotals()
-				routes = append(routes, route)
+	for _, flights := range itineraries {
+		var firstLegs []TransportOption
+		if groundErr == nil {
+			firstLegs = append(firstLegs, groundTransport)
+		}
+		for _, options := range scheduled {
+			if leg, ok := latestArrival(options, flights[0].Departure.Add(-airportConnection)); ok {
+				firstLegs = append(firstLegs, leg)
 			}
 		}
 
-		// Check connecting flights
-		connectingRoutes, err := tf.flightSvc.FindConnectingFlights(airport, destinationAirport, travelDate)
-		if err == nil {
-			for _, connectingRoute := range connectingRoutes {
-				fullRoute := Route{
-					Segments: append([]TransportOption{groundTransport}, connectingRoute.Segments...),
-					Currency: "EUR",
-				}
-				fullRoute.CalculateTotals()
-				routes = append(routes, fullRoute)
+		crossing, crosses := tf.firstCrossing(ctx, plan, flights[len(flights)-1].Arrival)
+		for _, first := range firstLegs {
+			segments := append([]TransportOption{first}, flights...)
+			routes = append(routes, newRoute(segments))
+			if crosses {
+				routes = append(routes, newRoute(append(slices.Clip(segments), crossing)))
 			}
 		}
 	}
 
-	// Sort routes by total price
-	sort.Slice(routes, func(i, j int) bool {
-		return routes[i].TotalPrice < routes[j].TotalPrice
-	})
+	return routes
+}
 
-	return routes, nil
+// overlandRoutes builds the routes that make the whole trip on one train
+// or coach
+func (tf *TravelFinder) overlandRoutes(ctx context.Context, originLocation, destination Location, travelDate time.Time) (routes []Route) {
+	ctx, span := tracer().Start(ctx, "search.overland")
+	defer func() {
+		span.SetAttributes(attribute.Int("search.routes", len(routes)))
+		span.End()
+	}()
+
+	for _, options := range tf.searchTimetables(ctx, originLocation, destination, travelDate) {
+		for _, option := range options {
+			routes = append(routes, newRoute([]TransportOption{option}))
+		}
+	}
+	return routes
+}
+
+// timetable searches one timetabled ground mode
+type timetable struct {
+	mode   string
+	search func(ctx context.Context, from, to Location, date time.Time) ([]TransportOption, error)
+}
+
+// timetables lists the timetabled modes that are searched: trains,
+// coaches, then ferries
+func (tf *TravelFinder) timetables() []timetable {
+	var timetables []timetable
+	if tf.rail != nil {
+		timetables = append(timetables, timetable{"train", tf.rail.SearchTrains})
+	}
+	if tf.buses != nil {
+		timetables = append(timetables, timetable{"bus", tf.buses.SearchBuses})
+	}
+	if tf.ferries != nil {
+		timetables = append(timetables, timetable{"ferry", tf.ferries.SearchFerries})
+	}
+	return timetables
+}
+
+// searchTimetables returns the departures between two places of each
+// timetabled mode that has some. A failed search counts as none.
+func (tf *TravelFinder) searchTimetables(ctx context.Context, from, to Location, travelDate time.Time) [][]TransportOption {
+	var found [][]TransportOption
+	for _, timetable := range tf.timetables() {
+		options, err := timetable.search(ctx, from, to, travelDate)
+		if err != nil {
+			LoggerFromContext(ctx).Warn("timetable search failed", slog.String("mode", timetable.mode),
+				slog.String(logKeyOrigin, from.Name), slog.String(logKeyDestination, to.Name), errorAttr(err))
+			continue
+		}
+		if len(options) > 0 {
+			found = append(found, options)
+		}
+	}
+	return found
+}
+
+// firstCrossing finds the first ferry from the destination airport's coast
+// to the destination that leaves portConnection after landing, if ferry
+// search is on and doesn't fail
+func (tf *TravelFinder) firstCrossing(ctx context.Context, plan searchPlan, landing time.Time) (TransportOption, bool) {
+	if tf.ferries == nil {
+		return TransportOption{}, false
+	}
+	after := landing.Add(portConnection)
+	ferries, err := tf.ferries.SearchCrossings(ctx, plan.destinationAirport, plan.destination, after)
+	if err != nil {
+		LoggerFromContext(ctx).Warn("timetable search failed", slog.String("mode", "ferry"),
+			slog.String(logKeyOrigin, plan.destinationAirport.Name), slog.String(logKeyDestination, plan.destination.Name), errorAttr(err))
+		return TransportOption{}, false
+	}
+	return earliestDeparture(ferries, after)
+}
+
+// earliestDeparture picks the first option leaving no earlier than after
+func earliestDeparture(options []TransportOption, after time.Time) (TransportOption, bool) {
+	var best TransportOption
+	found := false
+	for _, option := range options {
+		if !option.Departure.Before(after) && (!found || option.Departure.Before(best.Departure)) {
+			best, found = option, true
+		}
+	}
+	return best, found
+}
+
+// latestArrival picks the option arriving last but no later than deadline
+func latestArrival(options []TransportOption, deadline time.Time) (TransportOption, bool) {
+	var best TransportOption
+	found := false
+	for _, option := range options {
+		if !option.Arrival.After(deadline) && (!found || option.Arrival.After(best.Arrival)) {
+			best, found = option, true
+		}
+	}
+	return best, found
+}
+
+// newRoute builds a route from its segments, with the totals filled in
+func newRoute(segments []TransportOption) Route {
+	route := Route{Segments: segments, Currency: "EUR"}
+	route.CalculateTotals()
+	return route
 }
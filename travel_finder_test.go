@@ -1,52 +1,58 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestFindRoutes_Errors(t *testing.T) {
 	tf := NewTravelFinder(Config{GoogleMapsAPIKey: "test-key"})
 	// Should error on invalid origin
-	_, err := tf.FindRoutes("", "Barcelona", time.Now())
+	_, err := tf.FindRoutes(context.Background(), "", "Barcelona", time.Now())
 	assert.Error(t, err)
 	// Should error on invalid destination
-	_, err = tf.FindRoutes("Madrid", "", time.Now())
+	_, err = tf.FindRoutes(context.Background(), "Madrid", "", time.Now())
 	assert.Error(t, err)
 }
 
 func TestFindRoutes_SuccessMock(t *testing.T) {
 	tf := NewTravelFinder(Config{GoogleMapsAPIKey: "test-key"})
 	// This will likely error due to mock key, but test structure
-	_, err := tf.FindRoutes("Madrid", "Barcelona", time.Now())
+	_, err := tf.FindRoutes(context.Background(), "Madrid", "Barcelona", time.Now())
 	assert.Error(t, err)
 }
 
 func TestAirportService_FindReachableAirports_Empty(t *testing.T) {
-	as := &AirportService{config: Config{GoogleMapsAPIKey: "test-key"}, client: &http.Client{}}
+	as := NewAirportService(NewConfigStore(Config{GoogleMapsAPIKey: "test-key"}), newStubGoogleClient(t, googleStatusHandler("ZERO_RESULTS", "")))
 	loc := Location{Name: "Nowhere", Latitude: 0, Longitude: 0}
-	result, err := as.FindReachableAirports(loc)
+	result, err := as.FindReachableAirports(context.Background(), loc)
 	assert.NoError(t, err)
 	assert.Empty(t, result)
 }
 
 func TestAirportService_FindNearbyAirports_Empty(t *testing.T) {
-	as := &AirportService{config: Config{GoogleMapsAPIKey: "test-key"}, client: &http.Client{}}
+	as := NewAirportService(NewConfigStore(Config{GoogleMapsAPIKey: "test-key"}), newStubGoogleClient(t, googleStatusHandler("ZERO_RESULTS", "")))
 	loc := Location{Name: "Nowhere", Latitude: 0, Longitude: 0}
-	result, err := as.FindNearbyAirports(loc, 100)
+	result, err := as.FindNearbyAirports(context.Background(), loc, 100)
 	assert.NoError(t, err)
 	assert.Empty(t, result)
 }
 
 func TestFlightService_FindConnectingFlights(t *testing.T) {
-	fs := &FlightService{config: Config{}, client: nil}
+	fs := &FlightService{config: NewConfigStore(Config{}), client: nil}
 	from := Location{Name: "A", Code: "AAA"}
 	to := Location{Name: "B", Code: "BBB"}
 	date := time.Now()
-	options, err := fs.FindConnectingFlights(from, to, date)
+	options, err := fs.FindConnectingFlights(context.Background(), from, to, date)
 	assert.NoError(t, err)
 	assert.NotNil(t, options)
 }
@@ -58,4 +64,266 @@ func TestTravelFinder_NewTravelFinder(t *testing.T) {
 	assert.NotNil(t, tf.airportSvc)
 	assert.NotNil(t, tf.transportSvc)
 	assert.NotNil(t, tf.flightSvc)
+	assert.Nil(t, tf.rail)
+
+	t.Run("Rail timetable", func(t *testing.T) {
+		tf := NewTravelFinder(Config{GoogleMapsAPIKey: "test-key", RailGTFSPath: filepath.Join("testdata", "gtfs", "rail")})
+		assert.NotNil(t, tf.rail)
+	})
+
+	t.Run("Transit timetable shares the rail feed", func(t *testing.T) {
+		path := filepath.Join("testdata", "gtfs", "rail")
+		tf := NewTravelFinder(Config{GoogleMapsAPIKey: "test-key", RailGTFSPath: path, TransitGTFSPath: path})
+		require.NotNil(t, tf.transportSvc.timetable)
+		assert.Same(t, tf.rail.(*GTFSRail).feed, tf.transportSvc.timetable.feed)
+	})
+
+	t.Run("Coach timetable", func(t *testing.T) {
+		tf := NewTravelFinder(Config{GoogleMapsAPIKey: "test-key", BusGTFSPath: filepath.Join("testdata", "gtfs", "bus")})
+		assert.NotNil(t, tf.buses)
+		assert.Nil(t, tf.rail)
+	})
+
+	t.Run("Ferry timetable", func(t *testing.T) {
+		tf := NewTravelFinder(Config{GoogleMapsAPIKey: "test-key", FerryGTFSPath: filepath.Join("testdata", "gtfs", "ferry")})
+		assert.NotNil(t, tf.ferries)
+
+		report := tf.health.Run(context.Background())
+		assert.Equal(t, "ok", report.Checks["ferry_timetable"].Status)
+		assert.NotContains(t, report.Checks, "rail_timetable", "only configured timetables are checked")
+	})
+
+	t.Run("Broken rail timetable", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "missing.zip")
+		tf := NewTravelFinder(Config{GoogleMapsAPIKey: "test-key", RailGTFSPath: path, TransitGTFSPath: path})
+		assert.Nil(t, tf.rail, "flights are still searched")
+
+		report := tf.health.Run(context.Background())
+		assert.Equal(t, "fail", report.Checks["rail_timetable"].Status)
+		assert.Equal(t, "fail", report.Checks["transit_timetable"].Status)
+		assert.False(t, report.Checks["rail_timetable"].Critical)
+	})
+}
+
+// stubTimetable answers rail and coach searches with fixed departures per
+// destination name
+type stubTimetable map[string][]TransportOption
+
+func (st stubTimetable) SearchTrains(_ context.Context, _, to Location, _ time.Time) ([]TransportOption, error) {
+	return st[to.Name], nil
+}
+
+func (st stubTimetable) SearchBuses(_ context.Context, _, to Location, _ time.Time) ([]TransportOption, error) {
+	return st[to.Name], nil
+}
+
+func TestFindRoutes_Trains(t *testing.T) {
+	date := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	train := func(to string, departure, arrival time.Duration) TransportOption {
+		return TransportOption{Mode: "train", From: Location{Name: "Granada"}, To: Location{Name: to},
+			Departure: date.Add(departure), Arrival: date.Add(arrival), Duration: arrival - departure, Price: 30, Currency: "EUR"}
+	}
+
+	tf := newStubSearchFinder(t)
+	tf.rail = stubTimetable{
+		// Flights leave Madrid two hours after the travel date, so only the
+		// first train leaves time to check in
+		"Adolfo Suárez Madrid-Barajas Airport (MAD)": {
+			train("Madrid Airport", 0, 20*time.Minute),
+			train("Madrid Airport", 10*time.Minute, time.Hour),
+		},
+		"Tel Aviv": {train("Tel Aviv", time.Hour, 30*time.Hour)},
+	}
+
+	routes, err := tf.FindRoutes(context.Background(), "Granada", "Tel Aviv", date)
+	require.NoError(t, err)
+	require.Len(t, routes, 9, "4 routes by taxi, 4 by train and one train all the way")
+
+	var byTrain, trainOnly int
+	for _, route := range routes {
+		switch {
+		case len(route.Segments) == 1:
+			trainOnly++
+			assert.Equal(t, "train", route.Segments[0].Mode)
+			assert.Equal(t, 30.0, route.TotalPrice)
+		case route.Segments[0].Mode == "train":
+			byTrain++
+			assert.Equal(t, date.Add(20*time.Minute), route.Segments[0].Arrival, "the latest train in time")
+			assert.Equal(t, "flight", route.Segments[1].Mode)
+		}
+	}
+	assert.Equal(t, 4, byTrain)
+	assert.Equal(t, 1, trainOnly)
+}
+
+// concurrencyProbe is a rail timetable that records how many searches to
+// an airport run at once
+type concurrencyProbe struct {
+	mu            sync.Mutex
+	running, peak int
+}
+
+func (cp *concurrencyProbe) SearchTrains(_ context.Context, _, to Location, _ time.Time) ([]TransportOption, error) {
+	if to.Type != "airport" {
+		return nil, nil
+	}
+	cp.mu.Lock()
+	cp.running++
+	cp.peak = max(cp.peak, cp.running)
+	cp.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	cp.mu.Lock()
+	cp.running--
+	cp.mu.Unlock()
+	return nil, nil
+}
+
+func TestSearchAirports_Concurrency(t *testing.T) {
+	tf := newStubSearchFinder(t)
+	config := tf.config.Load()
+	config.AirportConcurrency = 2
+	tf.config.Store(config)
+	probe := &concurrencyProbe{}
+	tf.rail = probe
+
+	plan := searchPlan{origin: Location{Name: "Granada"}, destinationAirport: Location{Name: "Tel Aviv", Code: "TLV"}}
+	for i := range 8 {
+		plan.airports = append(plan.airports, Location{Name: fmt.Sprintf("Airport %d", i), Type: "airport"})
+	}
+
+	var searched int
+	for range tf.searchAirports(context.Background(), plan, time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)) {
+		searched++
+	}
+	assert.Equal(t, 9, searched, "every airport and the overland search")
+	assert.LessOrEqual(t, probe.peak, 2)
+}
+
+func TestFindRoutes_NoDestinationAirport(t *testing.T) {
+	date := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	tf := newStubSearchFinder(t)
+	google := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/geocode/json" {
+			fmt.Fprint(w, `{"status": "OK", "results": [{"geometry": {"location": {"lat": 36.7423, "lng": -5.1671}}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"results": [], "status": "ZERO_RESULTS"}`)
+	}))
+	t.Cleanup(google.Close)
+	tf.google.baseURL = google.URL
+
+	_, err := tf.FindRoutes(context.Background(), "Granada", "Ronda", date)
+	assert.ErrorIs(t, err, ErrNoAirports, "nothing to get there by")
+
+	tf.rail = stubTimetable{}
+	_, err = tf.FindRoutes(context.Background(), "Granada", "Ronda", date)
+	assert.ErrorIs(t, err, ErrNoAirports, "no train either")
+
+	tf.rail = stubTimetable{"Ronda": {{Mode: "train", To: Location{Name: "Ronda"}, Departure: date, Arrival: date.Add(3 * time.Hour), Price: 20, Currency: "EUR"}}}
+	routes, err := tf.FindRoutes(context.Background(), "Granada", "Ronda", date)
+	require.NoError(t, err)
+	require.Len(t, routes, 1)
+	assert.Equal(t, "train", routes[0].Segments[0].Mode)
+
+	var streamed int
+	require.NoError(t, tf.StreamRoutes(context.Background(), "Granada", "Ronda", date, func(batch []Route) error {
+		streamed += len(batch)
+		return nil
+	}))
+	assert.Equal(t, 1, streamed)
+}
+
+func TestSortRoutes(t *testing.T) {
+	routes := []Route{
+		{Description: "cheap", TotalPrice: 100, TotalTime: 20 * time.Hour, TotalCO2: 500},
+		{Description: "fast", TotalPrice: 400, TotalTime: 5 * time.Hour, TotalCO2: 600},
+		{Description: "green", TotalPrice: 250, TotalTime: 12 * time.Hour, TotalCO2: 30},
+	}
+	order := func() []string {
+		var names []string
+		for _, route := range routes {
+			names = append(names, route.Description)
+		}
+		return names
+	}
+
+	assert.True(t, SortRoutes(routes, "co2"))
+	assert.Equal(t, []string{"green", "cheap", "fast"}, order())
+	assert.True(t, SortRoutes(routes, "duration"))
+	assert.Equal(t, []string{"fast", "green", "cheap"}, order())
+	assert.True(t, SortRoutes(routes, "price"))
+	assert.Equal(t, []string{"cheap", "green", "fast"}, order())
+	assert.False(t, SortRoutes(routes, "stops"))
+}
+
+func TestFindRoutes_Buses(t *testing.T) {
+	date := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	leg := func(mode string, arrival time.Duration) TransportOption {
+		return TransportOption{Mode: mode, From: Location{Name: "Granada"}, To: Location{Name: "Madrid Airport"},
+			Departure: date, Arrival: date.Add(arrival), Duration: arrival, Price: 20, Currency: "EUR"}
+	}
+
+	tf := newStubSearchFinder(t)
+	airport := "Adolfo Suárez Madrid-Barajas Airport (MAD)"
+	tf.rail = stubTimetable{airport: {leg("train", 20*time.Minute)}}
+	tf.buses = stubTimetable{airport: {leg("bus", 25*time.Minute), leg("bus", 31*time.Minute)}}
+
+	routes, err := tf.FindRoutes(context.Background(), "Granada", "Tel Aviv", date)
+	require.NoError(t, err)
+	require.Len(t, routes, 12, "each flight by taxi, train and coach")
+
+	modes := make(map[string]int)
+	for _, route := range routes {
+		modes[route.Segments[0].Mode]++
+		if route.Segments[0].Mode == "bus" {
+			assert.Equal(t, date.Add(25*time.Minute), route.Segments[0].Arrival, "the coach arriving too late is left out")
+			assert.Equal(t, "flight", route.Segments[1].Mode)
+		}
+	}
+	assert.Equal(t, map[string]int{"taxi": 4, "train": 4, "bus": 4}, modes)
+}
+
+// stubFerries answers ferry searches with fixed crossings per departure
+// place name
+type stubFerries map[string][]TransportOption
+
+func (sf stubFerries) SearchFerries(_ context.Context, from, _ Location, _ time.Time) ([]TransportOption, error) {
+	return sf[from.Name], nil
+}
+
+func (sf stubFerries) SearchCrossings(_ context.Context, airport, _ Location, _ time.Time) ([]TransportOption, error) {
+	return sf[airport.Name], nil
+}
+
+func TestFindRoutes_Ferries(t *testing.T) {
+	date := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	crossing := func(departure time.Duration) TransportOption {
+		return TransportOption{Mode: "ferry", From: Location{Name: "Port", Type: "port"}, To: Location{Name: "Island", Type: "port"},
+			Departure: date.Add(departure), Arrival: date.Add(departure + time.Hour), Duration: time.Hour, Price: 27, Currency: "EUR"}
+	}
+	crossings := []TransportOption{crossing(time.Hour), crossing(9 * time.Hour), crossing(20 * time.Hour)}
+
+	tf := newStubSearchFinder(t)
+	tf.ferries = stubFerries{"Ben Gurion Airport (TLV)": crossings}
+
+	routes, err := tf.FindRoutes(context.Background(), "Granada", "Tel Aviv", date)
+	require.NoError(t, err)
+	require.Len(t, routes, 8, "every flight route, with and without the crossing")
+
+	var crossed int
+	for _, route := range routes {
+		last := route.Segments[len(route.Segments)-1]
+		if last.Mode != "ferry" {
+			continue
+		}
+		crossed++
+		landing := route.Segments[len(route.Segments)-2]
+		require.Equal(t, "flight", landing.Mode)
+		expected, ok := earliestDeparture(crossings, landing.Arrival.Add(portConnection))
+		require.True(t, ok)
+		assert.Equal(t, expected.Departure, last.Departure, "the first crossing after landing")
+	}
+	assert.Equal(t, 4, crossed)
 }
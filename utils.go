@@ -3,7 +3,10 @@ package main
 import (
 	"fmt"
 	"math"
+	"os"
 	"strings"
+
+	"github.com/walidBarakehe/travel-routes/renderer"
 )
 
 // CalculateDistance calculates distance between two points using Haversine formula
@@ -77,25 +80,13 @@ func ExtractIATACode(airportName string) string {
 
 // PrintRoutes prints routes in a formatted way
 func PrintRoutes(routes []Route) {
-	fmt.Printf("\nFound %d routes:\n\n", len(routes))
-	for i, route := range routes {
-		fmt.Printf("Route %d: %s\n", i+1, route.Description)
-		fmt.Printf("  Total Price: %.2f %s\n", route.TotalPrice, route.Currency)
-		fmt.Printf("  Total Time: %v\n", route.TotalTime)
-		fmt.Printf("  Departure: %s\n", route.Departure.Format("2006-01-02 15:04"))
-		fmt.Printf("  Arrival: %s\n", route.Arrival.Format("2006-01-02 15:04"))
-
-		for j, segment := range route.Segments {
-			fmt.Printf("    Segment %d: %s from %s to %s\n", j+1, segment.Mode, segment.From.Name, segment.To.Name)
-			fmt.Printf("      Duration: %v, Price: %.2f %s\n", segment.Duration, segment.Price, segment.Currency)
-		}
-		fmt.Println()
-	}
+	renderRoutes(os.Stdout, "text", routes, renderer.Options{})
 }
 
-// CalculateTotals calculates total price and time for a route
+// CalculateTotals calculates total price, emissions and time for a route
 func (r *Route) CalculateTotals() {
 	r.TotalPrice = 0
+	r.TotalCO2 = 0
 	r.TotalTime = 0
 
 	if len(r.Segments) == 0 {
@@ -109,8 +100,10 @@ func (r *Route) CalculateTotals() {
 	var descriptions []string
 	for _, segment := range r.Segments {
 		r.TotalPrice += segment.Price
+		r.TotalCO2 += segment.CO2
 		descriptions = append(descriptions, fmt.Sprintf("%s (%s)", segment.Mode, segment.Provider))
 	}
 
+	r.TotalCO2 = math.Round(r.TotalCO2*10) / 10
 	r.Description = strings.Join(descriptions, " → ")
 }